@@ -66,17 +66,17 @@ func cancelAccountDeletion(
 // registered -> pending_deletion -> deleted lifecycle.
 // Verifies user and routes are gone after confirmed deletion.
 func TestAccountDeletionFullFlow(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel, labelSmoke)
 
 	// Step 1: Create anonymous user -> register -> confirm
-	t.Log("Step 1: Create and register user")
+	step(t, "Step 1: Create and register user")
 
 	userID, token, _ := createAnonymousUser(t)
 	email := uniqueEmail()
 	_, regToken, _ := registerAndConfirm(t, token, email)
 
 	// Step 2: Create a route under the registered user
-	t.Log("Step 2: Create route as registered user")
+	step(t, "Step 2: Create route as registered user")
 
 	routeID := prepareRoute(t, regToken)
 
@@ -95,9 +95,9 @@ func TestAccountDeletionFullFlow(t *testing.T) {
 	getRouteResp.Body.Close()
 
 	// Step 3: Request account deletion
-	t.Log("Step 3: Request account deletion")
+	step(t, "Step 3: Request account deletion")
 
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	reqResp := requestAccountDeletion(t, regToken)
 	require.Equal(t,
@@ -107,7 +107,7 @@ func TestAccountDeletionFullFlow(t *testing.T) {
 	reqResp.Body.Close()
 
 	// Step 4: Extract deletion verification code
-	t.Log("Step 4: Extract deletion code from email")
+	step(t, "Step 4: Extract deletion code from email")
 
 	msgID := waitForEmail(t, email)
 	code := extractVerificationCode(t, msgID)
@@ -116,7 +116,11 @@ func TestAccountDeletionFullFlow(t *testing.T) {
 	)
 
 	// Step 5: Confirm account deletion
-	t.Log("Step 5: Confirm account deletion")
+	step(t, "Step 5: Confirm account deletion")
+
+	cascade := routeCascadeTarget(t, routeID, regToken)
+	cascade.UserID = userID
+	confirmedAt := time.Now()
 
 	confirmResp := confirmAccountDeletion(
 		t, regToken, code,
@@ -130,7 +134,7 @@ func TestAccountDeletionFullFlow(t *testing.T) {
 	// Step 6: Verify user is gone.
 	// Use a fresh anonymous token to avoid 401 from the
 	// deleted user's invalidated JWT.
-	t.Log("Step 6: Verify user is gone (404)")
+	step(t, "Step 6: Verify user is gone (404)")
 
 	_, probeToken, _ := createAnonymousUser(t)
 
@@ -154,7 +158,7 @@ func TestAccountDeletionFullFlow(t *testing.T) {
 	// Step 7: Verify route is gone (cascade)
 	// Route deletion is event-driven (async). Poll until the
 	// cascade completes rather than assuming it already happened.
-	t.Log("Step 7: Verify route is gone (404)")
+	step(t, "Step 7: Verify route is gone (404)")
 
 	var routeStatus int
 	require.Eventually(t, func() bool {
@@ -171,6 +175,14 @@ func TestAccountDeletionFullFlow(t *testing.T) {
 		"route of deleted user must return 404 or 403 "+
 			"(last status %d)", routeStatus,
 	)
+
+	// Step 8: Verify the cascade reached the database, object store
+	// and Valkey, not just the API view.
+	step(t, "Step 8: Verify cascade removed all stored data")
+
+	waitForCascade(
+		t, "account", cascade, confirmedAt, defaultCascadeTimeout,
+	)
 }
 
 // --- Task F.2: Cancel account deletion ---
@@ -178,7 +190,7 @@ func TestAccountDeletionFullFlow(t *testing.T) {
 // TestCancelAccountDeletion verifies that a pending deletion
 // can be cancelled, restoring the user to registered state.
 func TestCancelAccountDeletion(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	// Setup: Register and confirm user
 	t.Log("Setup: Register and confirm user")
@@ -188,9 +200,9 @@ func TestCancelAccountDeletion(t *testing.T) {
 	_, regToken, _ := registerAndConfirm(t, token, email)
 
 	// Step 1: Request account deletion
-	t.Log("Step 1: Request account deletion")
+	step(t, "Step 1: Request account deletion")
 
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	reqResp := requestAccountDeletion(t, regToken)
 	require.Equal(t,
@@ -205,7 +217,7 @@ func TestCancelAccountDeletion(t *testing.T) {
 	oldCode := extractVerificationCode(t, msgID)
 
 	// Step 2: Cancel account deletion
-	t.Log("Step 2: Cancel account deletion")
+	step(t, "Step 2: Cancel account deletion")
 
 	cancelResp := cancelAccountDeletion(t, regToken)
 	require.Equal(t,
@@ -215,7 +227,7 @@ func TestCancelAccountDeletion(t *testing.T) {
 	cancelResp.Body.Close()
 
 	// Step 3: Login with email + password → 200
-	t.Log("Step 3: Login after cancel succeeds")
+	step(t, "Step 3: Login after cancel succeeds")
 
 	loginResp := doRequest(
 		t, http.MethodPost,
@@ -233,7 +245,7 @@ func TestCancelAccountDeletion(t *testing.T) {
 	loginResp.Body.Close()
 
 	// Step 4: Old deletion code is invalidated
-	t.Log("Step 4: Old deletion code is invalidated")
+	step(t, "Step 4: Old deletion code is invalidated")
 
 	confirmResp := confirmAccountDeletion(
 		t, regToken, oldCode,
@@ -251,9 +263,9 @@ func TestCancelAccountDeletion(t *testing.T) {
 	)
 
 	// Step 5: Can request deletion again
-	t.Log("Step 5: Can request deletion again")
+	step(t, "Step 5: Can request deletion again")
 
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	reqResp2 := requestAccountDeletion(t, regToken)
 	require.Equal(t,
@@ -269,7 +281,7 @@ func TestCancelAccountDeletion(t *testing.T) {
 // attempt limiting (429 on 6th attempt), and cancel after
 // max attempts.
 func TestDeletionCodeSecurity(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel, labelSecurity)
 
 	// Setup: Register, confirm, and request deletion
 	t.Log("Setup: Register, confirm, request deletion")
@@ -278,7 +290,7 @@ func TestDeletionCodeSecurity(t *testing.T) {
 	email := uniqueEmail()
 	_, regToken, _ := registerAndConfirm(t, token, email)
 
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	reqResp := requestAccountDeletion(t, regToken)
 	require.Equal(t,
@@ -292,7 +304,7 @@ func TestDeletionCodeSecurity(t *testing.T) {
 	_ = extractVerificationCode(t, msgID)
 
 	// Step 1: Submit wrong code 5 times → 400 each
-	t.Log("Step 1: Submit wrong code 5 times")
+	step(t, "Step 1: Submit wrong code 5 times")
 
 	const maxAttempts = 5
 
@@ -310,7 +322,7 @@ func TestDeletionCodeSecurity(t *testing.T) {
 	}
 
 	// Step 2: 6th attempt → 429 (too_many_attempts)
-	t.Log("Step 2: 6th attempt returns 429")
+	step(t, "Step 2: 6th attempt returns 429")
 
 	exhaustedResp := confirmAccountDeletion(
 		t, regToken, "000000",
@@ -323,7 +335,7 @@ func TestDeletionCodeSecurity(t *testing.T) {
 	exhaustedResp.Body.Close()
 
 	// Step 3: Cancel still works after max attempts
-	t.Log("Step 3: Cancel works after max attempts")
+	step(t, "Step 3: Cancel works after max attempts")
 
 	cancelResp := cancelAccountDeletion(t, regToken)
 	require.Equal(t,
@@ -359,14 +371,7 @@ func TestDeletionCodeSecurity(t *testing.T) {
 // TestStateExpiry restarts the API with aggressive expiry
 // settings, runs expiry subtests, then restores the normal API.
 func TestStateExpiry(t *testing.T) {
-	if envOrDefault(
-		"INTEGRATION_TEST_MODE", "local",
-	) != "local" {
-		t.Skip(
-			"state expiry tests require API restart " +
-				"(local mode only)",
-		)
-	}
+	isolate(t, isolationDestructive, labelSlow, labelLocalOnly)
 
 	restartAPIProcess(t,
 		"AUTH_PENDING_REGISTRATION_EXPIRY=3s",
@@ -380,8 +385,6 @@ func TestStateExpiry(t *testing.T) {
 
 	// F.4: Pending registration expires → reverts to anonymous
 	t.Run("PendingRegistrationExpiry", func(t *testing.T) {
-		clearMailbox(t)
-
 		userID, token, _ := createAnonymousUser(t)
 
 		email := uniqueEmail()
@@ -438,8 +441,6 @@ func TestStateExpiry(t *testing.T) {
 
 		// Can re-register with a new email (proves user is
 		// back to anonymous state)
-		clearMailbox(t)
-
 		newEmail := uniqueEmail()
 
 		reRegResp := doRequest(
@@ -460,13 +461,11 @@ func TestStateExpiry(t *testing.T) {
 
 	// F.5: Pending deletion expires → reverts to registered
 	t.Run("PendingDeletionExpiry", func(t *testing.T) {
-		clearMailbox(t)
-
 		_, token, _ := createAnonymousUser(t)
 		email := uniqueEmail()
 		_, regToken, _ := registerAndConfirm(t, token, email)
 
-		clearMailbox(t)
+		clearMailbox(t, email)
 
 		// Request deletion (user becomes pending_deletion)
 		reqResp := requestAccountDeletion(t, regToken)
@@ -525,7 +524,7 @@ func TestStateExpiry(t *testing.T) {
 		// Old deletion code should not work (verify by
 		// requesting fresh deletion and confirming that
 		// flow works — proves user is back to registered)
-		clearMailbox(t)
+		clearMailbox(t, email)
 
 		reqResp2 := requestAccountDeletion(t, freshToken)
 		require.Equal(t,
@@ -541,6 +540,8 @@ func TestStateExpiry(t *testing.T) {
 // TestRequestDeletionAsAnonymous verifies that an anonymous
 // user (not registered) cannot request account deletion.
 func TestRequestDeletionAsAnonymous(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	_, anonToken, _ := createAnonymousUser(t)
 
 	resp := requestAccountDeletion(t, anonToken)
@@ -561,14 +562,14 @@ func TestRequestDeletionAsAnonymous(t *testing.T) {
 // state returns 429 (resend_too_soon) when the cooldown
 // window has not elapsed.
 func TestRequestDeletionResendCooldown(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	_, anonToken, _ := createAnonymousUser(t)
 	email := uniqueEmail()
 	_, regToken, _ := registerAndConfirm(t, anonToken, email)
 
 	// First request
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	resp1 := requestAccountDeletion(t, regToken)
 	require.Equal(t,
@@ -591,14 +592,7 @@ func TestRequestDeletionResendCooldown(t *testing.T) {
 // fresh code that can be used to confirm deletion.
 // Local mode only — requires API restart with short cooldown.
 func TestDeletionResendAfterCooldown(t *testing.T) {
-	if envOrDefault(
-		"INTEGRATION_TEST_MODE", "local",
-	) != "local" {
-		t.Skip(
-			"resend cooldown test requires API restart " +
-				"(local mode only)",
-		)
-	}
+	isolate(t, isolationDestructive, labelLocalOnly)
 
 	restartAPIProcess(t,
 		"AUTH_RESEND_COOLDOWN=2s",
@@ -607,15 +601,13 @@ func TestDeletionResendAfterCooldown(t *testing.T) {
 		restartAPIProcess(t)
 	})
 
-	clearMailbox(t)
-
 	// Setup: Register and confirm user
 	_, token, _ := createAnonymousUser(t)
 	email := uniqueEmail()
 	_, regToken, _ := registerAndConfirm(t, token, email)
 
 	// Step 1: Request deletion
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	resp1 := requestAccountDeletion(t, regToken)
 	require.Equal(t,
@@ -641,7 +633,7 @@ func TestDeletionResendAfterCooldown(t *testing.T) {
 	time.Sleep(3 * time.Second)
 
 	// Step 4: Resend after cooldown succeeds
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	resp3 := requestAccountDeletion(t, regToken)
 	require.Equal(t,
@@ -672,7 +664,7 @@ func TestDeletionResendAfterCooldown(t *testing.T) {
 // account deletion when not in pending_deletion state returns
 // an error.
 func TestCancelDeletionWhenNotPending(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	_, anonToken, _ := createAnonymousUser(t)
 	email := uniqueEmail()
@@ -696,7 +688,7 @@ func TestCancelDeletionWhenNotPending(t *testing.T) {
 // account deletion when not in pending_deletion state returns
 // an error.
 func TestConfirmDeletionWhenNotPending(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	_, anonToken, _ := createAnonymousUser(t)
 	email := uniqueEmail()
@@ -18,6 +18,8 @@ import (
 // TestRefreshWithGarbageToken verifies that POST /auth/refresh
 // with a non-JWT string returns 401, not 500.
 func TestRefreshWithGarbageToken(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	resp := doRequest(
 		t, http.MethodPost,
 		apiURL+"/api/v1/auth/refresh",
@@ -38,7 +40,7 @@ func TestRefreshWithGarbageToken(t *testing.T) {
 // on the same session does not crash. The second call may
 // return 204 (idempotent) or 401 (session gone).
 func TestLogoutIdempotency(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	_, anonToken, _ := createAnonymousUser(t)
 	email := uniqueEmail()
@@ -97,7 +99,7 @@ func TestLogoutIdempotency(t *testing.T) {
 // TestLogoutAllIdempotency verifies that calling logout-all
 // twice does not crash. The second call deletes 0 rows.
 func TestLogoutAllIdempotency(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	_, anonToken, _ := createAnonymousUser(t)
 	email := uniqueEmail()
@@ -156,7 +158,7 @@ func TestLogoutAllIdempotency(t *testing.T) {
 // TestConcurrentDoubleRefresh fires two refresh calls
 // simultaneously with the same token. Neither must 500.
 func TestConcurrentDoubleRefresh(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	_, anonToken, _ := createAnonymousUser(t)
 	email := uniqueEmail()
@@ -187,9 +189,9 @@ func TestConcurrentDoubleRefresh(t *testing.T) {
 
 	client := &http.Client{
 		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
+		Transport: secretScanning(&http.Transport{
 			DisableKeepAlives: true,
-		},
+		}),
 	}
 
 	var wg sync.WaitGroup
@@ -255,7 +257,7 @@ func TestConcurrentDoubleRefresh(t *testing.T) {
 // TestAccountDeletionKillsSessions verifies that confirming
 // account deletion invalidates all active sessions.
 func TestAccountDeletionKillsSessions(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel, labelSecurity)
 
 	// Register and login
 	_, anonToken, _ := createAnonymousUser(t)
@@ -282,9 +284,9 @@ func TestAccountDeletionKillsSessions(t *testing.T) {
 	require.NotEmpty(t, refreshToken)
 
 	// Request account deletion
-	t.Log("Step 1: Request account deletion")
+	step(t, "Step 1: Request account deletion")
 
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	reqResp := requestAccountDeletion(t, regToken)
 	require.Equal(
@@ -298,7 +300,7 @@ func TestAccountDeletionKillsSessions(t *testing.T) {
 	code := extractVerificationCode(t, msgID)
 
 	// Confirm deletion
-	t.Log("Step 2: Confirm account deletion")
+	step(t, "Step 2: Confirm account deletion")
 
 	confirmResp := confirmAccountDeletion(t, regToken, code)
 	require.Equal(
@@ -308,7 +310,7 @@ func TestAccountDeletionKillsSessions(t *testing.T) {
 	confirmResp.Body.Close()
 
 	// Refresh with old token must fail
-	t.Log("Step 3: Refresh with old token fails")
+	step(t, "Step 3: Refresh with old token fails")
 
 	refreshResp := doRequest(
 		t, http.MethodPost,
@@ -332,14 +334,14 @@ func TestAccountDeletionKillsSessions(t *testing.T) {
 // TestResetPasswordCodeExhaustion verifies that submitting
 // 5 wrong reset codes returns 400, and the 6th returns 429.
 func TestResetPasswordCodeExhaustion(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel, labelSecurity)
 
 	_, anonToken, _ := createAnonymousUser(t)
 	email := uniqueEmail()
 	_, _, _ = registerAndConfirm(t, anonToken, email)
 
 	// Request password reset
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	forgotResp := doRequest(
 		t, http.MethodPost,
@@ -358,7 +360,7 @@ func TestResetPasswordCodeExhaustion(t *testing.T) {
 	_ = extractVerificationCode(t, msgID)
 
 	// Submit wrong code 5 times → 400 each
-	t.Log("Step 1: Submit wrong code 5 times")
+	step(t, "Step 1: Submit wrong code 5 times")
 
 	const maxAttempts = 5
 
@@ -384,7 +386,7 @@ func TestResetPasswordCodeExhaustion(t *testing.T) {
 	}
 
 	// 6th attempt → 429
-	t.Log("Step 2: 6th attempt returns 429")
+	step(t, "Step 2: 6th attempt returns 429")
 
 	exhaustedResp := doRequest(
 		t, http.MethodPost,
@@ -408,7 +410,7 @@ func TestResetPasswordCodeExhaustion(t *testing.T) {
 // TestCrossUserSessionIsolation verifies that user A's
 // token cannot access user B's data.
 func TestCrossUserSessionIsolation(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel, labelSecurity)
 
 	// Register user A
 	_, anonA, _ := createAnonymousUser(t)
@@ -432,8 +434,6 @@ func TestCrossUserSessionIsolation(t *testing.T) {
 	require.NotEmpty(t, tokenA)
 
 	// Register user B
-	clearMailbox(t)
-
 	_, anonB, _ := createAnonymousUser(t)
 	emailB := uniqueEmail()
 	userBID, _, _ := registerAndConfirm(t, anonB, emailB)
@@ -463,6 +463,8 @@ func TestCrossUserSessionIsolation(t *testing.T) {
 // TestRegisterMissingRequiredFields verifies that POST
 // /auth/register with empty body returns 400.
 func TestRegisterMissingRequiredFields(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	_, token, _ := createAnonymousUser(t)
 
 	resp := doRequest(
@@ -482,6 +484,8 @@ func TestRegisterMissingRequiredFields(t *testing.T) {
 // TestLoginMissingRequiredFields verifies that POST
 // /auth/login with missing fields returns 400.
 func TestLoginMissingRequiredFields(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	// Missing password
 	resp1 := doRequest(
 		t, http.MethodPost,
@@ -519,7 +523,7 @@ func TestLoginMissingRequiredFields(t *testing.T) {
 // for a pending (unconfirmed) user returns 204, never leaking
 // that the email exists in pending state.
 func TestForgotPasswordPendingUser(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	_, token, _ := createAnonymousUser(t)
 	email := uniqueEmail()
@@ -555,6 +559,8 @@ func TestForgotPasswordPendingUser(t *testing.T) {
 // TestRefreshWithEmptyString verifies that POST /auth/refresh
 // with an empty refresh_token returns 400 or 401, not 500.
 func TestRefreshWithEmptyString(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	resp := doRequest(
 		t, http.MethodPost,
 		apiURL+"/api/v1/auth/refresh",
@@ -581,7 +587,7 @@ func TestRefreshWithEmptyString(t *testing.T) {
 // code. Code A (before resend) must fail; code B (after
 // resend) must succeed.
 func TestResendVerificationInvalidatesOldCode(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	_, token, _ := createAnonymousUser(t)
 	email := uniqueEmail()
@@ -607,7 +613,7 @@ func TestResendVerificationInvalidatesOldCode(t *testing.T) {
 	time.Sleep(6 * time.Second)
 
 	// Resend
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	resendResp := doRequest(
 		t, http.MethodPost,
@@ -627,7 +633,7 @@ func TestResendVerificationInvalidatesOldCode(t *testing.T) {
 	codeB := extractVerificationCode(t, msgIDB)
 
 	// Code A must fail
-	t.Log("Step 1: Old code A must fail")
+	step(t, "Step 1: Old code A must fail")
 
 	confirmA := doRequest(
 		t, http.MethodPost,
@@ -647,7 +653,7 @@ func TestResendVerificationInvalidatesOldCode(t *testing.T) {
 	)
 
 	// Code B must succeed
-	t.Log("Step 2: New code B must succeed")
+	step(t, "Step 2: New code B must succeed")
 
 	confirmB := doRequest(
 		t, http.MethodPost,
@@ -668,7 +674,7 @@ func TestResendVerificationInvalidatesOldCode(t *testing.T) {
 // and that reuse detection revokes the entire session family
 // (OAuth 2.0 Security BCP).
 func TestConfirmRegistrationSessionRotation(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	_, anonToken, _ := createAnonymousUser(t)
 	email := uniqueEmail()
@@ -681,7 +687,7 @@ func TestConfirmRegistrationSessionRotation(t *testing.T) {
 	)
 
 	// Refresh with the confirm-registration token
-	t.Log("Step 1: Refresh with confirm token")
+	step(t, "Step 1: Refresh with confirm token")
 
 	refreshResp := doRequest(
 		t, http.MethodPost,
@@ -711,7 +717,7 @@ func TestConfirmRegistrationSessionRotation(t *testing.T) {
 
 	// Old confirm token must be dead — reuse detected,
 	// entire session family revoked (OAuth 2.0 Security BCP).
-	t.Log("Step 2: Replay old token → reuse detection")
+	step(t, "Step 2: Replay old token → reuse detection")
 
 	replayResp := doRequest(
 		t, http.MethodPost,
@@ -730,7 +736,7 @@ func TestConfirmRegistrationSessionRotation(t *testing.T) {
 	replayResp.Body.Close()
 
 	// New token also dead — session family revoked
-	t.Log("Step 3: New token also dead (family revoked)")
+	step(t, "Step 3: New token also dead (family revoked)")
 
 	newResp := doRequest(
 		t, http.MethodPost,
@@ -753,6 +759,8 @@ func TestConfirmRegistrationSessionRotation(t *testing.T) {
 // TestOAuthGoogleInvalidToken verifies that POST
 // /auth/oauth/google with a garbage ID token returns 401.
 func TestOAuthGoogleInvalidToken(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	_, token, _ := createAnonymousUser(t)
 
 	resp := doRequest(
@@ -774,6 +782,8 @@ func TestOAuthGoogleInvalidToken(t *testing.T) {
 // TestOAuthAppleInvalidToken verifies that POST
 // /auth/oauth/apple with a garbage ID token returns 401.
 func TestOAuthAppleInvalidToken(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	_, token, _ := createAnonymousUser(t)
 
 	resp := doRequest(
@@ -798,7 +808,7 @@ func TestOAuthAppleInvalidToken(t *testing.T) {
 func TestLoginReturnsCorrectUserIDAfterRegistration(
 	t *testing.T,
 ) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	anonUserID, anonToken, _ := createAnonymousUser(t)
 	email := uniqueEmail()
@@ -841,6 +851,8 @@ func TestLoginReturnsCorrectUserIDAfterRegistration(
 // base64-decodes the payload, changes user_id, re-encodes,
 // and sends it. The signature check must reject it.
 func TestTamperedJWT(t *testing.T) {
+	isolate(t, isolationParallel, labelSecurity)
+
 	_, token, _ := createAnonymousUser(t)
 
 	// JWT format: header.payload.signature
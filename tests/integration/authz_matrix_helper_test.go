@@ -0,0 +1,331 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// authzActor is one kind of caller in the authorization matrix.
+type authzActor int
+
+const (
+	// actorOwner is the anonymous user owning every fixture resource.
+	actorOwner authzActor = iota
+	// actorOtherAnonymous is an unrelated anonymous user.
+	actorOtherAnonymous
+	// actorRegistered is an unrelated registered user.
+	actorRegistered
+	// actorAdmin carries the admin:access scope but owns nothing.
+	actorAdmin
+	// actorExpired is the owner's own token, re-signed already expired.
+	actorExpired
+	// actorNone sends no Authorization header.
+	actorNone
+)
+
+// authzActors lists every actor in the order their cells run: the owner
+// goes last so its (possibly mutating) call cannot change what the
+// others are denied.
+var authzActors = []authzActor{
+	actorNone,
+	actorExpired,
+	actorOtherAnonymous,
+	actorRegistered,
+	actorAdmin,
+	actorOwner,
+}
+
+func (a authzActor) String() string {
+	switch a {
+	case actorOwner:
+		return "owner"
+	case actorOtherAnonymous:
+		return "other_anonymous"
+	case actorRegistered:
+		return "registered"
+	case actorAdmin:
+		return "admin"
+	case actorExpired:
+		return "expired"
+	case actorNone:
+		return "no_token"
+	default:
+		return fmt.Sprintf("actor(%d)", int(a))
+	}
+}
+
+// authzCell is the set of statuses one actor may get from one endpoint.
+type authzCell []int
+
+var (
+	// cellUnauthenticated is the only answer for a missing or bad token.
+	cellUnauthenticated = authzCell{http.StatusUnauthorized}
+	// cellForbidden denies another user's resource; 404 is accepted so the
+	// API need not confirm the resource exists.
+	cellForbidden = authzCell{http.StatusForbidden, http.StatusNotFound}
+	// cellAdminRequired denies a non-admin caller.
+	cellAdminRequired = authzCell{
+		http.StatusUnauthorized, http.StatusForbidden,
+	}
+	// cellOK is a plain 200.
+	cellOK = authzCell{http.StatusOK}
+	// cellNoContent is a plain 204.
+	cellNoContent = authzCell{http.StatusNoContent}
+	// cellWrongState is the 422 the owner gets when the fixture is in the
+	// wrong state for the call: past authorization, but refused by the
+	// handler.
+	cellWrongState = authzCell{http.StatusUnprocessableEntity}
+	// cellNotPending is the state guard of the account endpoints when the
+	// caller has nothing pending.
+	cellNotPending = authzCell{http.StatusBadRequest, http.StatusConflict}
+)
+
+// allows reports whether status satisfies the cell.
+func (c authzCell) allows(status int) bool {
+	return slices.Contains(c, status)
+}
+
+func (c authzCell) String() string { return fmt.Sprint([]int(c)) }
+
+// authzExpect maps every actor to its cell.
+type authzExpect map[authzActor]authzCell
+
+// with returns a copy of e with actor's cell replaced.
+func (e authzExpect) with(actor authzActor, cell authzCell) authzExpect {
+	out := maps.Clone(e)
+	out[actor] = cell
+
+	return out
+}
+
+// ownerOnly is the expectation for a resource only its owner may touch.
+func ownerOnly(owner authzCell) authzExpect {
+	return authzExpect{
+		actorOwner:          owner,
+		actorOtherAnonymous: cellForbidden,
+		actorRegistered:     cellForbidden,
+		actorAdmin:          cellForbidden,
+		actorExpired:        cellUnauthenticated,
+		actorNone:           cellUnauthenticated,
+	}
+}
+
+// anyUser is the expectation for an endpoint scoped to the caller,
+// which every valid token may call.
+func anyUser(cell authzCell) authzExpect {
+	return authzExpect{
+		actorOwner:          cell,
+		actorOtherAnonymous: cell,
+		actorRegistered:     cell,
+		actorAdmin:          cell,
+		actorExpired:        cellUnauthenticated,
+		actorNone:           cellUnauthenticated,
+	}
+}
+
+// callerScoped is the expectation for an endpoint acting on the
+// caller's own account, where the outcome depends on the kind of
+// account. The admin token's user has no account row to act on.
+func callerScoped(anonymous, registered authzCell) authzExpect {
+	return authzExpect{
+		actorOwner:          anonymous,
+		actorOtherAnonymous: anonymous,
+		actorRegistered:     registered,
+		actorAdmin:          cellForbidden,
+		actorExpired:        cellUnauthenticated,
+		actorNone:           cellUnauthenticated,
+	}
+}
+
+// adminOnly is the expectation for an endpoint behind admin:access.
+func adminOnly() authzExpect {
+	return authzExpect{
+		actorOwner:          cellAdminRequired,
+		actorOtherAnonymous: cellAdminRequired,
+		actorRegistered:     cellAdminRequired,
+		actorAdmin:          cellOK,
+		actorExpired:        cellUnauthenticated,
+		actorNone:           cellUnauthenticated,
+	}
+}
+
+// publicEndpoint is the expectation for an endpoint that ignores the
+// caller.
+func publicEndpoint(cell authzCell) authzExpect {
+	e := make(authzExpect, len(authzActors))
+	for _, a := range authzActors {
+		e[a] = cell
+	}
+
+	return e
+}
+
+// authzRow is one endpoint in the matrix. Path may use the placeholders
+// {route_id}, {pending_route_id}, {ready_route_id}, {waypoint_id},
+// {image_id}, {revision_id} and {user_id}, filled from the fixtures.
+type authzRow struct {
+	Method string
+	Path   string
+	Body   func(f *authzFixtures) any
+	Expect authzExpect
+	// Destructive rows remove a fixture on success, so they run after
+	// every other row.
+	Destructive bool
+	// CallerScoped rows change the caller's own sessions or account, so
+	// each runs with freshly created callers instead of the shared ones.
+	CallerScoped bool
+}
+
+// name is the row's "METHOD /path" label.
+func (r authzRow) name() string { return r.Method + " " + r.Path }
+
+// authzFixtures are the resources and tokens the matrix runs against,
+// created once for the whole run.
+type authzFixtures struct {
+	UserID         string
+	RouteID        string
+	PendingRouteID string
+	ReadyRouteID   string
+	WaypointID     string
+	ImageID        string
+	RevisionID     string
+
+	tokens map[authzActor]string
+}
+
+// newAuthzFixtures creates the owner with a published, processed route
+// and a pending revision on it, a prepared route without waypoints and
+// a processed route not yet published, plus a token for every other
+// actor.
+func newAuthzFixtures(t *testing.T) *authzFixtures {
+	t.Helper()
+
+	userID, ownerToken, _ := createAnonymousUser(t)
+
+	routeID := createProcessedRoute(t, ownerToken, 1)
+	publishRoute(t, routeID, ownerToken)
+
+	waypoints := newDBInspector(t).waypoints(t, routeID)
+	require.Len(t, waypoints, 1, "newAuthzFixtures: waypoint")
+
+	revision, status := prepareRevision(t, routeID, ownerToken)
+	require.Equal(t, http.StatusCreated, status,
+		"newAuthzFixtures: prepare revision",
+	)
+
+	return &authzFixtures{
+		UserID:         userID,
+		RouteID:        routeID,
+		PendingRouteID: prepareRoute(t, ownerToken),
+		ReadyRouteID:   createProcessedRoute(t, ownerToken, 1),
+		WaypointID:     waypoints[0].ID,
+		ImageID:        waypoints[0].ImageID,
+		RevisionID:     revision.RevisionID,
+		tokens:         newAuthzTokens(t, ownerToken),
+	}
+}
+
+// newAuthzTokens returns a token for every actor, with ownerToken as
+// the owner's and the other callers created fresh.
+func newAuthzTokens(t *testing.T, ownerToken string) map[authzActor]string {
+	t.Helper()
+
+	_, otherToken, _ := createAnonymousUser(t)
+
+	_, anonToken, _ := createAnonymousUser(t)
+	_, registeredToken, _ := registerAndConfirm(t, anonToken, uniqueEmail())
+
+	expired := resignAPIToken(t, ownerToken, nil,
+		func(c map[string]any) {
+			past := time.Now().Add(-time.Hour)
+			c["iat"] = past.Add(-time.Hour).Unix()
+			c["nbf"] = past.Add(-time.Hour).Unix()
+			c["exp"] = past.Unix()
+		},
+	)
+
+	return map[authzActor]string{
+		actorOwner:          ownerToken,
+		actorOtherAnonymous: otherToken,
+		actorRegistered:     registeredToken,
+		actorAdmin:          adminToken(t),
+		actorExpired:        expired,
+		actorNone:           "",
+	}
+}
+
+// url fills path's placeholders from the fixtures.
+func (f *authzFixtures) url(path string) string {
+	return apiURL + strings.NewReplacer(
+		"{route_id}", f.RouteID,
+		"{pending_route_id}", f.PendingRouteID,
+		"{ready_route_id}", f.ReadyRouteID,
+		"{waypoint_id}", f.WaypointID,
+		"{image_id}", f.ImageID,
+		"{revision_id}", f.RevisionID,
+		"{user_id}", f.UserID,
+	).Replace(path)
+}
+
+// runAuthzMatrix checks every row's cells, one subtest per row and
+// actor. Non-destructive rows run first, in table order.
+// Caller-scoped rows get their own callers.
+func runAuthzMatrix(t *testing.T, f *authzFixtures, rows []authzRow) {
+	t.Helper()
+
+	ordered := slices.Clone(rows)
+	slices.SortStableFunc(ordered, func(a, b authzRow) int {
+		switch {
+		case a.Destructive == b.Destructive:
+			return 0
+		case b.Destructive:
+			return -1
+		default:
+			return 1
+		}
+	})
+
+	for _, row := range ordered {
+		t.Run(row.name(), func(t *testing.T) {
+			require.Lenf(t, row.Expect, len(authzActors),
+				"%s must have a cell for every actor", row.name(),
+			)
+
+			tokens := f.tokens
+			if row.CallerScoped {
+				_, ownerToken, _ := createAnonymousUser(t)
+				tokens = newAuthzTokens(t, ownerToken)
+			}
+
+			for _, actor := range authzActors {
+				t.Run(actor.String(), func(t *testing.T) {
+					var body any
+					if row.Body != nil {
+						body = row.Body(f)
+					}
+
+					resp := doRequest(t, row.Method, f.url(row.Path),
+						body, tokens[actor],
+					)
+					resp.Body.Close()
+
+					cell := row.Expect[actor]
+					assert.Truef(t, cell.allows(resp.StatusCode),
+						"%s as %s: want %s, got %d",
+						row.name(), actor, cell, resp.StatusCode,
+					)
+				})
+			}
+		})
+	}
+}
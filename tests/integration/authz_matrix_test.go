@@ -0,0 +1,312 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"bufio"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// authzMatrix lists every follow-api endpoint and what each actor must
+// get from it. A new endpoint needs a row here (or an entry in
+// authzExempt); TestAuthzMatrix_CoversDocumentedEndpoints enforces it
+// against the architecture doc.
+var authzMatrix = []authzRow{
+	// Health.
+	{
+		Method: http.MethodGet, Path: "/health",
+		Expect: publicEndpoint(cellOK),
+	},
+	{Method: http.MethodGet, Path: "/health/db", Expect: adminOnly()},
+	{Method: http.MethodGet, Path: "/health/storage", Expect: adminOnly()},
+	{Method: http.MethodGet, Path: "/health/valkey", Expect: adminOnly()},
+
+	// Users.
+	{
+		Method: http.MethodPost, Path: "/api/v1/users/anonymous",
+		Expect: publicEndpoint(authzCell{
+			http.StatusOK, http.StatusCreated,
+		}),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/users/anonymous/{user_id}",
+		Expect: ownerOnly(cellOK),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/users/admin/stats",
+		Expect: adminOnly(),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/users/admin/anonymous",
+		Expect: adminOnly(),
+	},
+
+	// Route lifecycle.
+	{
+		Method: http.MethodPost, Path: "/api/v1/routes/prepare",
+		// The admin token's user has no row, so there is no one to
+		// allocate the route for.
+		Expect: anyUser(cellOK).with(actorAdmin, cellForbidden),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/routes",
+		Expect: anyUser(cellOK),
+	},
+	{
+		// Other callers get 200 with the route under not_found.
+		Method: http.MethodPost, Path: "/api/v1/routes/sync",
+		Body: func(f *authzFixtures) any {
+			return map[string]any{"routes": []SyncRouteSpec{
+				{RouteID: f.RouteID, Version: 0},
+			}}
+		},
+		Expect: anyUser(cellOK),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/v1/routes/{route_id}",
+		Expect: ownerOnly(cellOK),
+	},
+	{
+		Method: http.MethodPut, Path: "/api/v1/routes/{route_id}",
+		Body: func(*authzFixtures) any {
+			return map[string]any{"description": "authz matrix"}
+		},
+		Expect: ownerOnly(cellOK),
+	},
+	{
+		Method: http.MethodPost,
+		Path:   "/api/v1/routes/{pending_route_id}/create-waypoints",
+		Body: func(*authzFixtures) any {
+			return map[string]any{"waypoints": []map[string]any{
+				buildWaypointBody(0, "authz.jpg", 1024),
+			}}
+		},
+		Expect: ownerOnly(cellOK),
+	},
+	{
+		Method: http.MethodPost,
+		Path:   "/api/v1/routes/{ready_route_id}/publish",
+		Expect: ownerOnly(cellOK),
+	},
+	{
+		Method: http.MethodGet,
+		Path:   "/api/v1/routes/{route_id}/status/stream",
+		Expect: ownerOnly(cellOK),
+	},
+
+	// Waypoints and images.
+	{
+		Method: http.MethodPut,
+		Path:   "/api/v1/routes/{route_id}/waypoints/{waypoint_id}",
+		Body: func(*authzFixtures) any {
+			return map[string]any{"description": "authz matrix"}
+		},
+		Expect: ownerOnly(cellOK),
+	},
+	{
+		Method: http.MethodPost,
+		Path: "/api/v1/routes/{route_id}/waypoints/{waypoint_id}" +
+			"/replace-image/prepare",
+		Body: func(*authzFixtures) any {
+			return map[string]any{
+				"file_name":       "authz.jpg",
+				"file_size_bytes": 1024,
+				"content_type":    "image/jpeg",
+				"marker_x":        0.5,
+				"marker_y":        0.5,
+			}
+		},
+		Expect: ownerOnly(cellOK),
+	},
+	{
+		// The fixture image processed fine, so there is nothing to retry.
+		Method: http.MethodPost,
+		Path: "/api/v1/routes/{route_id}/waypoints/{waypoint_id}" +
+			"/retry-upload",
+		Expect: ownerOnly(cellWrongState),
+	},
+	{
+		Method: http.MethodGet,
+		Path:   "/api/v1/routes/{route_id}/images/{image_id}/status",
+		Expect: ownerOnly(cellOK),
+	},
+
+	// Revisions.
+	{
+		// The fixture revision is still open, and a route has at most one.
+		Method: http.MethodPost,
+		Path:   "/api/v1/routes/{route_id}/revisions/prepare",
+		Expect: ownerOnly(cellWrongState),
+	},
+	{
+		Method: http.MethodPost,
+		Path:   "/api/v1/routes/{route_id}/revisions/{revision_id}/apply",
+		Body: func(f *authzFixtures) any {
+			return map[string]any{
+				"route_id":    f.RouteID,
+				"revision_id": f.RevisionID,
+				"waypoints": []map[string]any{
+					buildExistingImageWaypoint(0, f.ImageID),
+				},
+			}
+		},
+		Expect: ownerOnly(cellOK),
+	},
+	{
+		Method: http.MethodPost,
+		Path:   "/api/v1/routes/{route_id}/revisions/{revision_id}/commit",
+		Expect: ownerOnly(cellOK),
+	},
+
+	// The caller's own sessions and account.
+	{
+		Method: http.MethodPost, Path: "/api/v1/auth/logout",
+		Expect:       anyUser(cellNoContent),
+		CallerScoped: true,
+	},
+	{
+		Method: http.MethodPost, Path: "/api/v1/auth/logout-all",
+		Expect:       anyUser(cellNoContent),
+		CallerScoped: true,
+	},
+	{
+		// Only a pending registration has a code to resend.
+		Method: http.MethodPost, Path: "/api/v1/auth/resend-verification",
+		Body:         func(*authzFixtures) any { return map[string]any{} },
+		Expect:       callerScoped(cellNotPending, cellNotPending),
+		CallerScoped: true,
+	},
+	{
+		Method:       http.MethodPost,
+		Path:         "/api/v1/auth/request-account-deletion",
+		Body:         func(*authzFixtures) any { return map[string]any{} },
+		Expect:       callerScoped(cellNotPending, cellNoContent),
+		CallerScoped: true,
+	},
+	{
+		Method:       http.MethodPost,
+		Path:         "/api/v1/auth/cancel-account-deletion",
+		Body:         func(*authzFixtures) any { return map[string]any{} },
+		Expect:       callerScoped(cellNotPending, cellNotPending),
+		CallerScoped: true,
+	},
+
+	// Removal, route before user.
+	{
+		Method: http.MethodDelete, Path: "/api/v1/routes/{route_id}",
+		Expect:      ownerOnly(cellOK),
+		Destructive: true,
+	},
+	{
+		Method: http.MethodDelete, Path: "/api/v1/users/anonymous/{user_id}",
+		Expect:      ownerOnly(cellOK),
+		Destructive: true,
+	},
+}
+
+// authzExempt lists endpoints deliberately left out of the matrix, with
+// the reason. They take their credential in the body, or create the
+// caller's credential in the first place.
+var authzExempt = map[string]string{
+	"POST /api/v1/auth/refresh": "authenticated by the refresh token " +
+		"in the body (auth_edge_cases_test.go)",
+	"POST /api/v1/auth/register": "turns the caller's anonymous " +
+		"account into a registered one (TestRegisterNoAuth)",
+	"POST /api/v1/auth/login":                    "credential exchange",
+	"POST /api/v1/auth/confirm-registration":     "code in the body",
+	"POST /api/v1/auth/forgot-password":          "email in the body",
+	"POST /api/v1/auth/reset-password":           "code in the body",
+	"POST /api/v1/auth/confirm-account-deletion": "code in the body",
+	"POST /api/v1/auth/oauth/google":             "credential exchange",
+	"POST /api/v1/auth/oauth/apple":              "credential exchange",
+}
+
+// TestAuthzMatrix runs every cell of authzMatrix against one set of
+// fixtures.
+func TestAuthzMatrix(t *testing.T) {
+	isolate(t, isolationParallel, labelSecurity)
+
+	runAuthzMatrix(t, newAuthzFixtures(t), authzMatrix)
+}
+
+// documentedEndpoint matches an endpoint row of the architecture doc's
+// API tables: | `METHOD` | `/path` | ...
+var documentedEndpoint = regexp.MustCompile(
+	"^\\| `(GET|POST|PUT|PATCH|DELETE)` \\| `([^`]+)` \\|",
+)
+
+// pathParam matches a {placeholder} path segment.
+var pathParam = regexp.MustCompile(`\{[^}]+\}`)
+
+// TestAuthzMatrix_CoversDocumentedEndpoints fails when the follow-api
+// section of the architecture doc lists an endpoint that has neither a
+// matrix row nor an exemption. Placeholder names are not compared.
+func TestAuthzMatrix_CoversDocumentedEndpoints(t *testing.T) {
+	isolate(t, isolationParallel, labelSecurity)
+
+	docPath := filepath.Join(
+		"..", "..", "ai-docs", "architecture", "follow-architecture.md",
+	)
+
+	doc, err := os.Open(docPath)
+	if os.IsNotExist(err) {
+		t.Skipf("%s not found; run from the repository checkout", docPath)
+	}
+
+	require.NoError(t, err)
+	defer doc.Close()
+
+	covered := make(map[string]bool)
+	for _, row := range authzMatrix {
+		covered[pathParam.ReplaceAllString(row.name(), "{}")] = true
+	}
+
+	for name := range authzExempt {
+		covered[pathParam.ReplaceAllString(name, "{}")] = true
+	}
+
+	var documented []string
+
+	inAPISection := false
+
+	scanner := bufio.NewScanner(doc)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case strings.HasPrefix(line, "### 3.1 follow-api"):
+			inAPISection = true
+		case strings.HasPrefix(line, "### ") || strings.HasPrefix(line, "## "):
+			inAPISection = false
+		}
+
+		if !inAPISection {
+			continue
+		}
+
+		if m := documentedEndpoint.FindStringSubmatch(line); m != nil {
+			documented = append(documented, m[1]+" "+m[2])
+		}
+	}
+
+	require.NoError(t, scanner.Err())
+	require.NotEmpty(t, documented,
+		"no follow-api endpoints found in %s", docPath,
+	)
+
+	for _, endpoint := range documented {
+		assert.Truef(t,
+			covered[pathParam.ReplaceAllString(endpoint, "{}")],
+			"%s is documented but has no authzMatrix row or exemption",
+			endpoint,
+		)
+	}
+}
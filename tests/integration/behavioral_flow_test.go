@@ -29,10 +29,12 @@ var waypointImageMap = map[int]string{
 //
 //nolint:maintidx,gocognit,gocyclo,cyclop // integration test: sequential steps require higher complexity
 func TestFullAPIBehavioralFlow(t *testing.T) {
+	isolate(t, isolationParallel, labelSmoke)
+
 	// ------------------------------------------------------------------ //
 	// Step 1: Create anonymous user                                        //
 	// ------------------------------------------------------------------ //
-	t.Log("Step 1: Create anonymous user")
+	step(t, "Step 1: Create anonymous user")
 
 	userID, authToken, anonRefreshToken := createAnonymousUser(t)
 
@@ -46,6 +48,10 @@ func TestFullAPIBehavioralFlow(t *testing.T) {
 	)
 	step1Body := decodeJSON(t, step1Resp)
 
+	extraUserID, _ := step1Body["user_id"].(string)
+	extraToken, _ := step1Body["access_token"].(string)
+	trackUser(t, extraUserID, extraToken)
+
 	assert.NotEmpty(t, step1Body["access_token_expires_at"],
 		"Step 1: access_token_expires_at must not be empty",
 	)
@@ -56,7 +62,7 @@ func TestFullAPIBehavioralFlow(t *testing.T) {
 	// ------------------------------------------------------------------ //
 	// Step 2: Get anonymous user                                           //
 	// ------------------------------------------------------------------ //
-	t.Log("Step 2: Get anonymous user")
+	step(t, "Step 2: Get anonymous user")
 
 	step2Resp := doRequest(
 		t,
@@ -85,7 +91,7 @@ func TestFullAPIBehavioralFlow(t *testing.T) {
 	// ------------------------------------------------------------------ //
 	// Step 3: Refresh JWT token                                            //
 	// ------------------------------------------------------------------ //
-	t.Log("Step 3: Refresh JWT token")
+	step(t, "Step 3: Refresh JWT token")
 
 	step3Resp := doRequest(
 		t,
@@ -116,7 +122,7 @@ func TestFullAPIBehavioralFlow(t *testing.T) {
 	// ------------------------------------------------------------------ //
 	// Step 4: Prepare route                                                //
 	// ------------------------------------------------------------------ //
-	t.Log("Step 4: Prepare route")
+	step(t, "Step 4: Prepare route")
 
 	routeID := prepareRoute(t, authToken)
 
@@ -130,6 +136,9 @@ func TestFullAPIBehavioralFlow(t *testing.T) {
 	)
 	step4Body := decodeJSON(t, step4Resp)
 
+	extraRouteID, _ := step4Body["route_id"].(string)
+	trackRoute(t, extraRouteID, authToken)
+
 	assert.NotEmpty(t, step4Body["prepared_at"],
 		"Step 4: prepared_at must not be empty",
 	)
@@ -141,7 +150,7 @@ func TestFullAPIBehavioralFlow(t *testing.T) {
 	// ------------------------------------------------------------------ //
 	// Step 5: Create route with 3 waypoints                               //
 	// ------------------------------------------------------------------ //
-	t.Log("Step 5: Create route with 3 waypoints")
+	step(t, "Step 5: Create route with 3 waypoints")
 
 	createBody := map[string]any{
 		"address":        "456 Behavioral Test Ave, Test City",
@@ -243,6 +252,7 @@ func TestFullAPIBehavioralFlow(t *testing.T) {
 	validPositions := map[int]bool{0: true, 1: true, 2: true}
 
 	for i, entry := range step5.PresignedURLs {
+		trackImage(t, entry.ImageID, routeID)
 		assert.NotEmptyf(t, entry.ImageID,
 			"Step 5: presigned_urls[%d].image_id must not be empty", i,
 		)
@@ -272,7 +282,7 @@ func TestFullAPIBehavioralFlow(t *testing.T) {
 	// ------------------------------------------------------------------ //
 	// Step 6: Upload images to gateway via Authorization header           //
 	// ------------------------------------------------------------------ //
-	t.Log("Step 6: Upload images to gateway via Authorization header")
+	step(t, "Step 6: Upload images to gateway via Authorization header")
 
 	for _, entry := range step5.PresignedURLs {
 		imgFile, hasImage := waypointImageMap[entry.Position]
@@ -349,7 +359,7 @@ func TestFullAPIBehavioralFlow(t *testing.T) {
 	// ------------------------------------------------------------------ //
 	// Step 7: Wait for route to reach ready status via SSE stream         //
 	// ------------------------------------------------------------------ //
-	t.Log("Step 7: Wait for route to reach ready status via SSE stream")
+	step(t, "Step 7: Wait for route to reach ready status via SSE stream")
 
 	// 7a. Start SSE connection in background goroutine.
 	sseURL := fmt.Sprintf(
@@ -425,7 +435,7 @@ func TestFullAPIBehavioralFlow(t *testing.T) {
 	defer readCancel()
 
 	events := make(chan SSEEvent, 100)
-	go readSSEEvents(readCtx, sseResp.Body, events)
+	go readSSEEvents(reportContext(readCtx, t), sseResp.Body, events)
 
 	seenEventTypes := make(map[string]bool)
 	eventDeadline := time.After(55 * time.Second)
@@ -500,7 +510,7 @@ eventLoop:
 	// ------------------------------------------------------------------ //
 	// Step 8: Publish route (READY → PUBLISHED)                           //
 	// ------------------------------------------------------------------ //
-	t.Log("Step 8: Publish route")
+	step(t, "Step 8: Publish route")
 
 	step8Resp := doRequest(
 		t,
@@ -533,7 +543,7 @@ eventLoop:
 	// ------------------------------------------------------------------ //
 	// Step 9: Get route with images and verify marker coordinates         //
 	// ------------------------------------------------------------------ //
-	t.Log("Step 9: Get route with images and verify marker coordinates")
+	step(t, "Step 9: Get route with images and verify marker coordinates")
 
 	step9Resp := doRequest(
 		t,
@@ -612,6 +622,13 @@ eventLoop:
 			i,
 		)
 
+		if navURL, _ := wp["navigation_image_url"].(string); navURL != "" {
+			assertNoIdentifyingMetadata(
+				t, downloadURL(t, navURL),
+				fmt.Sprintf("Step 9: waypoints[%d]", i),
+			)
+		}
+
 		posFloat, _ := wp["position"].(float64)
 		pos := int(posFloat)
 
@@ -633,7 +650,7 @@ eventLoop:
 	// ------------------------------------------------------------------ //
 	// Step 10: List routes — verify route appears                         //
 	// ------------------------------------------------------------------ //
-	t.Log("Step 10: List routes — verify route appears")
+	step(t, "Step 10: List routes — verify route appears")
 
 	step10Resp := doRequest(
 		t,
@@ -693,7 +710,7 @@ eventLoop:
 	// ------------------------------------------------------------------ //
 	// Step 11: Update route metadata                                      //
 	// ------------------------------------------------------------------ //
-	t.Log("Step 11: Update route metadata")
+	step(t, "Step 11: Update route metadata")
 
 	step11MetaResp := doRequest(
 		t,
@@ -751,7 +768,7 @@ eventLoop:
 	// ------------------------------------------------------------------ //
 	// Step 12: Update waypoint                                            //
 	// ------------------------------------------------------------------ //
-	t.Log("Step 12: Update waypoint")
+	step(t, "Step 12: Update waypoint")
 
 	step12WpResp := doRequest(
 		t,
@@ -809,11 +826,11 @@ eventLoop:
 	// ------------------------------------------------------------------ //
 	// Step 13: Replace waypoint image (prepare + upload + async swap)     //
 	// ------------------------------------------------------------------ //
-	t.Log("Step 13: Replace waypoint image")
+	step(t, "Step 13: Replace waypoint image")
 
 	// 13a. Prepare — now includes marker coordinates (sent at prepare time,
 	// stored as pending fields, atomically swapped by Valkey consumer).
-	t.Log("Step 13a: Prepare image replacement (with markers)")
+	step(t, "Step 13a: Prepare image replacement (with markers)")
 
 	step13aResp := doRequest(
 		t,
@@ -863,7 +880,7 @@ eventLoop:
 	)
 
 	// 13b. Upload replacement image to gateway.
-	t.Log("Step 13b: Upload replacement image")
+	step(t, "Step 13b: Upload replacement image")
 
 	replacementImage := loadTestImage(t, "pexels-tuurt-2954405.jpg")
 
@@ -901,7 +918,7 @@ eventLoop:
 	// The gateway processes the image, publishes to Valkey image:result,
 	// and the API consumer atomically swaps the waypoint's image + markers.
 	// No client confirm call — the swap is fully automatic.
-	t.Log("Step 13c: Wait for async image swap via Valkey")
+	step(t, "Step 13c: Wait for async image swap via Valkey")
 
 	swapDeadline := time.Now().Add(15 * time.Second)
 	swapVerified := false
@@ -992,7 +1009,7 @@ eventLoop:
 	)
 
 	// 13d. Verify route stayed PUBLISHED throughout replacement.
-	t.Log("Step 13d: Verify route remains published after replacement")
+	step(t, "Step 13d: Verify route remains published after replacement")
 
 	step13dResp := doRequest(
 		t,
@@ -1024,7 +1041,7 @@ eventLoop:
 	// ------------------------------------------------------------------ //
 	// Step 14: Delete user (cascade: user → routes → images)              //
 	// ------------------------------------------------------------------ //
-	t.Log("Step 14: Delete anonymous user (triggers async cascade)")
+	step(t, "Step 14: Delete anonymous user (triggers async cascade)")
 
 	step14Resp := doRequest(
 		t,
@@ -1050,7 +1067,7 @@ eventLoop:
 	// ------------------------------------------------------------------ //
 	// Step 15: Verify cascade — route should be gone                      //
 	// ------------------------------------------------------------------ //
-	t.Log("Step 15: Verify route deleted by async cascade")
+	step(t, "Step 15: Verify route deleted by async cascade")
 
 	// The cascade is async via Watermill events, so poll until
 	// the route returns 404 (or timeout after 15s).
@@ -0,0 +1,92 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// createProcessedRoute creates a route with n generated waypoint images,
+// uploads them all and waits until the route is ready, so every image
+// has a processed object in MinIO and a done progress hash in Valkey.
+func createProcessedRoute(
+	t *testing.T,
+	authToken string,
+	n int,
+) string {
+	t.Helper()
+
+	payload := jpegBytes(t, 640, 480)
+	routeID := prepareRoute(t, authToken)
+
+	waypoints := make([]map[string]any, n)
+	for i := range waypoints {
+		waypoints[i] = buildWaypointBody(i, "cascade.jpg", len(payload))
+	}
+
+	created := createRouteWithWaypointBodies(
+		t, authToken, routeID, waypoints,
+	)
+	require.Len(t, created.PresignedURLs, n)
+
+	for _, upload := range created.PresignedURLs {
+		resp := uploadToGateway(
+			t, upload.UploadURL, upload.UploadToken, payload,
+		)
+		resp.Body.Close()
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	}
+
+	waitForRouteReady(t, routeID, authToken, 60*time.Second)
+
+	return routeID
+}
+
+// TestCascadeDeletion_Route deletes routes in different lifecycle
+// states and verifies the section 9.4 cascade removes every image row,
+// object version and Valkey key they referenced.
+func TestCascadeDeletion_Route(t *testing.T) {
+	isolate(t, isolationParallel)
+
+	t.Run("Processed", func(t *testing.T) {
+		_, token, _ := createAnonymousUser(t)
+		routeID := createProcessedRoute(t, token, 3)
+
+		deleteRouteVerified(t, routeID, token)
+	})
+
+	t.Run("PendingNeverUploaded", func(t *testing.T) {
+		_, token, _ := createAnonymousUser(t)
+		routeID := prepareRoute(t, token)
+		createRouteWithWaypoints(t, token, routeID, defaultTestImages)
+
+		deleteRouteVerified(t, routeID, token)
+	})
+
+	t.Run("Published", func(t *testing.T) {
+		_, token, _ := createAnonymousUser(t)
+		routeID := createProcessedRoute(t, token, 2)
+		publishRoute(t, routeID, token)
+
+		deleteRouteVerified(t, routeID, token)
+	})
+}
+
+// TestCascadeDeletion_AnonymousUser deletes a user owning a processed
+// and a pending route and verifies the user → route → image cascade.
+func TestCascadeDeletion_AnonymousUser(t *testing.T) {
+	isolate(t, isolationParallel)
+
+	userID, token, _ := createAnonymousUser(t)
+
+	processed := createProcessedRoute(t, token, 2)
+
+	pending := prepareRoute(t, token)
+	createRouteWithWaypoints(t, token, pending, defaultTestImages[:1])
+
+	deleteUserVerified(t, userID, token, processed, pending)
+}
@@ -0,0 +1,389 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+	valkeygo "github.com/valkey-io/valkey-go"
+	"github.com/yoseforb/follow-pkg/valkey"
+)
+
+// imageStorageKeyPrefix is the object-key prefix for all images
+// (images/{id}.jpg before processing, images/{id}.webp after).
+const imageStorageKeyPrefix = "images/"
+
+// defaultCascadeTimeout bounds how long a deletion cascade may take
+// before the verification fails. Handlers run on the in-process event
+// bus, so a healthy cascade finishes in well under a second.
+const defaultCascadeTimeout = 30 * time.Second
+
+// cascadeTarget is everything a deletion is expected to remove.
+type cascadeTarget struct {
+	// UserID is set when the deletion removes a user.
+	UserID   string
+	RouteIDs []string
+	ImageIDs []string
+}
+
+// cascadeVerifier checks Postgres, MinIO and Valkey for the remains of
+// a cascadeTarget.
+type cascadeVerifier struct {
+	db     *dbInspector
+	store  *minio.Client
+	bucket string
+	vc     valkeygo.Client
+}
+
+// newCascadeVerifier connects to the three stores a cascade touches.
+func newCascadeVerifier(t *testing.T) *cascadeVerifier {
+	t.Helper()
+
+	cfg := minioConfigFromEnv()
+
+	store, err := newMinioClient(cfg)
+	require.NoError(t, err, "newCascadeVerifier: minio client")
+
+	return &cascadeVerifier{
+		db:     newDBInspector(t),
+		store:  store,
+		bucket: cfg.Bucket,
+		vc:     newValkeyClient(t),
+	}
+}
+
+// routeCascadeTarget reads routeID and returns it together with every
+// image its waypoints reference, including pending replacements. Call
+// it before deleting the route.
+func routeCascadeTarget(
+	t *testing.T,
+	routeID string,
+	authToken string,
+) cascadeTarget {
+	t.Helper()
+
+	resp := doRequest(
+		t, http.MethodGet,
+		apiURL+"/api/v1/routes/"+routeID+"?include_images=true",
+		nil, authToken,
+	)
+	require.Equal(t, http.StatusOK, resp.StatusCode,
+		"routeCascadeTarget: GET route %s", routeID,
+	)
+
+	body := decodeJSON(t, resp)
+	waypoints, _ := body["waypoints"].([]any)
+
+	target := cascadeTarget{RouteIDs: []string{routeID}}
+
+	for _, raw := range waypoints {
+		wp, _ := raw.(map[string]any)
+		for _, field := range []string{
+			"image_id", "pending_replacement_image_id",
+		} {
+			if id, _ := wp[field].(string); id != "" {
+				target.ImageIDs = append(target.ImageIDs, id)
+			}
+		}
+	}
+
+	return target
+}
+
+// merge folds other into c.
+func (c *cascadeTarget) merge(other cascadeTarget) {
+	c.RouteIDs = append(c.RouteIDs, other.RouteIDs...)
+	c.ImageIDs = append(c.ImageIDs, other.ImageIDs...)
+}
+
+// deleteRouteVerified deletes routeID and waits for its cascade to
+// finish, returning the measured cascade window.
+func deleteRouteVerified(
+	t *testing.T,
+	routeID string,
+	authToken string,
+) time.Duration {
+	t.Helper()
+
+	target := routeCascadeTarget(t, routeID, authToken)
+	start := time.Now()
+
+	resp := doRequest(
+		t, http.MethodDelete, apiURL+"/api/v1/routes/"+routeID,
+		nil, authToken,
+	)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode,
+		"deleteRouteVerified: DELETE route %s", routeID,
+	)
+
+	return waitForCascade(t, "route", target, start, defaultCascadeTimeout)
+}
+
+// deleteUserVerified deletes an anonymous user and waits for the
+// cascade through all of routeIDs, returning the cascade window.
+func deleteUserVerified(
+	t *testing.T,
+	userID string,
+	authToken string,
+	routeIDs ...string,
+) time.Duration {
+	t.Helper()
+
+	target := cascadeTarget{UserID: userID}
+	for _, routeID := range routeIDs {
+		target.merge(routeCascadeTarget(t, routeID, authToken))
+	}
+
+	start := time.Now()
+
+	resp := doRequest(
+		t, http.MethodDelete, apiURL+"/api/v1/users/anonymous/"+userID,
+		nil, authToken,
+	)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode,
+		"deleteUserVerified: DELETE user %s", userID,
+	)
+
+	return waitForCascade(t, "user", target, start, defaultCascadeTimeout)
+}
+
+// waitForCascade polls until nothing of target is left in any store,
+// measured from start (the moment the deletion was issued). The window
+// is logged and recorded under kind for the end-of-suite summary.
+// Fails the test listing the leftovers if timeout elapses first.
+func waitForCascade(
+	t *testing.T,
+	kind string,
+	target cascadeTarget,
+	start time.Time,
+	timeout time.Duration,
+) time.Duration {
+	t.Helper()
+
+	const pollInterval = 100 * time.Millisecond
+
+	v := newCascadeVerifier(t)
+	ctx := context.Background()
+	deadline := start.Add(timeout)
+
+	for {
+		leftovers := v.leftovers(ctx, target)
+		if len(leftovers) == 0 {
+			window := time.Since(start)
+			recordCascadeWindow(kind, window)
+			t.Logf(
+				"%s cascade: %d route(s), %d image(s) cleared in %s",
+				kind, len(target.RouteIDs), len(target.ImageIDs), window,
+			)
+
+			return window
+		}
+
+		if time.Now().After(deadline) {
+			require.Failf(t, "cascade incomplete",
+				"%s cascade still has %d leftover(s) after %s:\n%s",
+				kind, len(leftovers), timeout,
+				formatLeftovers(leftovers),
+			)
+
+			return 0
+		}
+
+		time.Sleep(pollInterval)
+	}
+}
+
+// leftovers returns a description of everything of target that still
+// exists. Store errors are reported as leftovers so they cannot pass
+// silently.
+func (v *cascadeVerifier) leftovers(
+	ctx context.Context,
+	target cascadeTarget,
+) []string {
+	var out []string
+
+	out = append(out, v.postgresLeftovers(ctx, target)...)
+
+	for _, imageID := range target.ImageIDs {
+		out = append(out, v.objectLeftovers(ctx, imageID)...)
+		out = append(out, v.valkeyLeftovers(ctx, imageID)...)
+	}
+
+	return out
+}
+
+// cascadeQuery counts the rows of table whose column is one of ids.
+type cascadeQuery struct {
+	table  string
+	column string
+	ids    []string
+}
+
+// postgresLeftovers counts rows that reference the target.
+func (v *cascadeVerifier) postgresLeftovers(
+	ctx context.Context,
+	target cascadeTarget,
+) []string {
+	queries := []cascadeQuery{
+		{tableRoutes, "id", target.RouteIDs},
+		{tableWaypoints, "route_id", target.RouteIDs},
+		{tableImages, "id", target.ImageIDs},
+	}
+
+	if target.UserID != "" {
+		queries = append(queries, cascadeQuery{
+			tableAnonymousUsers, "id", []string{target.UserID},
+		})
+	}
+
+	var out []string
+
+	for _, q := range queries {
+		if len(q.ids) == 0 {
+			continue
+		}
+
+		sql := fmt.Sprintf(
+			"SELECT count(*) FROM %s WHERE %s = ANY($1::uuid[])",
+			q.table, q.column,
+		)
+
+		var n int
+
+		err := v.db.queryRow(ctx, sql, q.ids).Scan(&n)
+
+		switch {
+		case err != nil:
+			out = append(out, fmt.Sprintf("postgres %s: %v", q.table, err))
+		case n > 0:
+			out = append(out,
+				fmt.Sprintf("postgres %s: %d row(s)", q.table, n),
+			)
+		}
+	}
+
+	return out
+}
+
+// objectLeftovers lists every version (and delete marker) stored under
+// the image's key prefix. A versioned bucket keeps old versions after a
+// plain DeleteObject, so only an empty version list counts as gone.
+func (v *cascadeVerifier) objectLeftovers(
+	ctx context.Context,
+	imageID string,
+) []string {
+	versions, err := listObjectVersions(
+		ctx, v.store, v.bucket, imageStorageKeyPrefix+imageID,
+	)
+	if err != nil {
+		return []string{fmt.Sprintf("minio %s: %v", imageID, err)}
+	}
+
+	out := make([]string, 0, len(versions))
+
+	for _, obj := range versions {
+		what := "version"
+		if obj.IsDeleteMarker {
+			what = "delete marker"
+		}
+
+		out = append(out, fmt.Sprintf(
+			"minio %s %s %s", obj.Key, what, obj.VersionID,
+		))
+	}
+
+	return out
+}
+
+// valkeyLeftovers checks the image's progress hash and upload guard.
+// The progress hash must be deleted (ImageDeletedHandler removes it);
+// the upload guard is never deleted explicitly, so it passes as long
+// as it carries a TTL and will expire on its own.
+func (v *cascadeVerifier) valkeyLeftovers(
+	ctx context.Context,
+	imageID string,
+) []string {
+	keys := []struct {
+		key         string
+		ttlIsEnough bool
+	}{
+		{imageStatusKey(imageID), false},
+		{valkey.KeyPrefixImageUpload + ":" + imageID, true},
+	}
+
+	var out []string
+
+	for _, k := range keys {
+		ttl, err := v.vc.Do(
+			ctx, v.vc.B().Pttl().Key(k.key).Build(),
+		).AsInt64()
+
+		switch {
+		case err != nil:
+			out = append(out, fmt.Sprintf("valkey %s: %v", k.key, err))
+		case ttl == -2:
+			// Key does not exist.
+		case ttl > 0 && k.ttlIsEnough:
+			// Expiring on its own.
+		case ttl == -1:
+			out = append(out, fmt.Sprintf("valkey %s: no TTL", k.key))
+		default:
+			out = append(out, fmt.Sprintf(
+				"valkey %s: expires in %dms", k.key, ttl,
+			))
+		}
+	}
+
+	return out
+}
+
+// formatLeftovers renders leftovers one per line.
+func formatLeftovers(leftovers []string) string {
+	return "  - " + strings.Join(leftovers, "\n  - ")
+}
+
+var (
+	cascadeWindowsMu sync.Mutex
+	cascadeWindows   = map[string][]time.Duration{}
+)
+
+// recordCascadeWindow stores one measured cascade window for the
+// end-of-suite summary.
+func recordCascadeWindow(kind string, d time.Duration) {
+	cascadeWindowsMu.Lock()
+	defer cascadeWindowsMu.Unlock()
+
+	cascadeWindows[kind] = append(cascadeWindows[kind], d)
+}
+
+// reportCascadeWindows logs min/median/max of the cascade windows
+// measured during the run, per deletion kind.
+func reportCascadeWindows() {
+	cascadeWindowsMu.Lock()
+	defer cascadeWindowsMu.Unlock()
+
+	for _, kind := range slices.Sorted(maps.Keys(cascadeWindows)) {
+		sorted := slices.Sorted(slices.Values(cascadeWindows[kind]))
+
+		log.Info().
+			Str("kind", kind).
+			Int("samples", len(sorted)).
+			Dur("min", sorted[0]).
+			Dur("median", sorted[len(sorted)/2]).
+			Dur("max", sorted[len(sorted)-1]).
+			Msg("cascade deletion window")
+	}
+}
@@ -0,0 +1,238 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoseforb/follow-pkg/valkey"
+)
+
+// TestDBInspector_WriteGuard proves the inspector cannot modify the
+// database: the client-side guard refuses write statements, and the
+// session itself is read-only for anything that slips past it.
+func TestDBInspector_WriteGuard(t *testing.T) {
+	isolate(t, isolationParallel)
+
+	cases := []struct {
+		sql     string
+		allowed bool
+	}{
+		{"SELECT 1", true},
+		{"  select count(*) from route.routes;", true},
+		{"WITH r AS (SELECT id FROM route.routes) SELECT * FROM r", true},
+		{"SHOW default_transaction_read_only", true},
+		{"SELECT deleted_at FROM route.routes", true},
+		{"INSERT INTO route.routes DEFAULT VALUES", false},
+		{"update images.images set status = 'x'", false},
+		{"DELETE FROM route.waypoints", false},
+		{"TRUNCATE route.routes", false},
+		{"SELECT 1; DROP TABLE route.routes", false},
+		{"WITH d AS (DELETE FROM route.routes RETURNING id) SELECT 1", false},
+		{"CREATE TABLE x (id int)", false},
+		{"", false},
+	}
+
+	for _, tc := range cases {
+		err := guardReadOnly(tc.sql)
+		if tc.allowed {
+			assert.NoErrorf(t, err, "guard must allow %q", tc.sql)
+		} else {
+			assert.Errorf(t, err, "guard must reject %q", tc.sql)
+		}
+	}
+
+	in := newDBInspector(t)
+	ctx := context.Background()
+
+	var readOnly string
+
+	err := in.queryRow(ctx, "SHOW default_transaction_read_only").
+		Scan(&readOnly)
+	require.NoError(t, err)
+	assert.Equal(t, "on", readOnly,
+		"inspector sessions must default to read-only transactions",
+	)
+
+	// Bypass the client guard: the server must still refuse.
+	_, err = in.pool.Exec(ctx, "CREATE TEMP TABLE inspector_guard (x int)")
+	require.Error(t, err, "read-only session must refuse DDL")
+	assert.Contains(t, err.Error(), "read-only")
+}
+
+// TestDBState_ProcessedRouteMatchesAPI checks that the persisted route,
+// waypoints and images agree with what GET /routes/{id} reports once
+// processing has finished.
+func TestDBState_ProcessedRouteMatchesAPI(t *testing.T) {
+	isolate(t, isolationParallel)
+
+	_, token, _ := createAnonymousUser(t)
+	routeID := createProcessedRoute(t, token, 2)
+
+	resp := doRequest(
+		t, http.MethodGet,
+		apiURL+"/api/v1/routes/"+routeID+"?include_images=true",
+		nil, token,
+	)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body := decodeJSON(t, resp)
+	apiRoute, _ := body["route"].(map[string]any)
+	require.NotNil(t, apiRoute, "GET route must return a route object")
+
+	in := newDBInspector(t)
+
+	row := in.route(t, routeID)
+	require.NotNil(t, row, "route row must exist")
+	assert.Equal(t, apiRoute["route_status"], row.RouteStatus)
+	assert.Nil(t, row.DeletedAt, "live route must not be soft-deleted")
+
+	if v, ok := apiRoute["version"].(float64); ok {
+		assert.Equal(t, int(v), row.Version,
+			"version column must match the API",
+		)
+	}
+
+	waypoints := in.waypoints(t, routeID)
+	apiWaypoints, _ := body["waypoints"].([]any)
+	require.Len(t, waypoints, len(apiWaypoints),
+		"waypoint rows must match the API waypoint count",
+	)
+
+	apiImageByPosition := make(map[int]any, len(apiWaypoints))
+	for _, raw := range apiWaypoints {
+		apiWP, _ := raw.(map[string]any)
+		pos, _ := apiWP["position"].(float64)
+		apiImageByPosition[int(pos)] = apiWP["image_id"]
+	}
+
+	for i, wp := range waypoints {
+		assert.Equalf(t, apiImageByPosition[wp.Position], wp.ImageID,
+			"waypoint %d image_id", i,
+		)
+		assert.Nilf(t, wp.PendingReplacementImageID,
+			"waypoint %d must have no pending replacement", i,
+		)
+
+		img := in.image(t, wp.ImageID)
+		require.NotNilf(t, img, "image row %s must exist", wp.ImageID)
+		assert.Equal(t, "processed", img.Status)
+		assert.Equal(t, "image/webp", img.ContentType)
+		assert.Equal(t,
+			imageStorageKeyPrefix+wp.ImageID+".webp", img.StorageKey,
+		)
+		assert.NotEmpty(t, img.SHA256, "sha256 must be recorded")
+		assert.NotEmpty(t, img.ETag, "etag must be recorded")
+		assert.Positive(t, img.ProcessedWidth)
+		assert.Positive(t, img.ProcessedHeight)
+	}
+}
+
+// TestDBState_FailedUploadLeavesFailedImageRow uploads bytes the gateway
+// rejects during processing and checks the image row records the same
+// failure the result stream carried, rather than staying pending.
+func TestDBState_FailedUploadLeavesFailedImageRow(t *testing.T) {
+	isolate(t, isolationParallel)
+	shareState(t, stateImageResults)
+
+	_, token, _ := createAnonymousUser(t)
+	vc := newValkeyClient(t)
+
+	payload := invalidImageBytes()
+	routeID := prepareRoute(t, token)
+
+	created := createRouteWithWaypointBodies(
+		t, token, routeID,
+		[]map[string]any{
+			buildWaypointBody(0, "broken.jpg", len(payload)),
+		},
+	)
+	require.Len(t, created.PresignedURLs, 1)
+
+	upload := created.PresignedURLs[0]
+	startID := fmt.Sprintf("%d-0", time.Now().UnixMilli())
+
+	resp := uploadToGateway(t, upload.UploadURL, upload.UploadToken, payload)
+	resp.Body.Close()
+
+	require.Equal(t, http.StatusAccepted, resp.StatusCode,
+		"invalid bytes are rejected asynchronously, during validation",
+	)
+
+	result := waitForResultMessage(
+		t, vc, upload.ImageID, startID, 60*time.Second,
+	)
+	require.Equal(t,
+		valkey.ResultStatusFailed, result.Fields[valkey.ResultFieldStatus],
+	)
+
+	in := newDBInspector(t)
+
+	var img *dbImage
+
+	require.Eventually(t, func() bool {
+		img = in.image(t, upload.ImageID)
+		return img != nil && img.Status == "failed"
+	}, 15*time.Second, 200*time.Millisecond,
+		"image row must move to failed after the result is consumed",
+	)
+
+	assert.Equal(t,
+		result.Fields[valkey.ResultFieldErrorCode], img.ErrorCode,
+		"persisted error_code must match the result stream",
+	)
+	assert.Empty(t, img.SHA256, "failed image must not record a hash")
+}
+
+// TestDBState_CredentialsNotStoredInPlaintext registers a user and
+// checks that neither the email address nor the refresh token appears
+// verbatim in the user or session rows.
+func TestDBState_CredentialsNotStoredInPlaintext(t *testing.T) {
+	isolate(t, isolationParallel, labelSecurity)
+
+	userID, anonToken, _ := createAnonymousUser(t)
+	email := uniqueEmail()
+	_, _, refreshToken := registerAndConfirm(t, anonToken, email)
+	require.NotEmpty(t, refreshToken)
+
+	in := newDBInspector(t)
+
+	user := in.user(t, userID)
+	require.NotNil(t, user, "user row must exist")
+	assertNoPlaintext(t, "user row", user.Columns, email, testPassword)
+
+	sessions := in.sessions(t, userID)
+	require.NotEmpty(t, sessions, "registration must create a session")
+
+	for i, s := range sessions {
+		assertNoPlaintext(t,
+			fmt.Sprintf("session row %d", i), s.Columns, refreshToken,
+		)
+	}
+}
+
+// assertNoPlaintext fails if any column value contains one of secrets.
+func assertNoPlaintext(
+	t *testing.T,
+	label string,
+	columns map[string]any,
+	secrets ...string,
+) {
+	t.Helper()
+
+	for col, val := range columns {
+		s := strings.ToLower(fmt.Sprint(val))
+		for _, secret := range secrets {
+			assert.NotContainsf(t, s, strings.ToLower(secret),
+				"%s column %q stores a secret in plaintext", label, col,
+			)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"html"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unresolvedPlaceholder matches template syntax and formatting errors
+// that should have been rendered away: Go template actions, their
+// "<no value>" for missing keys, ${var} and fmt's %!verb(...) noise.
+var unresolvedPlaceholder = regexp.MustCompile(
+	`\{\{|\}\}|\{%|%\}|\$\{|<no value>|%!\w`,
+)
+
+var (
+	hebrewLetter = regexp.MustCompile(`\p{Hebrew}`)
+	rtlDirection = regexp.MustCompile(`(?i)dir\s*=\s*["']?rtl`)
+	htmlNoise    = regexp.MustCompile(
+		`(?is)<(style|script)\b.*?</(style|script)>`,
+	)
+	htmlTag = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// emailLocale is a language the transactional emails are checked in.
+type emailLocale struct {
+	// AcceptLanguage is sent on every request of the flow.
+	AcceptLanguage string
+	RTL            bool
+}
+
+var emailLocales = map[string]emailLocale{
+	"English": {AcceptLanguage: "en"},
+	"Hebrew":  {AcceptLanguage: "he-IL,he;q=0.9", RTL: true},
+}
+
+// localizedRequest sends a JSON request with an Accept-Language
+// header.
+func localizedRequest(
+	t *testing.T,
+	method, url string,
+	body any,
+	authToken, acceptLanguage string,
+) *http.Response {
+	t.Helper()
+
+	req := jsonRequest(t, method, url, body, authToken)
+	req.Header.Set("Accept-Language", acceptLanguage)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err, "localizedRequest: %s %s", method, url)
+
+	return resp
+}
+
+// visibleText reduces an HTML body to the text a reader sees.
+func visibleText(body string) string {
+	body = htmlNoise.ReplaceAllString(body, " ")
+	body = htmlTag.ReplaceAllString(body, " ")
+
+	return html.UnescapeString(body)
+}
+
+// distinctCodes returns the distinct six-digit codes in s.
+func distinctCodes(s string) []string {
+	codes := sixDigitCode.FindAllString(s, -1)
+	slices.Sort(codes)
+
+	return slices.Compact(codes)
+}
+
+// headerValue looks a header up case-insensitively.
+func headerValue(headers map[string][]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) && len(v) > 0 {
+			return v[0]
+		}
+	}
+
+	return ""
+}
+
+// checkTransactionalEmail runs the content checks every transactional
+// email must pass and returns the code it carries. subject is a
+// keyword the English subject must contain.
+func checkTransactionalEmail(
+	t *testing.T,
+	summary mailpitMessageSummary,
+	to string,
+	locale emailLocale,
+	subject *regexp.Regexp,
+) string {
+	t.Helper()
+
+	msg := getMessage(t, summary.ID)
+
+	// Envelope.
+	assert.Equal(t,
+		envOrDefault("SMTP_FROM", defaultSMTPFrom), msg.From.Address,
+		"From must be SMTP_FROM",
+	)
+	require.Len(t, msg.To, 1, "exactly one recipient")
+	assert.Equal(t, to, msg.To[0].Address)
+
+	headers := messageHeaders(t, summary.ID)
+	for _, name := range []string{"Message-ID", "Date", "MIME-Version"} {
+		assert.NotEmptyf(t, headerValue(headers, name), "%s header", name)
+	}
+
+	// Structure: one multipart/alternative holding a UTF-8 text part
+	// followed by a UTF-8 HTML part (clients show the last part they
+	// understand, so the richer one goes last).
+	tree := parseMIME(t, rawMessage(t, summary.ID))
+	alt, ok := tree.find("multipart/alternative")
+	require.Truef(t, ok, "no multipart/alternative part, top level is %s",
+		tree.MediaType,
+	)
+
+	var kinds []string
+	for _, c := range alt.Children {
+		kinds = append(kinds, c.MediaType)
+		assert.Truef(t, strings.EqualFold(c.Params["charset"], "utf-8"),
+			"%s part charset %q, want utf-8", c.MediaType, c.Params["charset"],
+		)
+	}
+
+	assert.Equal(t, []string{"text/plain", "text/html"}, kinds,
+		"multipart/alternative parts",
+	)
+	assert.Empty(t, msg.Attachments,
+		"transactional emails carry no attachments",
+	)
+
+	// Inline images (a logo) must be referenced by the HTML and
+	// actually present.
+	for _, part := range msg.Inline {
+		assert.Containsf(t, msg.HTML, "cid:"+part.ContentID,
+			"inline part %s is not used by the HTML", part.FileName,
+		)
+		assert.NotEmptyf(t, attachmentBytes(t, summary.ID, part.PartID),
+			"inline part %s is empty", part.FileName,
+		)
+	}
+
+	// Content.
+	require.NotEmpty(t, msg.Subject, "subject")
+	require.NotEmpty(t, msg.Text, "text part")
+	require.NotEmpty(t, msg.HTML, "HTML part")
+
+	for part, content := range map[string]string{
+		"subject": msg.Subject, "text": msg.Text, "HTML": msg.HTML,
+	} {
+		assert.Emptyf(t, unresolvedPlaceholder.FindAllString(content, -1),
+			"unresolved placeholders in the %s", part,
+		)
+	}
+
+	if locale.RTL {
+		assert.NotRegexpf(t, subject, msg.Subject,
+			"follow-api ignored Accept-Language %q and sent English mail",
+			locale.AcceptLanguage,
+		)
+		assert.Regexp(t, hebrewLetter, msg.Subject, "Hebrew subject")
+		assert.Regexp(t, hebrewLetter, msg.Text, "Hebrew text part")
+		assert.Regexp(t, rtlDirection, msg.HTML,
+			"the Hebrew HTML part must be laid out right to left",
+		)
+	} else {
+		assert.Regexp(t, subject, msg.Subject)
+		assert.NotRegexp(t, hebrewLetter, msg.Subject)
+		assert.NotRegexp(t, rtlDirection, msg.HTML)
+	}
+
+	// Both parts carry the same single code.
+	textCodes := distinctCodes(msg.Text)
+	htmlCodes := distinctCodes(visibleText(msg.HTML))
+	require.Len(t, textCodes, 1, "codes in the text part")
+	require.Equal(t, textCodes, htmlCodes,
+		"the HTML part must show the text part's code",
+	)
+
+	recordSecret(secretVerificationCode, textCodes[0])
+
+	return textCodes[0]
+}
+
+// TestTransactionalEmails walks one account through every email the
+// API sends — verification, resend, password reset and account
+// deletion — in each locale, and checks each message's envelope, MIME
+// structure, language and code.
+func TestTransactionalEmails(t *testing.T) {
+	isolate(t, isolationParallel, labelSlow)
+
+	for name, locale := range emailLocales {
+		t.Run(name, func(t *testing.T) {
+			testTransactionalEmails(t, locale)
+		})
+	}
+}
+
+func testTransactionalEmails(t *testing.T, locale emailLocale) {
+	lang := locale.AcceptLanguage
+	send := func(path string, body any, token string) int {
+		t.Helper()
+
+		resp := localizedRequest(t, http.MethodPost, apiURL+path,
+			body, token, lang,
+		)
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	_, anonToken, _ := createAnonymousUser(t)
+	email := uniqueEmail()
+	inbox := mailpitQuery{To: email}
+
+	var seen []string
+	next := func() mailpitMessageSummary {
+		t.Helper()
+
+		m := waitForMessage(t, inbox, seen...)
+		seen = append(seen, m.ID)
+
+		return m
+	}
+
+	verifySubject := regexp.MustCompile(`(?i)verif|confirm`)
+
+	require.Equal(t, http.StatusOK, send("/api/v1/auth/register",
+		map[string]any{"email": email, "password": testPassword},
+		anonToken,
+	))
+	first := next()
+
+	t.Run("Verification", func(t *testing.T) {
+		checkTransactionalEmail(t, first, email, locale, verifySubject)
+	})
+
+	// AUTH_RESEND_COOLDOWN=5s in the test stack.
+	time.Sleep(6 * time.Second)
+
+	require.Equal(t, http.StatusNoContent, send(
+		"/api/v1/auth/resend-verification", map[string]any{}, anonToken,
+	))
+	resent := next()
+
+	var code string
+
+	t.Run("Resend", func(t *testing.T) {
+		code = checkTransactionalEmail(t, resent, email, locale,
+			verifySubject,
+		)
+	})
+
+	if code == "" {
+		code = extractVerificationCode(t, resent.ID)
+	}
+
+	confirm := localizedRequest(t, http.MethodPost,
+		apiURL+"/api/v1/auth/confirm-registration",
+		map[string]any{"code": code}, anonToken, lang,
+	)
+	require.Equal(t, http.StatusOK, confirm.StatusCode)
+
+	regToken, _ := decodeJSON(t, confirm)["access_token"].(string)
+	require.NotEmpty(t, regToken)
+
+	require.Equal(t, http.StatusNoContent, send(
+		"/api/v1/auth/forgot-password", map[string]any{"email": email}, "",
+	))
+	reset := next()
+
+	t.Run("PasswordReset", func(t *testing.T) {
+		checkTransactionalEmail(t, reset, email, locale,
+			regexp.MustCompile(`(?i)password|reset`),
+		)
+	})
+
+	require.Equal(t, http.StatusNoContent, send(
+		"/api/v1/auth/request-account-deletion", map[string]any{}, regToken,
+	))
+	deletion := next()
+
+	t.Run("AccountDeletion", func(t *testing.T) {
+		checkTransactionalEmail(t, deletion, email, locale,
+			regexp.MustCompile(`(?i)delet`),
+		)
+	})
+}
@@ -0,0 +1,123 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// emailRetryTimeout bounds how long follow-api may take to get a
+// message through once the SMTP server recovers.
+const emailRetryTimeout = 60 * time.Second
+
+// emailErrorsMetric counts failed deliveries; the "email delivery
+// failing" alert fires on its rate.
+const emailErrorsMetric = "follow_api_email_sent_total"
+
+// registerPending starts registration for a fresh email, which sends
+// the verification email, and returns the address and the status.
+func registerPending(t *testing.T) (email string, status int) {
+	t.Helper()
+
+	_, anonToken, _ := createAnonymousUser(t)
+	email = uniqueEmail()
+
+	resp := doRequest(t, http.MethodPost,
+		apiURL+"/api/v1/auth/register",
+		map[string]any{"email": email, "password": testPassword},
+		anonToken,
+	)
+	resp.Body.Close()
+
+	return email, resp.StatusCode
+}
+
+// TestEmailDelivery_RetriesTransientFailures injects SMTP failures a
+// mail server recovers from and checks the verification email still
+// arrives, through a fresh session after each failed one.
+func TestEmailDelivery_RetriesTransientFailures(t *testing.T) {
+	isolate(t, isolationSequential, labelSlow, labelMailFaults)
+
+	cases := []struct {
+		Name  string
+		Fault smtpFault
+	}{
+		{"ServiceUnavailableGreeting", smtpFault{
+			Stage: smtpStageConnect, Code: 421, Sessions: 1,
+		}},
+		{"TemporaryFailureAfterData", smtpFault{
+			Stage: smtpStageData, Code: 451, Sessions: 2,
+		}},
+		{"ConnectionDroppedAtRecipient", smtpFault{
+			Stage: smtpStageRcpt, Drop: true, Sessions: 1,
+		}},
+		// No failure, just a server slow to greet.
+		{"SlowGreeting", smtpFault{
+			Stage: smtpStageConnect, Delay: 5 * time.Second, Sessions: 1,
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			injectSMTPFault(t, tc.Fault)
+			sessionsBefore := smtpCapture.sessionCount()
+
+			email, status := registerPending(t)
+			require.Equal(t, http.StatusOK, status,
+				"register must not fail on a mail server hiccup",
+			)
+
+			start := time.Now()
+			waitForMessageWithin(t, mailpitQuery{To: email},
+				emailRetryTimeout,
+			)
+
+			sessions := smtpCapture.sessionCount() - sessionsBefore
+			t.Logf("delivered after %s over %d SMTP sessions",
+				time.Since(start).Round(time.Millisecond), sessions,
+			)
+
+			if tc.Fault.Code != 0 || tc.Fault.Drop {
+				assert.Greater(t, sessions, tc.Fault.Sessions,
+					"each failed attempt must be followed by a new one",
+				)
+			}
+		})
+	}
+}
+
+// TestEmailDelivery_PermanentFailureIsCounted rejects every recipient
+// with 550: nothing may be delivered, and the failures must show up in
+// the error series of the email metric the alert watches.
+func TestEmailDelivery_PermanentFailureIsCounted(t *testing.T) {
+	isolate(t, isolationSequential, labelSlow, labelMailFaults)
+
+	injectSMTPFault(t, smtpFault{Stage: smtpStageRcpt, Code: 550})
+
+	errorsBefore := sumMetric(scrapeMetrics(t, apiURL),
+		emailErrorsMetric, `status="error"`,
+	)
+
+	email, status := registerPending(t)
+	assert.Less(t, status, http.StatusInternalServerError,
+		"a rejected recipient is not a server error",
+	)
+
+	noEmailWithin(t, email, 3*time.Second)
+
+	require.Eventually(t, func() bool {
+		failed := sumMetric(scrapeMetrics(t, apiURL),
+			emailErrorsMetric, `status="error"`,
+		)
+
+		return failed > errorsBefore
+	}, emailRetryTimeout, time.Second,
+		"%s{status=\"error\"} must grow when delivery fails",
+		emailErrorsMetric,
+	)
+}
@@ -20,6 +20,8 @@ import (
 func TestValkeyFailurePropagation_InvalidImageRejectedByGateway(
 	t *testing.T,
 ) {
+	isolate(t, isolationParallel)
+
 	_, token, _ := createAnonymousUser(t)
 	routeID := prepareRoute(t, token)
 	route := createRouteWithWaypoints(t, token, routeID, defaultTestImages)
@@ -60,6 +62,9 @@ func TestValkeyFailurePropagation_InvalidImageRejectedByGateway(
 // is uploaded. Uses XRANGE to scan the stream idempotently so the message is
 // never missed regardless of delivery ordering.
 func TestValkeyFailurePropagation_FailureStreamMessage(t *testing.T) {
+	isolate(t, isolationParallel)
+	shareState(t, stateImageResults)
+
 	_, token, _ := createAnonymousUser(t)
 	routeID := prepareRoute(t, token)
 	route := createRouteWithWaypoints(t, token, routeID, defaultTestImages)
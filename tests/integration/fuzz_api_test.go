@@ -0,0 +1,323 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The fuzz targets below send mutated JSON bodies to the running API.
+// Every input must get a timely, non-5xx answer whose body (if any) is
+// JSON, and a follow-up GET must find the fixture in a consistent state.
+// Without -fuzz only the seeds run, as ordinary tests:
+//
+//	go test -tags=integration -run='^$' -fuzz=FuzzLogin -fuzztime=1m .
+
+// FuzzCreateWaypoints mutates the create-waypoints body. Each input gets
+// a freshly prepared route, which must hold exactly the requested
+// waypoints if the call succeeded and none if it was rejected. The route
+// is deleted when the input ends: the API limits pending routes per
+// user, and every input shares the fixture user.
+func FuzzCreateWaypoints(f *testing.F) {
+	body := defaultRouteMetadata()
+	body["waypoints"] = []map[string]any{
+		buildWaypointBody(0, "fuzz.jpg", 1024),
+		buildWaypointBody(1, "fuzz.jpg", 2048),
+	}
+
+	addFuzzSeeds(f, body, map[string]any{
+		"waypoints": []map[string]any{
+			buildWaypointBody(0, "fuzz.jpg", 1024),
+		},
+	})
+
+	fixture := newFuzzFixture(f, buildFuzzUser)
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		fx := fixture.get(t)
+		routeID := prepareRoute(t, fx.Token)
+		t.Cleanup(func() { deleteRoute(t, routeID, fx.Token) })
+
+		status, _ := sendFuzzBody(t, http.MethodPost,
+			apiURL+"/api/v1/routes/"+routeID+"/create-waypoints",
+			raw, fx.Token,
+		)
+
+		resp := doRequest(t, http.MethodGet,
+			apiURL+"/api/v1/routes/"+routeID+"?include_images=true",
+			nil, fx.Token,
+		)
+
+		if status >= http.StatusBadRequest &&
+			resp.StatusCode == http.StatusNotFound {
+			// A prepared route with no waypoints may not be visible.
+			resp.Body.Close()
+			return
+		}
+
+		require.Equal(t, http.StatusOK, resp.StatusCode,
+			"route must stay readable after create-waypoints %d", status,
+		)
+
+		got, _ := decodeJSON(t, resp)["waypoints"].([]any)
+
+		if status >= http.StatusBadRequest {
+			assert.Emptyf(t, got,
+				"rejected create-waypoints (%d) left waypoints behind: %q",
+				status, raw,
+			)
+
+			return
+		}
+
+		var sent struct {
+			Waypoints []json.RawMessage `json:"waypoints"`
+		}
+
+		require.NoErrorf(t, json.Unmarshal(raw, &sent),
+			"create-waypoints accepted (%d) a body that is not an "+
+				"object: %q", status, raw,
+		)
+		assert.Lenf(t, got, len(sent.Waypoints),
+			"accepted create-waypoints stored a different waypoint "+
+				"count: %q", raw,
+		)
+	})
+}
+
+// FuzzUpdateRoute mutates the route update body. Whatever metadata an
+// input changes, the route's status and waypoints must not move.
+func FuzzUpdateRoute(f *testing.F) {
+	update := defaultRouteMetadata()
+	update["description"] = "Updated by fuzz seed"
+
+	addFuzzSeeds(f,
+		update,
+		map[string]any{"description": "authz matrix"},
+		map[string]any{
+			"address":       "789 Updated Test Blvd, New City",
+			"location_name": "Updated Test Location",
+			"start_point":   "New parking entrance",
+			"end_point":     "Updated destination, top floor",
+		},
+		map[string]any{"visibility": "public"},
+	)
+
+	fixture := newFuzzFixture(f, buildFuzzPublishedRoute)
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		fx := fixture.get(t)
+
+		sendFuzzBody(t, http.MethodPut,
+			apiURL+"/api/v1/routes/"+fx.RouteID,
+			raw, fx.Token,
+		)
+
+		after := snapshotRoute(t, fx.RouteID, fx.Token)
+		assert.Equal(t, fx.Baseline.Status, after.Status,
+			"route update changed the route status",
+		)
+		assert.Equal(t, fx.Baseline.Waypoints, after.Waypoints,
+			"route update changed the waypoints",
+		)
+	})
+}
+
+// FuzzUpdateWaypoint mutates the waypoint update body. The waypoint may
+// change, but it must keep its image and its marker inside the image.
+func FuzzUpdateWaypoint(f *testing.F) {
+	waypoint := buildWaypointBody(0, "fuzz.jpg", 1024)
+	delete(waypoint, "image_metadata")
+
+	addFuzzSeeds(f,
+		waypoint,
+		map[string]any{"description": "authz matrix"},
+		map[string]any{"marker_x": 0.25, "marker_y": 0.75},
+		map[string]any{"image_id": "{image_id}"},
+	)
+
+	fixture := newFuzzFixture(f, buildFuzzPublishedRoute)
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		fx := fixture.get(t)
+
+		sendFuzzBody(t, http.MethodPut,
+			apiURL+"/api/v1/routes/"+fx.RouteID+
+				"/waypoints/"+fx.WaypointID,
+			fx.expand(raw), fx.Token,
+		)
+
+		after := snapshotRoute(t, fx.RouteID, fx.Token)
+		assert.Equal(t, fx.Baseline.Status, after.Status,
+			"waypoint update changed the route status",
+		)
+		require.Len(t, after.Waypoints, len(fx.Baseline.Waypoints),
+			"waypoint update changed the waypoint count",
+		)
+
+		wp := after.Waypoints[0]
+		assert.Equal(t, fx.WaypointID, wp.WaypointID)
+		assert.Equal(t, fx.ImageID, wp.ImageID,
+			"waypoint update swapped the image",
+		)
+		assert.Truef(t,
+			wp.MarkerX >= 0 && wp.MarkerX <= 1 &&
+				wp.MarkerY >= 0 && wp.MarkerY <= 1,
+			"marker (%v, %v) stored outside the image: %q",
+			wp.MarkerX, wp.MarkerY, raw,
+		)
+	})
+}
+
+// FuzzSyncRoutes mutates the sync body. Sync is read-only, so the route
+// must be exactly as the fixture left it.
+func FuzzSyncRoutes(f *testing.F) {
+	addFuzzSeeds(f,
+		map[string]any{"routes": []SyncRouteSpec{
+			{RouteID: "{route_id}", Version: 0},
+		}},
+		map[string]any{"routes": []SyncRouteSpec{
+			{RouteID: "{route_id}", Version: 1},
+			{RouteID: "00000000-0000-0000-0000-000000000000", Version: 1},
+		}},
+		map[string]any{"routes": []SyncRouteSpec{}},
+	)
+
+	fixture := newFuzzFixture(f, buildFuzzPublishedRoute)
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		fx := fixture.get(t)
+
+		sendFuzzBody(t, http.MethodPost, apiURL+"/api/v1/routes/sync",
+			fx.expand(raw), fx.Token,
+		)
+
+		assert.Equal(t, fx.Baseline,
+			snapshotRoute(t, fx.RouteID, fx.Token),
+			"sync changed the route",
+		)
+	})
+}
+
+// FuzzApplyRevision mutates the revision apply body. Apply stages
+// changes on the revision only; the published route must be untouched
+// until commit.
+func FuzzApplyRevision(f *testing.F) {
+	apply := defaultRouteMetadata()
+	apply["route_id"] = "{route_id}"
+	apply["revision_id"] = "{revision_id}"
+	apply["waypoints"] = []map[string]any{
+		buildExistingImageWaypoint(0, "{image_id}"),
+	}
+
+	addFuzzSeeds(f,
+		apply,
+		map[string]any{
+			"route_id":    "{route_id}",
+			"revision_id": "{revision_id}",
+			"waypoints": []map[string]any{
+				buildExistingImageWaypoint(0, "{image_id}"),
+				buildWaypointBody(1, "fuzz.jpg", 1024),
+			},
+		},
+	)
+
+	fixture := newFuzzFixture(f, buildFuzzRevision)
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		fx := fixture.get(t)
+
+		sendFuzzBody(t, http.MethodPost,
+			apiURL+"/api/v1/routes/"+fx.RouteID+
+				"/revisions/"+fx.RevisionID+"/apply",
+			fx.expand(raw), fx.Token,
+		)
+
+		assert.Equal(t, fx.Baseline,
+			snapshotRoute(t, fx.RouteID, fx.Token),
+			"apply changed the published route before commit",
+		)
+	})
+}
+
+// FuzzRegister mutates the register body. Each input registers a fresh
+// anonymous user, and {email} in it becomes a fresh address, so inputs
+// reach the handler's validation and success paths rather than the
+// conflict a reused user or address would hit. The anonymous session
+// must keep working either way.
+func FuzzRegister(f *testing.F) {
+	addFuzzSeeds(f,
+		map[string]any{
+			"email":    "{email}",
+			"password": testPassword,
+		},
+		map[string]any{
+			"email":        "{email}",
+			"password":     testPassword,
+			"display_name": "Integration Test User",
+		},
+		map[string]any{"email": "not-an-email", "password": "x"},
+	)
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		userID, token, _ := createAnonymousUser(t)
+
+		sendFuzzBody(t, http.MethodPost, apiURL+"/api/v1/auth/register",
+			bytes.ReplaceAll(raw, []byte("{email}"),
+				[]byte(uniqueEmail()),
+			),
+			token,
+		)
+
+		resp := doRequest(t, http.MethodGet,
+			apiURL+"/api/v1/users/anonymous/"+userID, nil, token,
+		)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode,
+			"register input broke the caller's session: %q", raw,
+		)
+	})
+}
+
+// FuzzLogin mutates the login body. No input may log anyone in by
+// accident or disturb an existing registered session.
+func FuzzLogin(f *testing.F) {
+	addFuzzSeeds(f,
+		map[string]any{
+			"email":    "fuzz-login@example.com",
+			"password": testPassword,
+		},
+		map[string]any{
+			"email":    "fuzz-login@example.com",
+			"password": "wrongpassword99",
+		},
+	)
+
+	fixture := newFuzzFixture(f, buildFuzzRegisteredUser)
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		fx := fixture.get(t)
+
+		status, body := sendFuzzBody(t, http.MethodPost,
+			apiURL+"/api/v1/auth/login", raw, "",
+		)
+		assert.NotEqualf(t, http.StatusOK, status,
+			"login with fuzzed credentials succeeded: %q -> %s",
+			raw, body,
+		)
+
+		resp := doRequest(t, http.MethodGet, apiURL+"/api/v1/routes",
+			nil, fx.Token,
+		)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode,
+			"login input broke an existing session: %q", raw,
+		)
+	})
+}
@@ -0,0 +1,316 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fuzzRequestTimeout bounds one fuzzed request. An API that has not
+// answered by then is reported as a hang.
+const fuzzRequestTimeout = 10 * time.Second
+
+// fuzzMalformedSeeds are structural edge cases added to every target
+// next to the valid bodies taken from the other suites.
+var fuzzMalformedSeeds = []string{
+	``,
+	`{}`,
+	`[]`,
+	`null`,
+	`"waypoints"`,
+	`{"waypoints":null}`,
+	`{"waypoints":[{}]}`,
+	`{"email":1e309}`,
+	`{"a":`,
+	"{\"description\":\"\\u0000\"}",
+}
+
+// fuzzFixture holds the resources one fuzz target reuses across every
+// input in a process. Helpers need a *testing.T, so the fixture is built
+// lazily by the first input and kept past that input's cleanup; the
+// target's f.Cleanup deletes it instead.
+type fuzzFixture struct {
+	UserID     string
+	Token      string
+	RouteID    string
+	WaypointID string
+	ImageID    string
+	RevisionID string
+
+	// Baseline is the route as the fixture left it, when there is one.
+	Baseline routeSnapshot
+
+	build func(t *testing.T, fx *fuzzFixture)
+	once  sync.Once
+	ready bool
+}
+
+// newFuzzFixture returns a fixture built by build on first use and
+// deleted when f finishes.
+func newFuzzFixture(
+	f *testing.F,
+	build func(t *testing.T, fx *fuzzFixture),
+) *fuzzFixture {
+	f.Helper()
+
+	fx := &fuzzFixture{build: build}
+	f.Cleanup(func() { fx.teardown(f) })
+
+	return fx
+}
+
+// get builds the fixture on the first call. Later inputs are skipped if
+// that build failed.
+func (fx *fuzzFixture) get(t *testing.T) *fuzzFixture {
+	t.Helper()
+
+	fx.once.Do(func() {
+		// Anything else this input creates belongs to the fixture
+		// user and goes with it in teardown.
+		keepResources(t)
+		fx.build(t, fx)
+		fx.ready = true
+	})
+
+	if !fx.ready {
+		t.Skip("fuzz fixture failed to build")
+	}
+
+	return fx
+}
+
+// teardown deletes the fixture route, then its user. Deleting the user
+// also removes any route an input created under it.
+func (fx *fuzzFixture) teardown(f *testing.F) {
+	if fx.Token == "" {
+		return
+	}
+
+	if fx.RouteID != "" {
+		fx.remove(f, apiURL+"/api/v1/routes/"+fx.RouteID)
+	}
+
+	if fx.UserID != "" {
+		fx.remove(f, apiURL+"/api/v1/users/anonymous/"+fx.UserID)
+	}
+}
+
+// remove deletes url as the fixture user, logging anything but success
+// or 404.
+func (fx *fuzzFixture) remove(f *testing.F, url string) {
+	status, _, err := apiCall(http.MethodDelete, url, nil, fx.Token)
+	if err != nil || (status >= http.StatusBadRequest &&
+		status != http.StatusNotFound) {
+		f.Logf("fuzz fixture: DELETE %s: status %d, err %v",
+			url, status, err,
+		)
+	}
+}
+
+// expand fills the {route_id}, {waypoint_id}, {image_id}, {revision_id}
+// and {user_id} placeholders seeds use for values only known once the
+// fixture exists. The fuzzer may mutate the placeholders too.
+func (fx *fuzzFixture) expand(raw []byte) []byte {
+	return []byte(strings.NewReplacer(
+		"{route_id}", fx.RouteID,
+		"{waypoint_id}", fx.WaypointID,
+		"{image_id}", fx.ImageID,
+		"{revision_id}", fx.RevisionID,
+		"{user_id}", fx.UserID,
+	).Replace(string(raw)))
+}
+
+// addFuzzSeeds adds each body, JSON-encoded, plus fuzzMalformedSeeds to
+// f's seed corpus.
+func addFuzzSeeds(f *testing.F, bodies ...any) {
+	f.Helper()
+
+	for _, body := range bodies {
+		raw, err := json.Marshal(body)
+		require.NoError(f, err, "addFuzzSeeds: marshal seed")
+
+		f.Add(raw)
+	}
+
+	for _, raw := range fuzzMalformedSeeds {
+		f.Add([]byte(raw))
+	}
+}
+
+// sendFuzzBody sends raw as a JSON request body and returns the status
+// and response body. It fails on a hang, a 5xx, or a non-empty body
+// that is not JSON.
+func sendFuzzBody(
+	t *testing.T,
+	method, url string,
+	raw []byte,
+	authToken string,
+) (int, []byte) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(raw))
+	require.NoError(t, err, "sendFuzzBody: new request")
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+authToken)
+	}
+
+	client := &http.Client{
+		Timeout: fuzzRequestTimeout,
+		Transport: secretScanning(
+			&http.Transport{DisableKeepAlives: true},
+		),
+	}
+
+	resp, err := client.Do(req)
+
+	var body []byte
+	if err == nil {
+		body, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	if isTimeout(err) {
+		t.Fatalf("%s %s hung: no answer within %s\nbody: %q",
+			method, url, fuzzRequestTimeout, raw,
+		)
+	}
+
+	require.NoErrorf(t, err, "%s %s: transport error", method, url)
+
+	require.Lessf(t, resp.StatusCode, http.StatusInternalServerError,
+		"%s %s: server error\nrequest: %q\nresponse: %s",
+		method, url, raw, body,
+	)
+
+	if len(bytes.TrimSpace(body)) > 0 {
+		require.Truef(t, json.Valid(body),
+			"%s %s: %d with a non-JSON body\nrequest: %q\nresponse: %q",
+			method, url, resp.StatusCode, raw, body,
+		)
+	}
+
+	return resp.StatusCode, body
+}
+
+// isTimeout reports whether err is a client timeout.
+func isTimeout(err error) bool {
+	var timeout interface{ Timeout() bool }
+
+	return errors.As(err, &timeout) && timeout.Timeout()
+}
+
+// snapshotWaypoint is the persistent part of a waypoint as GET route
+// returns it; presigned URLs change on every call and are left out.
+type snapshotWaypoint struct {
+	WaypointID  string  `json:"waypoint_id"`
+	ImageID     string  `json:"image_id"`
+	MarkerX     float64 `json:"marker_x"`
+	MarkerY     float64 `json:"marker_y"`
+	MarkerType  string  `json:"marker_type"`
+	Description string  `json:"description"`
+}
+
+// routeSnapshot is what the fuzz targets compare before and after an
+// input to detect state corruption.
+type routeSnapshot struct {
+	Status    string
+	Version   int
+	Waypoints []snapshotWaypoint
+}
+
+// snapshotRoute reads GET /api/v1/routes/{routeID}?include_images=true,
+// failing unless the route is still readable and well-formed.
+func snapshotRoute(t *testing.T, routeID, authToken string) routeSnapshot {
+	t.Helper()
+
+	resp := doRequest(t, http.MethodGet,
+		apiURL+"/api/v1/routes/"+routeID+"?include_images=true",
+		nil, authToken,
+	)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err, "snapshotRoute: read body")
+	require.Equalf(t, http.StatusOK, resp.StatusCode,
+		"route %s is no longer readable: %s", routeID, body,
+	)
+
+	var decoded struct {
+		Route struct {
+			Status  string `json:"route_status"`
+			Version int    `json:"version"`
+		} `json:"route"`
+		Waypoints []snapshotWaypoint `json:"waypoints"`
+	}
+
+	require.NoErrorf(t, json.Unmarshal(body, &decoded),
+		"route %s: GET body no longer decodes: %s", routeID, body,
+	)
+
+	return routeSnapshot{
+		Status:    decoded.Route.Status,
+		Version:   decoded.Route.Version,
+		Waypoints: decoded.Waypoints,
+	}
+}
+
+// buildFuzzUser gives the fixture a fresh anonymous user.
+func buildFuzzUser(t *testing.T, fx *fuzzFixture) {
+	t.Helper()
+
+	fx.UserID, fx.Token, _ = createAnonymousUser(t)
+}
+
+// buildFuzzPublishedRoute gives the fixture a user owning a published,
+// processed one-waypoint route.
+func buildFuzzPublishedRoute(t *testing.T, fx *fuzzFixture) {
+	t.Helper()
+
+	buildFuzzUser(t, fx)
+
+	fx.RouteID = createProcessedRoute(t, fx.Token, 1)
+	publishRoute(t, fx.RouteID, fx.Token)
+
+	waypoints := newDBInspector(t).waypoints(t, fx.RouteID)
+	require.Len(t, waypoints, 1, "buildFuzzPublishedRoute: waypoint")
+
+	fx.WaypointID = waypoints[0].ID
+	fx.ImageID = waypoints[0].ImageID
+	fx.Baseline = snapshotRoute(t, fx.RouteID, fx.Token)
+}
+
+// buildFuzzRevision adds a prepared revision to a published route.
+func buildFuzzRevision(t *testing.T, fx *fuzzFixture) {
+	t.Helper()
+
+	buildFuzzPublishedRoute(t, fx)
+
+	revision, status := prepareRevision(t, fx.RouteID, fx.Token)
+	require.Equal(t, http.StatusCreated, status,
+		"buildFuzzRevision: prepare revision",
+	)
+
+	fx.RevisionID = revision.RevisionID
+	fx.Baseline = snapshotRoute(t, fx.RouteID, fx.Token)
+}
+
+// buildFuzzRegisteredUser gives the fixture a confirmed registered user.
+func buildFuzzRegisteredUser(t *testing.T, fx *fuzzFixture) {
+	t.Helper()
+
+	_, anonToken, _ := createAnonymousUser(t)
+	fx.UserID, fx.Token, _ = registerAndConfirm(t, anonToken, uniqueEmail())
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -170,7 +171,9 @@ func doRequest(
 		reqBody = bytes.NewReader(encoded)
 	}
 
-	req, err := http.NewRequest(method, url, reqBody)
+	req, err := http.NewRequestWithContext(
+		reportContext(context.Background(), t), method, url, reqBody,
+	)
 	require.NoErrorf(t, err,
 		"doRequest: failed to create request for %s %s", method, url,
 	)
@@ -185,9 +188,9 @@ func doRequest(
 
 	client := &http.Client{
 		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
+		Transport: reporting(secretScanning(&http.Transport{
 			DisableKeepAlives: true,
-		},
+		})),
 	}
 
 	resp, err := client.Do(req)
@@ -259,6 +262,8 @@ func createAnonymousUser(
 
 	rtVal, _ := result["refresh_token"].(string)
 
+	trackUser(t, userIDVal, tokenVal)
+
 	return userIDVal, tokenVal, rtVal
 }
 
@@ -289,6 +294,8 @@ func prepareRoute(t *testing.T, authToken string) string {
 		"prepareRoute: route_id is empty",
 	)
 
+	trackRoute(t, routeID, authToken)
+
 	return routeID
 }
 
@@ -420,6 +427,8 @@ func emitEventIfNeeded(
 		event.Type = "message"
 	}
 
+	recordSSEEvent(ctx, *event)
+
 	select {
 	case events <- *event:
 	case <-ctx.Done():
@@ -468,7 +477,8 @@ func uploadToGateway(
 ) *http.Response {
 	t.Helper()
 
-	req, err := http.NewRequest(
+	req, err := http.NewRequestWithContext(
+		reportContext(context.Background(), t),
 		http.MethodPut, uploadURL, bytes.NewReader(imageBytes),
 	)
 	require.NoError(t, err)
@@ -480,9 +490,9 @@ func uploadToGateway(
 
 	client := &http.Client{
 		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
+		Transport: reporting(secretScanning(&http.Transport{
 			DisableKeepAlives: true,
-		},
+		})),
 	}
 
 	resp, err := client.Do(req)
@@ -491,6 +501,65 @@ func uploadToGateway(
 	return resp
 }
 
+// uploadTokenClaims decodes the claims of a gateway upload token without
+// verifying its signature. Tests use it to read what follow-api granted
+// (image_id, storage_key, max_file_size, content_type).
+func uploadTokenClaims(t *testing.T, uploadToken string) jwt.MapClaims {
+	t.Helper()
+
+	claims := jwt.MapClaims{}
+
+	_, _, err := jwt.NewParser().ParseUnverified(uploadToken, claims)
+	require.NoError(t, err, "uploadTokenClaims: malformed upload token")
+
+	return claims
+}
+
+// prepareImageReplacement calls POST .../replace-image/prepare for the
+// waypoint and returns the upload URL and token for the new image.
+func prepareImageReplacement(
+	t *testing.T,
+	routeID string,
+	waypointID string,
+	authToken string,
+	fileName string,
+	fileSize int,
+) ReplaceImagePrepareResponse {
+	t.Helper()
+
+	resp := doRequest(
+		t,
+		http.MethodPost,
+		fmt.Sprintf(
+			"%s/api/v1/routes/%s/waypoints/%s/replace-image/prepare",
+			apiURL, routeID, waypointID,
+		),
+		map[string]any{
+			"file_name":       fileName,
+			"file_size_bytes": fileSize,
+			"content_type":    "image/jpeg",
+			"marker_x":        0.5,
+			"marker_y":        0.5,
+		},
+		authToken,
+	)
+	require.Equal(t, http.StatusOK, resp.StatusCode,
+		"prepareImageReplacement: expected 200",
+	)
+	defer resp.Body.Close()
+
+	var result ReplaceImagePrepareResponse
+
+	err := json.NewDecoder(resp.Body).Decode(&result)
+	require.NoError(t, err,
+		"prepareImageReplacement: failed to decode response",
+	)
+
+	trackImage(t, result.ImageID, routeID)
+
+	return result
+}
+
 // uploadToGatewayWithExpectContinue sends a PUT request to uploadURL using the
 // HTTP "Expect: 100-continue" handshake. The client holds the body until the
 // server either sends "100 Continue" or rejects the request. This prevents a
@@ -521,13 +590,13 @@ func uploadToGatewayWithExpectContinue(
 
 	client := &http.Client{
 		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
+		Transport: secretScanning(&http.Transport{
 			DisableKeepAlives: true,
 			// How long to wait for the 100 Continue before sending the body
 			// anyway. A 5-second window is generous enough for CI and tight
 			// enough to not stall the test suite.
 			ExpectContinueTimeout: 5 * time.Second,
-		},
+		}),
 	}
 
 	return client.Do(req)
@@ -614,8 +683,30 @@ func createRouteWithWaypoints(
 		waypoints[i] = buildWaypointBody(i, spec.Filename, len(imgBytes))
 	}
 
-	body := map[string]any{
-		"route_id":       routeID,
+	return createRouteWithWaypointBodies(t, authToken, routeID, waypoints)
+}
+
+// createRouteWithWaypointBodies calls POST .../create-waypoints with
+// pre-built waypoint bodies (see buildWaypointBody) and the standard
+// integration-test route metadata. Used directly by tests whose upload
+// payloads are generated in memory rather than read from testdata/.
+func createRouteWithWaypointBodies(
+	t *testing.T,
+	authToken string,
+	routeID string,
+	waypoints []map[string]any,
+) CreateWaypointsResponse {
+	t.Helper()
+
+	return createRouteWithMetadata(
+		t, authToken, routeID, defaultRouteMetadata(), waypoints,
+	)
+}
+
+// defaultRouteMetadata returns the route metadata used by
+// createRouteWithWaypointBodies. Callers may override individual keys.
+func defaultRouteMetadata() map[string]any {
+	return map[string]any{
 		"address":        "123 Integration Test Street, Test City",
 		"start_point":    "Main entrance, ground floor",
 		"end_point":      "Test destination, 2nd floor",
@@ -625,8 +716,25 @@ func createRouteWithWaypoints(
 		"access_method":  "open",
 		"lifecycle_type": "permanent",
 		"owner_type":     "anonymous",
-		"waypoints":      waypoints,
 	}
+}
+
+// createRouteWithMetadata calls POST .../create-waypoints with the given
+// route metadata (see defaultRouteMetadata) and waypoint bodies.
+func createRouteWithMetadata(
+	t *testing.T,
+	authToken string,
+	routeID string,
+	metadata map[string]any,
+	waypoints []map[string]any,
+) CreateWaypointsResponse {
+	t.Helper()
+
+	body := make(map[string]any, len(metadata)+2)
+	maps.Copy(body, metadata)
+
+	body["route_id"] = routeID
+	body["waypoints"] = waypoints
 
 	url := apiURL + "/api/v1/routes/" + routeID + "/create-waypoints"
 
@@ -643,6 +751,10 @@ func createRouteWithWaypoints(
 		"createRouteWithWaypoints: failed to decode response",
 	)
 
+	for _, entry := range result.PresignedURLs {
+		trackImage(t, entry.ImageID, routeID)
+	}
+
 	return result
 }
 
@@ -693,6 +805,46 @@ func waitForRouteReady(
 	)
 }
 
+// routeWaypoint fetches GET /api/v1/routes/{routeID}?include_images=true
+// and returns the waypoint object whose image_id equals imageID. Calls
+// t.Fatalf if no waypoint references imageID.
+func routeWaypoint(
+	t *testing.T,
+	routeID string,
+	authToken string,
+	imageID string,
+) map[string]any {
+	t.Helper()
+
+	resp := doRequest(
+		t,
+		http.MethodGet,
+		apiURL+"/api/v1/routes/"+routeID+"?include_images=true",
+		nil,
+		authToken,
+	)
+	require.Equal(t, http.StatusOK, resp.StatusCode,
+		"routeWaypoint: expected 200 from GET route",
+	)
+
+	body := decodeJSON(t, resp)
+	waypoints, _ := body["waypoints"].([]any)
+
+	for _, raw := range waypoints {
+		wp, _ := raw.(map[string]any)
+		if wp["image_id"] == imageID {
+			return wp
+		}
+	}
+
+	t.Fatalf(
+		"routeWaypoint: no waypoint with image_id %s on route %s",
+		imageID, routeID,
+	)
+
+	return nil
+}
+
 // imageStatusKey returns the Valkey key for an image's status hash.
 func imageStatusKey(imageID string) string {
 	return fmt.Sprintf("%s:%s", valkey.KeyPrefixImageStatus, imageID)
@@ -733,6 +885,57 @@ func waitForImageStatus(
 	)
 }
 
+// waitForResultMessage scans the image:result stream with XRANGE from
+// startID until a message for imageID appears, then returns it. XRANGE
+// is idempotent, so the scan never competes with the API consumer group
+// for delivery. Capture startID (e.g. fmt.Sprintf("%d-0",
+// time.Now().UnixMilli())) before the upload that produces the message.
+// Calls t.Fatalf if no message arrives within timeout.
+func waitForResultMessage(
+	t *testing.T,
+	client valkeygo.Client,
+	imageID string,
+	startID string,
+	timeout time.Duration,
+) streamMessage {
+	t.Helper()
+
+	const pollInterval = 250 * time.Millisecond
+
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		entries, err := client.Do(
+			context.Background(),
+			client.B().Xrange().
+				Key(valkey.StreamImageResult).
+				Start(startID).
+				End("+").
+				Build(),
+		).AsXRange()
+		if err == nil {
+			for _, e := range entries {
+				if e.FieldValues[valkey.ResultFieldImageID] == imageID {
+					return streamMessage{
+						ID:     e.ID,
+						Fields: e.FieldValues,
+					}
+				}
+			}
+		}
+
+		time.Sleep(pollInterval)
+	}
+
+	t.Fatalf(
+		"waitForResultMessage: no image:result message for image %s "+
+			"within %s",
+		imageID, timeout,
+	)
+
+	return streamMessage{}
+}
+
 // hGetAll reads all fields of a Valkey hash and returns them as a
 // map[string]string. Returns an empty map if the key does not exist.
 func hGetAll(
@@ -750,6 +953,8 @@ func hGetAll(
 		"hGetAll: HGETALL failed for key %s", key,
 	)
 
+	recordHash(t, key, result)
+
 	return result
 }
 
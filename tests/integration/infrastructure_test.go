@@ -15,7 +15,7 @@ import (
 // TestInfrastructure_PostgreSQLReachable verifies PostgreSQL connectivity via API health
 // endpoint. Requires admin JWT (admin:access scope).
 func TestInfrastructure_PostgreSQLReachable(t *testing.T) {
-	t.Parallel()
+	isolate(t, isolationParallel, labelSmoke)
 
 	token := adminToken(t)
 
@@ -49,7 +49,7 @@ func TestInfrastructure_PostgreSQLReachable(t *testing.T) {
 
 // TestInfrastructure_ValkeyReachable verifies Valkey connectivity with a direct PING.
 func TestInfrastructure_ValkeyReachable(t *testing.T) {
-	t.Parallel()
+	isolate(t, isolationParallel, labelSmoke)
 
 	cfg := valkeygo.ClientOption{
 		InitAddress:  []string{valkeyAddress},
@@ -74,7 +74,7 @@ func TestInfrastructure_ValkeyReachable(t *testing.T) {
 // TestInfrastructure_ValkeyHealthReachable verifies Valkey connectivity via the
 // API /health/valkey endpoint. Requires admin JWT (admin:access scope).
 func TestInfrastructure_ValkeyHealthReachable(t *testing.T) {
-	t.Parallel()
+	isolate(t, isolationParallel, labelSmoke)
 
 	token := adminToken(t)
 
@@ -109,7 +109,7 @@ func TestInfrastructure_ValkeyHealthReachable(t *testing.T) {
 // TestInfrastructure_MinIOReachable verifies MinIO connectivity via API storage health
 // endpoint. Requires admin JWT (admin:access scope).
 func TestInfrastructure_MinIOReachable(t *testing.T) {
-	t.Parallel()
+	isolate(t, isolationParallel, labelSmoke)
 
 	token := adminToken(t)
 
@@ -143,7 +143,7 @@ func TestInfrastructure_MinIOReachable(t *testing.T) {
 
 // TestInfrastructure_FollowAPIHealthy verifies follow-api general health endpoint.
 func TestInfrastructure_FollowAPIHealthy(t *testing.T) {
-	t.Parallel()
+	isolate(t, isolationParallel, labelSmoke)
 
 	resp, err := http.Get(apiURL + "/health")
 	if err != nil {
@@ -182,7 +182,7 @@ func TestInfrastructure_FollowAPIHealthy(t *testing.T) {
 
 // TestInfrastructure_FollowGatewayHealthy verifies follow-image-gateway health endpoint.
 func TestInfrastructure_FollowGatewayHealthy(t *testing.T) {
-	t.Parallel()
+	isolate(t, isolationParallel, labelSmoke)
 
 	resp, err := http.Get(gatewayURL + "/health")
 	if err != nil {
@@ -225,7 +225,7 @@ func TestInfrastructure_FollowGatewayHealthy(t *testing.T) {
 // TestInfrastructure_APIHealthIncludesValkey checks for Valkey health information in API
 // health response.
 func TestInfrastructure_APIHealthIncludesValkey(t *testing.T) {
-	t.Parallel()
+	isolate(t, isolationParallel, labelSmoke)
 
 	resp, err := http.Get(apiURL + "/health")
 	if err != nil {
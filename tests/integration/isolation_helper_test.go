@@ -0,0 +1,211 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog/log"
+)
+
+// isolationClass says how much of the shared stack a test may disturb,
+// and so when it runs. Every top-level test declares one with isolate.
+type isolationClass int
+
+const (
+	// isolationParallel tests only touch users, routes and images they
+	// create themselves. They run first, concurrently.
+	isolationParallel isolationClass = iota
+	// isolationSequential tests change state other tests observe: SMTP
+	// faults, consumer groups on image:result, timing and memory
+	// measurements. They run one at a time once every
+	// parallel test has finished.
+	isolationSequential
+	// isolationDestructive tests restart a service, spend the host's
+	// rate-limit budget or plant stale state the reaper acts on. They
+	// run last, one at a time.
+	isolationDestructive
+)
+
+func (c isolationClass) String() string {
+	switch c {
+	case isolationParallel:
+		return "parallel"
+	case isolationSequential:
+		return "sequential"
+	case isolationDestructive:
+		return "destructive"
+	default:
+		return "isolationClass(" + strconv.Itoa(int(c)) + ")"
+	}
+}
+
+// isolationGoParallel is what TestMain raises -test.parallel to. Every
+// declared test calls t.Parallel and then waits at its phase gate while
+// holding one of the go tool's slots, so there must be a slot for each
+// of them or a waiting sequential test could starve the parallel ones
+// it waits for. The real concurrency limit is isolation.slots.
+const isolationGoParallel = 1 << 12
+
+// isolation schedules declared tests into phases. The go tool runs
+// every top-level test body up to t.Parallel first, in source order, so
+// by the time any declared test resumes all of them have registered and
+// the phase wait groups hold their final counts.
+var isolation struct {
+	mu      sync.Mutex
+	classes map[string]isolationClass
+
+	// pending counts the registered tests of each class that have not
+	// finished yet.
+	pending [isolationDestructive + 1]sync.WaitGroup
+
+	// slots bounds how many parallel tests run at once; sized from the
+	// -parallel flag by configureIsolation.
+	slots chan struct{}
+
+	// exclusive serialises the sequential and destructive phases.
+	exclusive sync.Mutex
+}
+
+// configureIsolation takes over -parallel: its value becomes the limit
+// on concurrent parallel-class tests, and the flag itself is raised to
+// isolationGoParallel. Call it before m.Run.
+func configureIsolation() {
+	flag.Parse()
+
+	limit := 1
+
+	f := flag.Lookup("test.parallel")
+	if f != nil {
+		if n, err := strconv.Atoi(f.Value.String()); err == nil && n > 0 {
+			limit = n
+		}
+
+		err := f.Value.Set(strconv.Itoa(isolationGoParallel))
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to raise -test.parallel")
+		}
+	}
+
+	isolation.slots = make(chan struct{}, limit)
+
+	log.Info().Int("parallel", limit).Msg("isolation groups configured")
+}
+
+// isolate declares t's isolation class and labels, skips t if
+// TEST_LABELS or the stack rules it out, and otherwise holds t until its
+// phase: parallel tests run together, at most -parallel at a time;
+// sequential tests run alone after them; destructive tests run alone
+// after those. It must be the first call in a top-level test.
+func isolate(t *testing.T, class isolationClass, labels ...testLabel) {
+	t.Helper()
+
+	selectTest(t, class, labels)
+
+	isolation.mu.Lock()
+	if isolation.classes == nil {
+		isolation.classes = make(map[string]isolationClass)
+	}
+	isolation.classes[t.Name()] = class
+	isolation.mu.Unlock()
+
+	isolation.pending[class].Add(1)
+	t.Cleanup(isolation.pending[class].Done)
+
+	t.Parallel()
+	printManifest()
+
+	if class == isolationParallel {
+		if isolation.slots != nil {
+			isolation.slots <- struct{}{}
+			t.Cleanup(func() { <-isolation.slots })
+		}
+	} else {
+		for earlier := range class {
+			isolation.pending[earlier].Wait()
+		}
+
+		isolation.exclusive.Lock()
+		t.Cleanup(isolation.exclusive.Unlock)
+	}
+
+	trackTest(t)
+}
+
+// requireIsolation fails t unless its top-level test declared at least
+// class. Helpers that change state other tests observe call it, so a
+// test that uses them without the matching declaration fails at once
+// instead of racing its neighbours. Undeclared tests run before any
+// declared one, alone, and pass.
+func requireIsolation(t *testing.T, class isolationClass) {
+	t.Helper()
+
+	name, _, _ := strings.Cut(t.Name(), "/")
+
+	isolation.mu.Lock()
+	declared, ok := isolation.classes[name]
+	isolation.mu.Unlock()
+
+	if ok && declared < class {
+		t.Fatalf("%s is declared %s but must be at least %s",
+			name, declared, class,
+		)
+	}
+}
+
+// sharedState names state in the stack that tests read and some tests
+// change in ways that would break concurrent readers.
+type sharedState string
+
+// stateImageResults is the image:result stream. Readers scan it with
+// XRANGE; claimants create consumer groups on it, inject into it or
+// make the reaper publish to it.
+const stateImageResults sharedState = "image:result"
+
+// sharedStates holds one lock per sharedState.
+var sharedStates struct {
+	mu    sync.Mutex
+	locks map[sharedState]*sync.RWMutex
+}
+
+func sharedStateLock(s sharedState) *sync.RWMutex {
+	sharedStates.mu.Lock()
+	defer sharedStates.mu.Unlock()
+
+	if sharedStates.locks == nil {
+		sharedStates.locks = make(map[sharedState]*sync.RWMutex)
+	}
+
+	l, ok := sharedStates.locks[s]
+	if !ok {
+		l = &sync.RWMutex{}
+		sharedStates.locks[s] = l
+	}
+
+	return l
+}
+
+// shareState holds s for reading until t ends. Any number of tests can
+// share it; none can while another test has claimed it.
+func shareState(t *testing.T, s sharedState) {
+	t.Helper()
+
+	l := sharedStateLock(s)
+	l.RLock()
+	t.Cleanup(l.RUnlock)
+}
+
+// claimState holds s exclusively until t ends.
+func claimState(t *testing.T, s sharedState) {
+	t.Helper()
+
+	requireIsolation(t, isolationSequential)
+
+	l := sharedStateLock(s)
+	l.Lock()
+	t.Cleanup(l.Unlock)
+}
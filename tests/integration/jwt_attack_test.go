@@ -0,0 +1,362 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenAttack is one way of forging a token from a genuine one. The
+// genuine token's header and claims are copied, Header entries are
+// overlaid (a nil value removes the entry), Mutate edits the claims,
+// and Sign chooses the key; a nil Sign uses the key the target service
+// trusts, so the forgery differs from a valid token only in what the
+// case changes.
+type tokenAttack struct {
+	Name   string
+	Header map[string]any
+	Mutate func(claims map[string]any)
+	Sign   func(t *testing.T) jwtSigner
+	// AnyClientError accepts any 4xx rather than 401/403, for cases a
+	// server may legitimately reject before authentication (e.g. 431).
+	AnyClientError bool
+}
+
+// forge builds the attack's token from genuine, falling back to trusted
+// when the case does not pick its own signer.
+func (a tokenAttack) forge(
+	t *testing.T,
+	genuine string,
+	trusted jwtSigner,
+) string {
+	t.Helper()
+
+	header, claims := decodeJWT(t, genuine)
+
+	for k, v := range a.Header {
+		if v == nil {
+			delete(header, k)
+		} else {
+			header[k] = v
+		}
+	}
+
+	if a.Mutate != nil {
+		a.Mutate(claims)
+	}
+
+	sign := trusted
+	if a.Sign != nil {
+		sign = a.Sign(t)
+	}
+
+	return forgeJWT(t, header, claims, sign)
+}
+
+// assertRejected checks a forged token was refused for authentication
+// reasons and did not crash the service.
+func (a tokenAttack) assertRejected(t *testing.T, status int) {
+	t.Helper()
+
+	if a.AnyClientError {
+		assert.Truef(t, status >= 400 && status < 500,
+			"%s: expected a 4xx rejection, got %d", a.Name, status,
+		)
+
+		return
+	}
+
+	assert.Containsf(t,
+		[]int{http.StatusUnauthorized, http.StatusForbidden}, status,
+		"%s: expected 401/403, got %d", a.Name, status,
+	)
+}
+
+// withClaim returns a Mutate that sets key to value.
+func withClaim(key string, value any) func(map[string]any) {
+	return func(c map[string]any) { c[key] = value }
+}
+
+// withoutClaim returns a Mutate that removes key.
+func withoutClaim(key string) func(map[string]any) {
+	return func(c map[string]any) { delete(c, key) }
+}
+
+// signWith returns a Sign that always uses signer.
+func signWith(signer jwtSigner) func(*testing.T) jwtSigner {
+	return func(*testing.T) jwtSigner { return signer }
+}
+
+// commonTokenAttacks apply to both the API's HS256 access tokens and the
+// gateway's EdDSA upload tokens. Cases signed by the attacker share one
+// freshly generated key, whose public half is what the jwk case embeds.
+func commonTokenAttacks(t *testing.T) []tokenAttack {
+	t.Helper()
+
+	now := time.Now()
+	hour := int64(time.Hour / time.Second)
+
+	attacker := attackerEd25519Key(t)
+	signWithAttackerKey := signWith(ed25519Signer(attacker))
+
+	return []tokenAttack{
+		{
+			Name:   "AlgNone",
+			Header: map[string]any{"alg": "none"},
+			Sign:   signWith(unsigned),
+		},
+		{
+			Name:   "AlgNoneUppercase",
+			Header: map[string]any{"alg": "NONE"},
+			Sign:   signWith(unsigned),
+		},
+		{
+			Name:   "AttackerEd25519Key",
+			Header: map[string]any{"alg": "EdDSA"},
+			Sign:   signWithAttackerKey,
+		},
+		{
+			Name: "KidPathTraversal",
+			Header: map[string]any{
+				"alg": "HS256",
+				"kid": "../../../../../../dev/null",
+			},
+			Sign: signWith(hs256Signer(nil)),
+		},
+		{
+			Name: "KidSQLInjection",
+			Header: map[string]any{
+				"alg": "HS256",
+				"kid": "x' UNION SELECT 'attacker' --",
+			},
+			Sign: signWith(hs256Signer([]byte("attacker"))),
+		},
+		{
+			Name: "JKUInjection",
+			Header: map[string]any{
+				"alg": "EdDSA",
+				"kid": "attacker",
+				"jku": "https://attacker.invalid/.well-known/jwks.json",
+			},
+			Sign: signWithAttackerKey,
+		},
+		{
+			Name: "X5UInjection",
+			Header: map[string]any{
+				"alg": "EdDSA",
+				"x5u": "https://attacker.invalid/cert.pem",
+			},
+			Sign: signWithAttackerKey,
+		},
+		{
+			Name: "EmbeddedJWK",
+			Header: map[string]any{
+				"alg": "EdDSA",
+				"jwk": map[string]any{
+					"kty": "OKP",
+					"crv": "Ed25519",
+					"x": base64.RawURLEncoding.EncodeToString(
+						attacker.Public().(ed25519.PublicKey),
+					),
+				},
+			},
+			Sign: signWithAttackerKey,
+		},
+		{Name: "MissingExp", Mutate: withoutClaim("exp")},
+		{
+			Name: "Expired",
+			Mutate: func(c map[string]any) {
+				c["iat"] = now.Unix() - 2*hour
+				c["nbf"] = now.Unix() - 2*hour
+				c["exp"] = now.Unix() - hour
+			},
+		},
+		{Name: "NotYetValid", Mutate: withClaim("nbf", now.Unix()+hour)},
+		{Name: "FutureIat", Mutate: withClaim("iat", now.Unix()+hour)},
+		{Name: "WrongIssuer", Mutate: withClaim("iss", "attacker")},
+		{Name: "MissingIssuer", Mutate: withoutClaim("iss")},
+		{
+			Name:           "Oversized",
+			Mutate:         withClaim("pad", strings.Repeat("A", 64<<10)),
+			AnyClientError: true,
+		},
+	}
+}
+
+// TestJWTAttacks_APIAccessToken forges access tokens for a real
+// anonymous user and checks follow-api refuses every one of them, after
+// first proving that an unmodified re-signed token is accepted (so each
+// rejection is down to the case's change, not to the toolkit).
+func TestJWTAttacks_APIAccessToken(t *testing.T) {
+	isolate(t, isolationParallel, labelSecurity)
+
+	userID, token, _ := createAnonymousUser(t)
+
+	trusted := hs256Signer(apiJWTSecret(t))
+	probe := func(t *testing.T, tok string) int {
+		t.Helper()
+
+		resp := doRequest(t, http.MethodGet,
+			apiURL+"/api/v1/users/anonymous/"+userID, nil, tok,
+		)
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	t.Run("Baseline", func(t *testing.T) {
+		require.Equal(t, http.StatusOK,
+			probe(t, resignAPIToken(t, token, nil, nil)),
+			"re-signed genuine token must be accepted",
+		)
+	})
+
+	gatewayPub := gatewaySigningKey(t).Public().(ed25519.PublicKey)
+
+	attacks := append(commonTokenAttacks(t),
+		tokenAttack{Name: "MissingNbf", Mutate: withoutClaim("nbf")},
+		tokenAttack{
+			Name:   "WrongAudience",
+			Mutate: withClaim("aud", "follow-image-gateway"),
+		},
+		tokenAttack{
+			Name:   "WrongSecret",
+			Header: map[string]any{"alg": "HS256"},
+			Sign: signWith(hs256Signer(
+				[]byte("not-the-api-secret-but-32-bytes-long"),
+			)),
+		},
+		tokenAttack{
+			// A token the platform trusts, but for the gateway.
+			Name:   "EdDSAWithGatewayKey",
+			Header: map[string]any{"alg": "EdDSA"},
+			Sign: func(t *testing.T) jwtSigner {
+				return ed25519Signer(gatewaySigningKey(t))
+			},
+		},
+		tokenAttack{
+			Name:   "HS256WithGatewayPublicKey",
+			Header: map[string]any{"alg": "HS256"},
+			Sign:   signWith(hs256Signer(gatewayPub)),
+		},
+	)
+
+	for _, a := range attacks {
+		t.Run(a.Name, func(t *testing.T) {
+			a.assertRejected(t, probe(t, a.forge(t, token, trusted)))
+		})
+	}
+
+	// Scope escalation: a validly signed token whose user_type is
+	// anonymous must not unlock admin endpoints by listing admin scope.
+	t.Run("ScopeEscalation", func(t *testing.T) {
+		forged := resignAPIToken(t, token, nil,
+			withClaim("scopes",
+				[]string{"api:read", "api:write", "admin:access"},
+			),
+		)
+
+		resp := doRequest(t, http.MethodGet, apiURL+"/health/db", nil, forged)
+		resp.Body.Close()
+
+		assert.Containsf(t,
+			[]int{http.StatusUnauthorized, http.StatusForbidden},
+			resp.StatusCode,
+			"anonymous user_type with admin:access must not reach "+
+				"/health/db (got %d)", resp.StatusCode,
+		)
+	})
+}
+
+// TestJWTAttacks_GatewayUploadToken forges upload tokens for real,
+// freshly issued images and checks the gateway refuses every one and
+// writes nothing for it. One image is kept back to prove an unmodified
+// re-signed token is accepted.
+func TestJWTAttacks_GatewayUploadToken(t *testing.T) {
+	isolate(t, isolationParallel, labelSecurity)
+
+	_, token, _ := createAnonymousUser(t)
+	objects := newObjectInspector(t)
+
+	apiSecret := apiJWTSecret(t)
+	gatewayKey := gatewaySigningKey(t)
+	gatewayPub := gatewayKey.Public().(ed25519.PublicKey)
+	trusted := ed25519Signer(gatewayKey)
+
+	attacks := append(commonTokenAttacks(t),
+		tokenAttack{
+			// A token the platform trusts, but for the API.
+			Name:   "HS256WithAPISecret",
+			Header: map[string]any{"alg": "HS256"},
+			Sign:   signWith(hs256Signer(apiSecret)),
+		},
+		tokenAttack{
+			Name:   "HS256WithGatewayPublicKey",
+			Header: map[string]any{"alg": "HS256"},
+			Sign:   signWith(hs256Signer(gatewayPub)),
+		},
+		tokenAttack{
+			Name:   "HS256WithGatewayPublicKeyBase64",
+			Header: map[string]any{"alg": "HS256"},
+			Sign: signWith(hs256Signer([]byte(
+				base64.StdEncoding.EncodeToString(gatewayPub),
+			))),
+		},
+		tokenAttack{
+			Name:   "WrongSubject",
+			Mutate: withClaim("sub", "image-download"),
+		},
+		tokenAttack{
+			Name:   "WrongAudience",
+			Mutate: withClaim("aud", "follow-api"),
+		},
+	)
+
+	payload := jpegBytes(t, 320, 240)
+	routeID := prepareRoute(t, token)
+
+	waypoints := make([]map[string]any, len(attacks)+1)
+	for i := range waypoints {
+		waypoints[i] = buildWaypointBody(i, "forged.jpg", len(payload))
+	}
+
+	created := createRouteWithWaypointBodies(t, token, routeID, waypoints)
+	require.Len(t, created.PresignedURLs, len(waypoints))
+
+	for i, a := range attacks {
+		upload := created.PresignedURLs[i]
+
+		t.Run(a.Name, func(t *testing.T) {
+			forged := a.forge(t, upload.UploadToken, trusted)
+
+			resp := uploadToGateway(t, upload.UploadURL, forged, payload)
+			resp.Body.Close()
+
+			a.assertRejected(t, resp.StatusCode)
+			assert.Empty(t,
+				objects.objects(t, imageStorageKeyPrefix+upload.ImageID),
+				"rejected upload must not write an object",
+			)
+		})
+	}
+
+	t.Run("Baseline", func(t *testing.T) {
+		upload := created.PresignedURLs[len(attacks)]
+		forged := resignUploadToken(t, upload.UploadToken, nil)
+
+		resp := uploadToGateway(t, upload.UploadURL, forged, payload)
+		resp.Body.Close()
+
+		require.Equal(t, http.StatusAccepted, resp.StatusCode,
+			"re-signed genuine upload token must be accepted",
+		)
+	})
+}
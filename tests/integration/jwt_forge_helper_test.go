@@ -0,0 +1,197 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/require"
+)
+
+// jwtSigner produces the signature for a JWT signing input
+// (base64url(header) + "." + base64url(claims)).
+type jwtSigner func(signingInput string) []byte
+
+// hs256Signer signs with HMAC-SHA256 under key.
+func hs256Signer(key []byte) jwtSigner {
+	return func(input string) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(input))
+
+		return mac.Sum(nil)
+	}
+}
+
+// ed25519Signer signs with an Ed25519 private key.
+func ed25519Signer(key ed25519.PrivateKey) jwtSigner {
+	return func(input string) []byte {
+		return ed25519.Sign(key, []byte(input))
+	}
+}
+
+// rs256Signer signs with RSASSA-PKCS1-v1_5 and SHA-256, as Google and
+// Apple sign their ID tokens. Signing only fails for keys too small for
+// SHA-256, which fails t.
+func rs256Signer(t *testing.T, key *rsa.PrivateKey) jwtSigner {
+	t.Helper()
+
+	return func(input string) []byte {
+		digest := sha256.Sum256([]byte(input))
+
+		sig, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, digest[:])
+		require.NoError(t, err, "rs256Signer: sign")
+
+		return sig
+	}
+}
+
+// unsigned produces an empty signature, as used by alg=none tokens.
+func unsigned(string) []byte { return nil }
+
+// forgeJWT assembles a compact JWT from arbitrary header and claims.
+// Unlike a JWT library it enforces nothing, so tests can produce
+// tokens no well-behaved issuer would.
+func forgeJWT(
+	t *testing.T,
+	header map[string]any,
+	claims map[string]any,
+	sign jwtSigner,
+) string {
+	t.Helper()
+
+	h, err := json.Marshal(header)
+	require.NoError(t, err, "forgeJWT: header")
+
+	c, err := json.Marshal(claims)
+	require.NoError(t, err, "forgeJWT: claims")
+
+	input := base64.RawURLEncoding.EncodeToString(h) + "." +
+		base64.RawURLEncoding.EncodeToString(c)
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(sign(input))
+}
+
+// decodeJWT splits a compact JWT into its header and claims without
+// verifying it. Numbers decode as float64.
+func decodeJWT(
+	t *testing.T,
+	token string,
+) (header, claims map[string]any) {
+	t.Helper()
+
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3, "decodeJWT: token must have 3 parts")
+
+	for i, dst := range []*map[string]any{&header, &claims} {
+		raw, err := base64.RawURLEncoding.DecodeString(parts[i])
+		require.NoError(t, err, "decodeJWT: part %d", i)
+		require.NoError(t, json.Unmarshal(raw, dst),
+			"decodeJWT: part %d", i,
+		)
+	}
+
+	return header, claims
+}
+
+// apiJWTSecret returns the HS256 secret follow-api signs access tokens
+// with.
+func apiJWTSecret(t *testing.T) []byte {
+	t.Helper()
+
+	secret := resolveJWTSecret(t)
+	require.NotEmpty(t, secret,
+		"apiJWTSecret: JWT_SECRET not found in env or /etc/follow-api",
+	)
+
+	return []byte(secret)
+}
+
+// gatewaySigningKey returns the Ed25519 private key follow-api signs
+// upload tokens with. FOLLOW_API_ED25519_PRIVATE_KEY (a base64 32-byte
+// seed) is read from the environment, then /etc/follow-api, then the
+// test keypair in tests/integration/.env.
+func gatewaySigningKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+
+	const key = "FOLLOW_API_ED25519_PRIVATE_KEY"
+
+	encoded := os.Getenv(key)
+
+	for _, file := range []string{"/etc/follow-api", ".env"} {
+		if encoded != "" {
+			break
+		}
+
+		if envMap, err := godotenv.Read(file); err == nil {
+			encoded = envMap[key]
+		}
+	}
+
+	require.NotEmpty(t, encoded, "gatewaySigningKey: %s not found", key)
+
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	require.NoError(t, err, "gatewaySigningKey: %s is not base64", key)
+	require.Len(t, seed, ed25519.SeedSize,
+		"gatewaySigningKey: %s must be a 32-byte seed", key,
+	)
+
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+// attackerEd25519Key returns a fresh key the services have never seen.
+func attackerEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	return priv
+}
+
+// resignAPIToken re-signs a real access token's claims, after applying
+// mutate, under the API's HS256 secret with header overrides applied.
+func resignAPIToken(
+	t *testing.T,
+	token string,
+	headerOverrides map[string]any,
+	mutate func(claims map[string]any),
+) string {
+	t.Helper()
+
+	header, claims := decodeJWT(t, token)
+	maps.Copy(header, headerOverrides)
+
+	if mutate != nil {
+		mutate(claims)
+	}
+
+	return forgeJWT(t, header, claims, hs256Signer(apiJWTSecret(t)))
+}
+
+// resignUploadToken re-signs a real upload token's claims, after
+// applying mutate, under the gateway-trusted Ed25519 key.
+func resignUploadToken(
+	t *testing.T,
+	token string,
+	mutate func(claims map[string]any),
+) string {
+	t.Helper()
+
+	header, claims := decodeJWT(t, token)
+	if mutate != nil {
+		mutate(claims)
+	}
+
+	return forgeJWT(t, header, claims, ed25519Signer(gatewaySigningKey(t)))
+}
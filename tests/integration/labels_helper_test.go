@@ -0,0 +1,298 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog/log"
+)
+
+// testLabel tags a test for selection with TEST_LABELS. Tests declare
+// labels as the trailing arguments of isolate.
+type testLabel string
+
+const (
+	// labelSmoke marks the short set that shows the stack works at all.
+	labelSmoke testLabel = "smoke"
+	// labelSlow marks tests that take tens of seconds or more.
+	labelSlow testLabel = "slow"
+	// labelDestructive is implied by isolationDestructive.
+	labelDestructive testLabel = "destructive"
+	// labelLocalOnly marks tests that restart follow-api.
+	labelLocalOnly testLabel = "local-only"
+	// labelProxy marks tests that go through Caddy.
+	labelProxy testLabel = "proxy"
+	// labelMailFaults marks tests that make the embedded SMTP server
+	// fail.
+	labelMailFaults testLabel = "mail-faults"
+	// labelSeed marks tests that leave demo data behind. They only run
+	// when TEST_LABELS names the label.
+	labelSeed testLabel = "seed"
+	// labelSecurity marks tests of authentication, authorisation and
+	// data exposure.
+	labelSecurity testLabel = "security"
+)
+
+// knownLabels lists every label TEST_LABELS may name.
+var knownLabels = []testLabel{
+	labelSmoke, labelSlow, labelDestructive, labelLocalOnly, labelProxy,
+	labelMailFaults, labelSeed, labelSecurity,
+}
+
+// optInLabels are excluded unless TEST_LABELS includes them by name.
+var optInLabels = []testLabel{labelSeed}
+
+// capability is something the running stack can or cannot do,
+// depending on INTEGRATION_TEST_MODE and MAIL_CAPTURE.
+type capability struct {
+	Name string
+	// Available reports whether the current stack has it, and if not,
+	// what would provide it.
+	Available func() (bool, string)
+}
+
+// labelCapabilities maps labels to what a test carrying them needs.
+var labelCapabilities = map[testLabel]capability{
+	labelLocalOnly: {"process control", func() (bool, string) {
+		return integrationMode() == "local", "INTEGRATION_TEST_MODE=local"
+	}},
+	labelProxy: {"reverse proxy", func() (bool, string) {
+		return proxyMode(), "INTEGRATION_TEST_MODE=proxy"
+	}},
+	labelMailFaults: {"embedded SMTP server", func() (bool, string) {
+		return integrationMode() == "local" && useEmbeddedSMTP(),
+			"INTEGRATION_TEST_MODE=local and MAIL_CAPTURE=embedded"
+	}},
+}
+
+// integrationMode is INTEGRATION_TEST_MODE with its default.
+func integrationMode() string {
+	return envOrDefault("INTEGRATION_TEST_MODE", "local")
+}
+
+// labelSelector is the parsed TEST_LABELS: a comma-separated list of
+// labels to include, each optionally prefixed with "-" to exclude it
+// instead. With no includes every test is a candidate; with some, a
+// test needs at least one of them. An exclude always wins.
+type labelSelector struct {
+	Raw     string
+	Include []testLabel
+	Exclude []testLabel
+}
+
+// parseLabelSelector parses a TEST_LABELS value, rejecting labels no
+// test can carry so that a typo does not silently select nothing.
+func parseLabelSelector(raw string) (labelSelector, error) {
+	sel := labelSelector{Raw: raw}
+
+	for term := range strings.SplitSeq(raw, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		name, exclude := strings.CutPrefix(term, "-")
+
+		label := testLabel(name)
+		if !slices.Contains(knownLabels, label) {
+			return labelSelector{}, fmt.Errorf(
+				"TEST_LABELS: unknown label %q (known: %s)",
+				name, joinLabels(knownLabels),
+			)
+		}
+
+		if exclude {
+			sel.Exclude = append(sel.Exclude, label)
+		} else {
+			sel.Include = append(sel.Include, label)
+		}
+	}
+
+	return sel, nil
+}
+
+// skipReason returns why a test with labels must not run, or "" if it
+// should.
+func (s labelSelector) skipReason(labels []testLabel) string {
+	for _, l := range labels {
+		if slices.Contains(s.Exclude, l) {
+			return fmt.Sprintf("label %s excluded by TEST_LABELS", l)
+		}
+
+		if slices.Contains(optInLabels, l) && !s.includes(l) {
+			return fmt.Sprintf("label %s runs only with TEST_LABELS=%s", l, l)
+		}
+	}
+
+	if len(s.Include) > 0 && !slices.ContainsFunc(labels, s.includes) {
+		return "no label in TEST_LABELS=" + s.Raw
+	}
+
+	for _, l := range labels {
+		c, ok := labelCapabilities[l]
+		if !ok {
+			continue
+		}
+
+		if available, needs := c.Available(); !available {
+			return fmt.Sprintf("label %s needs %s (%s)", l, c.Name, needs)
+		}
+	}
+
+	return ""
+}
+
+func (s labelSelector) includes(l testLabel) bool {
+	return slices.Contains(s.Include, l)
+}
+
+// manifestEntry records what the selector decided for one test.
+type manifestEntry struct {
+	Class  isolationClass
+	Labels []testLabel
+	Skip   string
+}
+
+// selection holds TEST_LABELS and the manifest being built as tests
+// declare themselves.
+var selection struct {
+	selector labelSelector
+
+	mu      sync.Mutex
+	entries map[string]manifestEntry
+
+	printed sync.Once
+}
+
+// configureSelection reads TEST_LABELS. Call it before m.Run.
+func configureSelection() {
+	sel, err := parseLabelSelector(os.Getenv("TEST_LABELS"))
+	if err != nil {
+		log.Error().Err(err).Msg("invalid test selection")
+		os.Exit(1)
+	}
+
+	selection.selector = sel
+}
+
+// selectTest records t in the manifest and skips it if the selector or
+// the stack rules it out.
+func selectTest(t *testing.T, class isolationClass, labels []testLabel) {
+	t.Helper()
+
+	if class == isolationDestructive && !slices.Contains(labels,
+		labelDestructive,
+	) {
+		labels = append(labels, labelDestructive)
+	}
+
+	slices.Sort(labels)
+
+	entry := manifestEntry{
+		Class:  class,
+		Labels: labels,
+		Skip:   selection.selector.skipReason(labels),
+	}
+
+	selection.mu.Lock()
+	if selection.entries == nil {
+		selection.entries = make(map[string]manifestEntry)
+	}
+	selection.entries[t.Name()] = entry
+	selection.mu.Unlock()
+
+	if entry.Skip != "" {
+		t.Skip(entry.Skip)
+	}
+}
+
+// printManifest writes the manifest once: when the first selected test
+// leaves the registration pass, or after m.Run if none did. It goes to
+// stdout and, if TEST_MANIFEST names a file, there as well.
+func printManifest() {
+	selection.printed.Do(func() {
+		selection.mu.Lock()
+		defer selection.mu.Unlock()
+
+		if len(selection.entries) == 0 {
+			return
+		}
+
+		out := io.Writer(os.Stdout)
+
+		if path := os.Getenv("TEST_MANIFEST"); path != "" {
+			f, err := os.Create(path)
+			if err != nil {
+				log.Warn().Err(err).Str("path", path).
+					Msg("failed to create test manifest")
+			} else {
+				defer f.Close()
+
+				out = io.MultiWriter(os.Stdout, f)
+			}
+		}
+
+		writeManifest(out)
+	})
+}
+
+// writeManifest renders the manifest, selected tests first, each group
+// sorted by name.
+func writeManifest(w io.Writer) {
+	names := slices.Sorted(maps.Keys(selection.entries))
+
+	var run, skipped int
+
+	for _, name := range names {
+		if selection.entries[name].Skip == "" {
+			run++
+		} else {
+			skipped++
+		}
+	}
+
+	fmt.Fprintf(w, "test manifest: %d to run, %d skipped "+
+		"(INTEGRATION_TEST_MODE=%s TEST_LABELS=%q)\n",
+		run, skipped, integrationMode(), selection.selector.Raw,
+	)
+
+	width := 0
+	for _, name := range names {
+		width = max(width, len(name))
+	}
+
+	for _, skip := range []bool{false, true} {
+		for _, name := range names {
+			e := selection.entries[name]
+			if (e.Skip != "") != skip {
+				continue
+			}
+
+			status, detail := "run ", joinLabels(e.Labels)
+			if skip {
+				status, detail = "skip", e.Skip
+			}
+
+			fmt.Fprintf(w, "  %s  %-11s  %-*s  %s\n",
+				status, e.Class, width, name, detail,
+			)
+		}
+	}
+}
+
+func joinLabels(labels []testLabel) string {
+	s := make([]string, len(labels))
+	for i, l := range labels {
+		s[i] = string(l)
+	}
+
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,302 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog/log"
+	valkeygo "github.com/valkey-io/valkey-go"
+	"github.com/yoseforb/follow-pkg/valkey"
+)
+
+// Leak check modes, selected with LEAK_CHECK.
+const (
+	leakCheckOff    = "off"
+	leakCheckReport = "report"
+	leakCheckStrict = "strict"
+)
+
+// leak is one leftover found after the suite finished.
+type leak struct {
+	// Store is where the leftover lives: "valkey", "minio" or
+	// "postgres".
+	Store string
+	// Item is the Valkey key, object key or route ID.
+	Item     string
+	Resource trackedResource
+}
+
+// leakScan is the outcome of one pass over the stores.
+type leakScan struct {
+	Leaks []leak
+	// Unattributed counts leftovers that match no tracked resource,
+	// e.g. data from earlier runs or from raw requests in tests.
+	Unattributed map[string]int
+	// Errors records stores that could not be scanned.
+	Errors []error
+}
+
+// checkLeaks runs the end-of-suite leak scan and returns the exit code
+// TestMain should use. LEAK_CHECK=off skips the scan, report (the
+// default) only logs, and strict turns any attributed leak into a
+// failing run. Cleanup is partly asynchronous (the API removes objects
+// and Valkey keys after the route row), so the scan is retried until
+// LEAK_CHECK_GRACE elapses before anything is reported.
+func checkLeaks(code int) int {
+	mode := envOrDefault("LEAK_CHECK", leakCheckReport)
+	if mode == leakCheckOff {
+		return code
+	}
+
+	grace, err := time.ParseDuration(envOrDefault("LEAK_CHECK_GRACE", "30s"))
+	if err != nil {
+		log.Warn().Err(err).Msg("leak check: invalid LEAK_CHECK_GRACE")
+		grace = 30 * time.Second
+	}
+
+	ledger := ledgerSnapshot()
+	ctx := context.Background()
+	deadline := time.Now().Add(grace)
+
+	var scan leakScan
+
+	for {
+		scan = scanForLeaks(ctx, ledger)
+		if len(scan.Leaks) == 0 || time.Now().After(deadline) {
+			break
+		}
+
+		time.Sleep(2 * time.Second)
+	}
+
+	reportLeaks(scan, len(ledger))
+
+	if mode == leakCheckStrict && len(scan.Leaks) > 0 && code == 0 {
+		return 1
+	}
+
+	return code
+}
+
+// scanForLeaks checks Valkey, MinIO and Postgres for anything still
+// referring to a resource in ledger.
+func scanForLeaks(
+	ctx context.Context,
+	ledger map[string]trackedResource,
+) leakScan {
+	scan := leakScan{Unattributed: map[string]int{}}
+
+	scan.scanValkey(ctx, ledger)
+	scan.scanMinio(ctx, ledger)
+	scan.scanRoutes(ctx, ledger)
+
+	return scan
+}
+
+// scanValkey looks for image:* keys (other than the result streams)
+// whose trailing ID segment is a tracked image. Keys with a TTL expire
+// on their own and are not leaks: image:upload:{id}, the upload guard,
+// deliberately outlives its image for an hour.
+func (s *leakScan) scanValkey(
+	ctx context.Context,
+	ledger map[string]trackedResource,
+) {
+	client, err := valkeygo.NewClient(valkeygo.ClientOption{
+		InitAddress:  []string{valkeyAddress},
+		DisableCache: true,
+	})
+	if err != nil {
+		s.Errors = append(s.Errors, fmt.Errorf("valkey: %w", err))
+		return
+	}
+	defer client.Close()
+
+	streams := []string{valkey.StreamImageResult, valkey.StreamImageResultDLQ}
+
+	var cursor uint64
+
+	for {
+		entry, err := client.Do(ctx,
+			client.B().Scan().Cursor(cursor).
+				Match("image:*").Count(500).Build(),
+		).AsScanEntry()
+		if err != nil {
+			s.Errors = append(s.Errors, fmt.Errorf("valkey scan: %w", err))
+			return
+		}
+
+		for _, key := range entry.Elements {
+			if slices.Contains(streams, key) {
+				continue
+			}
+
+			id := key[strings.LastIndex(key, ":")+1:]
+
+			res, ok := ledger[id]
+			if !ok {
+				s.Unattributed["valkey"]++
+				continue
+			}
+
+			ttl, err := client.Do(ctx,
+				client.B().Pttl().Key(key).Build(),
+			).AsInt64()
+			if err != nil {
+				s.Errors = append(s.Errors,
+					fmt.Errorf("valkey PTTL %s: %w", key, err),
+				)
+
+				continue
+			}
+
+			// -2: expired since the scan; >= 0: will expire.
+			if ttl != -1 {
+				continue
+			}
+
+			s.Leaks = append(s.Leaks, leak{
+				Store: "valkey", Item: key, Resource: res,
+			})
+		}
+
+		cursor = entry.Cursor
+		if cursor == 0 {
+			return
+		}
+	}
+}
+
+// scanMinio lists every object in the images bucket and attributes
+// objects whose key contains a tracked image or route ID.
+func (s *leakScan) scanMinio(
+	ctx context.Context,
+	ledger map[string]trackedResource,
+) {
+	cfg := minioConfigFromEnv()
+
+	client, err := newMinioClient(cfg)
+	if err != nil {
+		s.Errors = append(s.Errors, err)
+		return
+	}
+
+	var ids []string
+
+	for id, res := range ledger {
+		if res.Kind == resourceImage || res.Kind == resourceRoute {
+			ids = append(ids, id)
+		}
+	}
+
+	for obj := range client.ListObjects(ctx, cfg.Bucket,
+		minio.ListObjectsOptions{Recursive: true},
+	) {
+		if obj.Err != nil {
+			s.Errors = append(s.Errors,
+				fmt.Errorf("minio list %s: %w", cfg.Bucket, obj.Err),
+			)
+			return
+		}
+
+		idx := slices.IndexFunc(ids, func(id string) bool {
+			return strings.Contains(obj.Key, id)
+		})
+		if idx < 0 {
+			s.Unattributed["minio"]++
+			continue
+		}
+
+		s.Leaks = append(s.Leaks, leak{
+			Store: "minio", Item: obj.Key, Resource: ledger[ids[idx]],
+		})
+	}
+}
+
+// scanRoutes looks up every tracked route in the database. Only a
+// missing row counts as gone: the API would answer 401 for a route
+// whose owner's token expired, or whose owner was deleted while the
+// route survived, and that must not hide a leak.
+func (s *leakScan) scanRoutes(
+	ctx context.Context,
+	ledger map[string]trackedResource,
+) {
+	var ids []string
+
+	for id, res := range ledger {
+		if res.Kind == resourceRoute {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 {
+		return
+	}
+
+	db, err := openDBInspector(ctx)
+	if err != nil {
+		s.Errors = append(s.Errors, err)
+		return
+	}
+	defer db.Close()
+
+	var left []string
+
+	err = db.queryRow(ctx,
+		"SELECT coalesce(array_agg(id::text), '{}') FROM "+tableRoutes+
+			" WHERE id = ANY($1::uuid[])",
+		ids,
+	).Scan(&left)
+	if err != nil {
+		s.Errors = append(s.Errors, fmt.Errorf("postgres routes: %w", err))
+		return
+	}
+
+	for _, id := range left {
+		s.Leaks = append(s.Leaks, leak{
+			Store: "postgres", Item: id, Resource: ledger[id],
+		})
+	}
+}
+
+// reportLeaks logs the scan result grouped by the test that created
+// each leaked resource.
+func reportLeaks(scan leakScan, tracked int) {
+	if err := errors.Join(scan.Errors...); err != nil {
+		log.Warn().Err(err).Msg("leak check: some stores were not scanned")
+	}
+
+	byTest := map[string][]leak{}
+	for _, l := range scan.Leaks {
+		byTest[l.Resource.Test] = append(byTest[l.Resource.Test], l)
+	}
+
+	tests := slices.Sorted(maps.Keys(byTest))
+
+	for _, name := range tests {
+		for _, l := range byTest[name] {
+			log.Warn().
+				Str("test", name).
+				Str("store", l.Store).
+				Str("item", l.Item).
+				Str("kind", l.Resource.Kind.String()).
+				Str("resource_id", l.Resource.ID).
+				Msg("leak check: leftover from test")
+		}
+	}
+
+	log.Info().
+		Int("tracked", tracked).
+		Int("leaks", len(scan.Leaks)).
+		Int("leaking_tests", len(tests)).
+		Int("unattributed_valkey", scan.Unattributed["valkey"]).
+		Int("unattributed_minio", scan.Unattributed["minio"]).
+		Msg("leak check complete")
+}
@@ -3,11 +3,18 @@
 package integration_test
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/mail"
 	"net/url"
 	"regexp"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,36 +24,309 @@ import (
 
 var sixDigitCode = regexp.MustCompile(`\b\d{6}\b`)
 
+// defaultSMTPFrom is the sender follow-api uses in the test stack,
+// matching SMTP_FROM in docker-compose.test.yml.
+const defaultSMTPFrom = "noreply@follow.app"
+
+// mailpitAddress is a mailbox as Mailpit reports it.
+type mailpitAddress struct {
+	Name    string `json:"Name"`
+	Address string `json:"Address"`
+}
+
 type mailpitMessageSummary struct {
-	ID string `json:"ID"`
+	ID          string           `json:"ID"`
+	MessageID   string           `json:"MessageID"`
+	From        mailpitAddress   `json:"From"`
+	To          []mailpitAddress `json:"To"`
+	Subject     string           `json:"Subject"`
+	Created     time.Time        `json:"Created"`
+	Attachments int              `json:"Attachments"`
 }
 
 type mailpitSearchResponse struct {
 	Messages []mailpitMessageSummary `json:"messages"`
 }
 
+// mailpitAttachment is an attached or inline part of a message.
+type mailpitAttachment struct {
+	PartID      string `json:"PartID"`
+	FileName    string `json:"FileName"`
+	ContentType string `json:"ContentType"`
+	ContentID   string `json:"ContentID"`
+	Size        int    `json:"Size"`
+}
+
 type mailpitFullMessage struct {
-	ID   string `json:"ID"`
-	Text string `json:"Text"`
-	HTML string `json:"HTML"`
+	ID          string              `json:"ID"`
+	MessageID   string              `json:"MessageID"`
+	From        mailpitAddress      `json:"From"`
+	To          []mailpitAddress    `json:"To"`
+	Subject     string              `json:"Subject"`
+	Date        time.Time           `json:"Date"`
+	Text        string              `json:"Text"`
+	HTML        string              `json:"HTML"`
+	Inline      []mailpitAttachment `json:"Inline"`
+	Attachments []mailpitAttachment `json:"Attachments"`
+}
+
+// mailpitQuery is a Mailpit search. Empty fields are not filtered on.
+type mailpitQuery struct {
+	To      string
+	From    string
+	Subject string
+}
+
+// String renders the query in Mailpit's search syntax.
+func (q mailpitQuery) String() string {
+	var terms []string
+
+	for _, f := range []struct{ key, value string }{
+		{"to", q.To}, {"from", q.From}, {"subject", q.Subject},
+	} {
+		if f.value != "" {
+			terms = append(terms, f.key+":"+quoteSearchTerm(f.value))
+		}
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// quoteSearchTerm wraps values containing spaces in double quotes, as
+// Mailpit's search syntax requires.
+func quoteSearchTerm(v string) string {
+	if strings.ContainsAny(v, " \t") {
+		return `"` + v + `"`
+	}
+
+	return v
+}
+
+// mailpitGet fetches path from the Mailpit API and returns the body.
+func mailpitGet(t *testing.T, path string) []byte {
+	t.Helper()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	resp, err := client.Get(mailpitURL + path)
+	require.NoError(t, err, "mailpit: GET %s", path)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode,
+		"mailpit: GET %s", path,
+	)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err, "mailpit: read %s", path)
+
+	return body
+}
+
+// searchMailpit returns the messages matching q, newest first. Unlike
+// the other mailpit helpers it reports a transport error instead of
+// failing the test, so pollers can retry.
+func searchMailpit(q mailpitQuery) ([]mailpitMessageSummary, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	resp, err := client.Get(mailpitURL + "/api/v1/search?query=" +
+		url.QueryEscape(q.String()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result mailpitSearchResponse
+
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Messages, nil
+}
+
+// waitForMessage polls Mailpit until a message matching q arrives
+// whose ID is not in seen, and returns the newest such message.
+func waitForMessage(
+	t *testing.T,
+	q mailpitQuery,
+	seen ...string,
+) mailpitMessageSummary {
+	t.Helper()
+
+	return waitForMessageWithin(t, q, 10*time.Second, seen...)
+}
+
+// waitForMessageWithin is waitForMessage with a caller-chosen timeout,
+// for mail that only arrives after the API retries delivery.
+func waitForMessageWithin(
+	t *testing.T,
+	q mailpitQuery,
+	timeout time.Duration,
+	seen ...string,
+) mailpitMessageSummary {
+	t.Helper()
+
+	const pollInterval = 250 * time.Millisecond
+
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		msgs, err := searchMailpit(q)
+		if err == nil {
+			for _, m := range msgs {
+				if !slices.Contains(seen, m.ID) {
+					return m
+				}
+			}
+		}
+
+		time.Sleep(pollInterval)
+	}
+
+	t.Fatalf("waitForMessage: no new message for %q within %s",
+		q.String(), timeout,
+	)
+
+	return mailpitMessageSummary{}
+}
+
+// getMessage returns the parsed message with the given Mailpit ID.
+func getMessage(t *testing.T, messageID string) mailpitFullMessage {
+	t.Helper()
+
+	var msg mailpitFullMessage
+
+	err := json.Unmarshal(
+		mailpitGet(t, "/api/v1/message/"+messageID), &msg,
+	)
+	require.NoError(t, err, "getMessage: decode failed")
+
+	return msg
+}
+
+// messageHeaders returns the message's headers as sent.
+func messageHeaders(
+	t *testing.T,
+	messageID string,
+) map[string][]string {
+	t.Helper()
+
+	var headers map[string][]string
+
+	err := json.Unmarshal(
+		mailpitGet(t, "/api/v1/message/"+messageID+"/headers"), &headers,
+	)
+	require.NoError(t, err, "messageHeaders: decode failed")
+
+	return headers
+}
+
+// rawMessage returns the message source as received over SMTP.
+func rawMessage(t *testing.T, messageID string) []byte {
+	t.Helper()
+
+	return mailpitGet(t, "/api/v1/message/"+messageID+"/raw")
+}
+
+// attachmentBytes returns the decoded content of one attachment.
+func attachmentBytes(t *testing.T, messageID, partID string) []byte {
+	t.Helper()
+
+	return mailpitGet(t, "/api/v1/message/"+messageID+"/part/"+partID)
+}
+
+// mimePart is a node of a parsed MIME tree. Leaf bodies are left
+// transfer-encoded; Mailpit's Text and HTML carry the decoded parts.
+type mimePart struct {
+	MediaType string
+	Params    map[string]string
+	Children  []mimePart
+}
+
+// parseMIME parses a raw message into its MIME tree.
+func parseMIME(t *testing.T, raw []byte) mimePart {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	require.NoError(t, err, "parseMIME: not an RFC 5322 message")
+
+	return parseMIMEPart(t, msg.Header.Get("Content-Type"), msg.Body)
+}
+
+func parseMIMEPart(
+	t *testing.T,
+	contentType string,
+	body io.Reader,
+) mimePart {
+	t.Helper()
+
+	if contentType == "" {
+		contentType = "text/plain; charset=us-ascii"
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	require.NoError(t, err, "parseMIME: Content-Type %q", contentType)
+
+	part := mimePart{MediaType: mediaType, Params: params}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return part
+	}
+
+	r := multipart.NewReader(body, params["boundary"])
+
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			return part
+		}
+
+		require.NoError(t, err, "parseMIME: %s part", mediaType)
+		part.Children = append(part.Children,
+			parseMIMEPart(t, p.Header.Get("Content-Type"), p),
+		)
+	}
+}
+
+// find returns the first part in the tree, depth first, with the given
+// media type.
+func (p mimePart) find(mediaType string) (mimePart, bool) {
+	if p.MediaType == mediaType {
+		return p, true
+	}
+
+	for _, c := range p.Children {
+		if found, ok := c.find(mediaType); ok {
+			return found, true
+		}
+	}
+
+	return mimePart{}, false
 }
 
 // uniqueEmail returns a globally unique email address
 // suitable for a single test run.
 func uniqueEmail() string {
-	return fmt.Sprintf(
+	email := fmt.Sprintf(
 		"test-%s@follow-test.com",
 		uuid.New().String()[:8],
 	)
+	recordSecret(secretEmail, email)
+
+	return email
 }
 
-// clearMailbox deletes all messages from Mailpit.
-func clearMailbox(t *testing.T) {
+// clearMailbox deletes the messages addressed to toAddr, so the next
+// waitForEmail for it sees only new mail. Other tests' mail is left
+// alone.
+func clearMailbox(t *testing.T, toAddr string) {
 	t.Helper()
 
 	req, err := http.NewRequest(
 		http.MethodDelete,
-		mailpitURL+"/api/v1/messages",
+		mailpitURL+"/api/v1/search?query="+
+			url.QueryEscape(mailpitQuery{To: toAddr}.String()),
 		nil,
 	)
 	require.NoError(t, err,
@@ -60,6 +340,10 @@ func clearMailbox(t *testing.T) {
 		"clearMailbox: request failed",
 	)
 	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode,
+		"clearMailbox: delete messages to %s", toAddr,
+	)
 }
 
 // waitForEmail polls Mailpit until at least one email
@@ -71,42 +355,7 @@ func waitForEmail(
 ) string {
 	t.Helper()
 
-	const (
-		pollInterval = 250 * time.Millisecond
-		timeout      = 10 * time.Second
-	)
-
-	deadline := time.Now().Add(timeout)
-	searchURL := mailpitURL + "/api/v1/search?query=" +
-		url.QueryEscape("to:"+toAddr)
-
-	client := &http.Client{Timeout: 5 * time.Second}
-
-	for time.Now().Before(deadline) {
-		resp, err := client.Get(searchURL)
-		if err != nil {
-			time.Sleep(pollInterval)
-			continue
-		}
-
-		var result mailpitSearchResponse
-
-		err = json.NewDecoder(resp.Body).Decode(&result)
-		resp.Body.Close()
-
-		if err == nil && len(result.Messages) > 0 {
-			return result.Messages[0].ID
-		}
-
-		time.Sleep(pollInterval)
-	}
-
-	t.Fatalf(
-		"waitForEmail: no email to %s within %s",
-		toAddr, timeout,
-	)
-
-	return ""
+	return waitForMessage(t, mailpitQuery{To: toAddr}).ID
 }
 
 // extractVerificationCode fetches the full message from
@@ -118,26 +367,7 @@ func extractVerificationCode(
 ) string {
 	t.Helper()
 
-	client := &http.Client{Timeout: 5 * time.Second}
-
-	resp, err := client.Get(
-		mailpitURL + "/api/v1/message/" + messageID,
-	)
-	require.NoError(t, err,
-		"extractVerificationCode: request failed",
-	)
-	defer resp.Body.Close()
-
-	require.Equal(t, http.StatusOK, resp.StatusCode,
-		"extractVerificationCode: unexpected status",
-	)
-
-	var msg mailpitFullMessage
-
-	err = json.NewDecoder(resp.Body).Decode(&msg)
-	require.NoError(t, err,
-		"extractVerificationCode: decode failed",
-	)
+	msg := getMessage(t, messageID)
 
 	body := msg.Text
 	if body == "" {
@@ -154,6 +384,8 @@ func extractVerificationCode(
 			"no 6-digit code in email body",
 	)
 
+	recordSecret(secretVerificationCode, code)
+
 	return code
 }
 
@@ -166,28 +398,18 @@ func noEmailWithin(
 ) {
 	t.Helper()
 
-	searchURL := mailpitURL + "/api/v1/search?query=" +
-		url.QueryEscape("to:"+toAddr)
-
-	client := &http.Client{Timeout: 5 * time.Second}
 	deadline := time.Now().Add(wait)
 
 	for time.Now().Before(deadline) {
-		resp, err := client.Get(searchURL)
+		msgs, err := searchMailpit(mailpitQuery{To: toAddr})
 		if err != nil {
 			time.Sleep(250 * time.Millisecond)
 			continue
 		}
 
-		var result mailpitSearchResponse
-
-		err = json.NewDecoder(resp.Body).Decode(&result)
-		resp.Body.Close()
-
-		require.NoError(t, err)
-		require.Empty(t, result.Messages,
+		require.Empty(t, msgs,
 			"expected no email to %s but found %d",
-			toAddr, len(result.Messages),
+			toAddr, len(msgs),
 		)
 
 		time.Sleep(250 * time.Millisecond)
@@ -4,6 +4,7 @@ package integration_test
 
 import (
 	"context"
+	"flag"
 	"io"
 	"net/http"
 	"net/url"
@@ -56,26 +57,82 @@ func TestMain(m *testing.M) {
 
 	mode := envOrDefault("INTEGRATION_TEST_MODE", "local")
 
+	// A -fuzz run forks worker processes that re-enter TestMain. The
+	// parent already owns the stack, so a worker only resolves the
+	// service addresses and must not start, check or tear down anything.
+	if isFuzzWorker() {
+		attachFuzzWorker(mode)
+		os.Exit(m.Run())
+	}
+
+	installSecretScan()
+	installReporter()
+	configureIsolation()
+	configureSelection()
+
 	switch mode {
-	case "docker":
+	case "docker", "proxy":
 		setupDocker()
 	default:
 		setupLocal()
 	}
 
 	code := m.Run()
+	printManifest()
+	writeTestReports()
+
+	// Scan for leftovers while the services are still up.
+	code = checkLeaks(code)
+	reportCascadeWindows()
+
+	stopContainerLogs()
+
+	code = checkSecretLeaks(context.Background(), code)
 
 	switch mode {
-	case "docker":
+	case "docker", "proxy":
 		teardownDocker()
 	default:
 		teardownLocal()
 	}
 
+	stopFakeOIDC()
+
 	os.Exit(code)
 }
 
-func setupLocal() {
+// isFuzzWorker reports whether this process is a fuzzing worker
+// started by the go test coordinator.
+func isFuzzWorker() bool {
+	flag.Parse()
+
+	f := flag.Lookup("test.fuzzworker")
+
+	return f != nil && f.Value.String() == "true"
+}
+
+// attachFuzzWorker points a fuzzing worker at the stack its parent
+// started.
+func attachFuzzWorker(mode string) {
+	switch mode {
+	case "docker", "proxy":
+		envMap, err := godotenv.Read(".env")
+		if err != nil {
+			log.Error().Err(err).Msg(
+				"failed to read tests/integration/.env",
+			)
+			os.Exit(1)
+		}
+
+		setDockerServiceURLs(envMap)
+	default:
+		setLocalServiceURLs()
+	}
+}
+
+// setLocalServiceURLs resolves the local-mode service addresses from
+// the environment.
+func setLocalServiceURLs() {
 	valkeyAddress = envOrDefault(
 		"VALKEY_ADDRESS",
 		"localhost:6379",
@@ -89,6 +146,10 @@ func setupLocal() {
 		"MAILPIT_URL",
 		"http://localhost:8025",
 	)
+}
+
+func setupLocal() {
+	setLocalServiceURLs()
 
 	apiPort := portFromURL(apiURL, "8085")
 	gatewayPort := portFromURL(gatewayURL, "8095")
@@ -103,6 +164,21 @@ func setupLocal() {
 
 	waitForValkey(valkeyAddress)
 	cleanValkeyStreams(valkeyAddress)
+	startFakeOIDC("local")
+
+	// Unless told to use a Mailpit install, capture mail in process:
+	// follow-api sends to the embedded server, and the Mailpit helpers
+	// read from its Mailpit-compatible API.
+	if useEmbeddedSMTP() {
+		smtpCapture, err = startSMTPCapture()
+		if err != nil {
+			log.Error().Err(err).Msg("failed to start SMTP capture")
+			os.Exit(1)
+		}
+
+		localSMTPPort = smtpCapture.Port()
+		mailpitURL = smtpCapture.URL
+	}
 
 	log.Info().
 		Str("dir", gatewayDir).
@@ -199,6 +275,13 @@ func setupDocker() {
 		}
 	}
 
+	// Proxy mode puts Caddy in front of the stack.
+	if proxyMode() {
+		composeFiles = append(composeFiles,
+			filepath.Join(projectRoot, caddyComposeFile),
+		)
+	}
+
 	// Load tests/integration/.env into the process environment.
 	// This is the single source of truth for docker-mode config:
 	// test-only credentials, port overrides (25xxx/26xxx/28xxx/29xxx
@@ -225,6 +308,10 @@ func setupDocker() {
 		}
 	}
 
+	// The API container fetches the fake OIDC keys from the host, so
+	// the server must be up (on FAKE_OIDC_PORT from .env) first.
+	startFakeOIDC("docker")
+
 	// Use a stable StackIdentifier so every run shares the same
 	// compose project name. Without this, tc-go generates a fresh
 	// UUID per NewDockerCompose call and containers from a crashed
@@ -277,11 +364,13 @@ func setupDocker() {
 	// hard-coding values in two places. HOST_IP is normally "localhost"
 	// in the test .env but can be pointed at a LAN IP (e.g. for remote
 	// debugging from another machine) by editing .env alone.
-	hostIP := envMap["HOST_IP"]
-	valkeyAddress = hostIP + ":" + envMap["VALKEY_HOST_PORT"]
-	apiURL = "http://" + hostIP + ":" + envMap["API_HOST_PORT"]
-	gatewayURL = "http://" + hostIP + ":" + envMap["GATEWAY_HOST_PORT"]
-	mailpitURL = "http://" + hostIP + ":" + envMap["MAILPIT_API_HOST_PORT"]
+	setDockerServiceURLs(envMap)
+
+	if proxyMode() {
+		trustCaddyRoot(ctx)
+	}
+
+	followContainerLogs(ctx)
 
 	// Match setupLocal: wipe any stale image:result / image:result:dlq
 	// streams so the API consumer group starts with a fresh watermark.
@@ -298,6 +387,21 @@ func setupDocker() {
 		Msg("docker mode setup complete")
 }
 
+// setDockerServiceURLs builds the host-side service addresses from
+// HOST_IP and the *_HOST_PORT values in .env. In proxy mode the API and
+// gateway addresses are then swapped for Caddy's.
+func setDockerServiceURLs(envMap map[string]string) {
+	hostIP := envMap["HOST_IP"]
+	valkeyAddress = hostIP + ":" + envMap["VALKEY_HOST_PORT"]
+	apiURL = "http://" + hostIP + ":" + envMap["API_HOST_PORT"]
+	gatewayURL = "http://" + hostIP + ":" + envMap["GATEWAY_HOST_PORT"]
+	mailpitURL = "http://" + hostIP + ":" + envMap["MAILPIT_API_HOST_PORT"]
+
+	if proxyMode() {
+		setProxyServiceURLs(envMap)
+	}
+}
+
 func teardownLocal() {
 	killProcessGroup("follow-api", apiProcess, apiDrainWait)
 	killProcessGroup(
@@ -305,6 +409,10 @@ func teardownLocal() {
 		gatewayProcess,
 		gatewayDrainWait,
 	)
+
+	if smtpCapture != nil {
+		smtpCapture.Close()
+	}
 }
 
 func teardownDocker() {
@@ -345,18 +453,21 @@ func pipeOutput(cmd *exec.Cmd) func() {
 		os.Exit(1)
 	}
 
+	// Output is also kept for the end-of-suite secret scan.
+	logs := serviceLogWriter(filepath.Base(cmd.Dir))
+
 	var wg sync.WaitGroup
 
 	wg.Add(2)
 
 	go func() {
 		defer wg.Done()
-		_, _ = io.Copy(os.Stdout, stdoutPipe)
+		_, _ = io.Copy(io.MultiWriter(os.Stdout, logs), stdoutPipe)
 	}()
 
 	go func() {
 		defer wg.Done()
-		_, _ = io.Copy(os.Stderr, stderrPipe)
+		_, _ = io.Copy(io.MultiWriter(os.Stderr, logs), stderrPipe)
 	}()
 
 	return wg.Wait
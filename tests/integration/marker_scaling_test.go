@@ -0,0 +1,232 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/webp"
+)
+
+// Colours of the marker target images. The target is saturated red on a
+// neutral grey so it survives JPEG and WebP re-encoding unambiguously.
+var (
+	markerTargetColor     = color.RGBA{R: 220, G: 30, B: 30, A: 255}
+	markerBackgroundColor = color.RGBA{R: 128, G: 128, B: 128, A: 255}
+)
+
+// markerScalingCase is one upload whose marker must keep pointing at the
+// same visual feature after processing.
+type markerScalingCase struct {
+	Name string
+	// DisplayW x DisplayH is the image as a viewer sees it, i.e. after
+	// EXIF orientation is applied. The marker is given in this frame.
+	DisplayW int
+	DisplayH int
+	// Orientation is the EXIF orientation tag written to the upload
+	// (1 = upright, 3 = 180°, 6 = 90° CW, 8 = 90° CCW).
+	Orientation uint16
+	MarkerX     float64
+	MarkerY     float64
+}
+
+// markerScalingCases spans both sides of the section 8.1 resize threshold
+// in landscape, portrait and EXIF-rotated forms. Markers sit well away
+// from the centre and the diagonals so a mirrored, rotated or otherwise
+// misplaced marker lands on background, not on the target.
+func markerScalingCases(maxWidth int) []markerScalingCase {
+	return []markerScalingCase{
+		{"LandscapeBelowThreshold", 1200, 800, 1, 0.25, 0.70},
+		{"LandscapeAtThreshold", maxWidth, maxWidth * 9 / 16, 1, 0.80, 0.30},
+		{"LandscapeAboveThreshold", 3000, 2000, 1, 0.15, 0.35},
+		{"PortraitBelowThreshold", 900, 1600, 1, 0.70, 0.20},
+		{"PortraitAboveThreshold", 2400, 3200, 1, 0.30, 0.85},
+		{"Rotated90CWBelowThreshold", 1600, 1200, 6, 0.20, 0.75},
+		{"Rotated90CWAboveThreshold", 3000, 2000, 6, 0.85, 0.25},
+		{"Rotated90CCWPortrait", 1000, 1500, 8, 0.75, 0.15},
+		{"Rotated180AboveThreshold", 2800, 1600, 3, 0.10, 0.20},
+	}
+}
+
+// TestMarkerScaling_MarkersTrackVisualLocation uploads images with a red
+// target drawn at a known position, places the waypoint marker on that
+// target, and after processing checks that the marker returned by
+// GET /routes/{id} still lands on the target in the processed WebP.
+//
+// Markers are normalised to [0,1], and the gateway never crops, so under
+// the section 8.2 invariant (scale_x == scale_y) the stored marker must
+// equal the submitted one to within a processed pixel.
+func TestMarkerScaling_MarkersTrackVisualLocation(t *testing.T) {
+	isolate(t, isolationParallel, labelSlow)
+	shareState(t, stateImageResults)
+
+	_, token, _ := createAnonymousUser(t)
+	vc := newValkeyClient(t)
+
+	for _, tc := range markerScalingCases(gatewayMaxImageWidth(t)) {
+		t.Run(tc.Name, func(t *testing.T) {
+			payload := markerTargetJPEG(t, tc)
+
+			wpBody := buildWaypointBody(0, tc.Name+".jpg", len(payload))
+			wpBody["marker_x"] = tc.MarkerX
+			wpBody["marker_y"] = tc.MarkerY
+
+			routeID, imageID, _ := uploadAndProcess(t, vc, token,
+				wpBody, payload,
+			)
+
+			wp := routeWaypoint(t, routeID, token, imageID)
+			markerX, _ := wp["marker_x"].(float64)
+			markerY, _ := wp["marker_y"].(float64)
+
+			navURL, _ := wp["navigation_image_url"].(string)
+			require.NotEmpty(t, navURL,
+				"waypoint must expose navigation_image_url",
+			)
+
+			img := fetchProcessedImage(t, navURL)
+			assertMarkerOnTarget(t, tc, img, markerX, markerY)
+		})
+	}
+}
+
+// assertMarkerOnTarget checks the processed image is in display
+// orientation, the stored marker matches the submitted one, and the
+// pixel under the stored marker is the red target.
+func assertMarkerOnTarget(
+	t *testing.T,
+	tc markerScalingCase,
+	img processedImage,
+	markerX float64,
+	markerY float64,
+) {
+	t.Helper()
+
+	assert.Equalf(t,
+		tc.DisplayW > tc.DisplayH, img.Width > img.Height,
+		"processed %dx%d is not in display orientation %dx%d "+
+			"(EXIF orientation %d not applied?)",
+		img.Width, img.Height, tc.DisplayW, tc.DisplayH, tc.Orientation,
+	)
+
+	tolX := 1/float64(img.Width) + 0.001
+	tolY := 1/float64(img.Height) + 0.001
+
+	assert.InDeltaf(t, tc.MarkerX, markerX, tolX,
+		"marker_x drifted after processing to %dx%d",
+		img.Width, img.Height,
+	)
+	assert.InDeltaf(t, tc.MarkerY, markerY, tolY,
+		"marker_y drifted after processing to %dx%d",
+		img.Width, img.Height,
+	)
+
+	decoded, err := webp.Decode(bytes.NewReader(img.Bytes))
+	require.NoError(t, err, "processed image must decode")
+
+	px := int(markerX * float64(img.Width))
+	py := int(markerY * float64(img.Height))
+	px = min(max(px, 0), img.Width-1)
+	py = min(max(py, 0), img.Height-1)
+
+	r, g, b, _ := decoded.At(px, py).RGBA()
+	assert.Truef(t, isMarkerTarget(r>>8, g>>8, b>>8),
+		"pixel (%d,%d) under marker (%.4f,%.4f) is rgb(%d,%d,%d), "+
+			"not the target",
+		px, py, markerX, markerY, r>>8, g>>8, b>>8,
+	)
+}
+
+// isMarkerTarget reports whether an 8-bit RGB sample is close enough to
+// markerTargetColor to be the target after lossy re-encoding.
+func isMarkerTarget(r, g, b uint32) bool {
+	return r > 170 && g < 90 && b < 90
+}
+
+// markerTargetJPEG draws a DisplayW x DisplayH grey canvas with a red
+// disc centred on the case's marker, stores it rotated so that applying
+// the EXIF orientation restores the display frame, and returns it as a
+// JPEG carrying that orientation tag.
+func markerTargetJPEG(t *testing.T, tc markerScalingCase) []byte {
+	t.Helper()
+
+	display := image.NewRGBA(image.Rect(0, 0, tc.DisplayW, tc.DisplayH))
+	draw.Draw(
+		display, display.Bounds(),
+		&image.Uniform{C: markerBackgroundColor}, image.Point{}, draw.Src,
+	)
+
+	cx := int(tc.MarkerX * float64(tc.DisplayW))
+	cy := int(tc.MarkerY * float64(tc.DisplayH))
+	radius := min(tc.DisplayW, tc.DisplayH) / 12
+
+	for y := cy - radius; y <= cy+radius; y++ {
+		for x := cx - radius; x <= cx+radius; x++ {
+			dx, dy := x-cx, y-cy
+			if dx*dx+dy*dy <= radius*radius {
+				display.SetRGBA(x, y, markerTargetColor)
+			}
+		}
+	}
+
+	stored := storeForOrientation(display, tc.Orientation)
+
+	var buf bytes.Buffer
+
+	err := jpeg.Encode(&buf, stored, &jpeg.Options{Quality: 90})
+	require.NoError(t, err, "markerTargetJPEG: encode failed")
+
+	return withRichMetadata(t, buf.Bytes(), tc.Orientation)
+}
+
+// storeForOrientation returns the pixel layout a camera would store for
+// an image that displays as display under the given EXIF orientation,
+// i.e. the inverse of the orientation transform.
+func storeForOrientation(
+	display *image.RGBA,
+	orientation uint16,
+) *image.RGBA {
+	w, h := display.Bounds().Dx(), display.Bounds().Dy()
+
+	switch orientation {
+	case 3:
+		// Displayed = stored rotated 180°.
+		stored := image.NewRGBA(image.Rect(0, 0, w, h))
+		for sy := range h {
+			for sx := range w {
+				stored.SetRGBA(sx, sy, display.RGBAAt(w-1-sx, h-1-sy))
+			}
+		}
+
+		return stored
+	case 6:
+		// Displayed = stored rotated 90° CW; stored is h x w.
+		stored := image.NewRGBA(image.Rect(0, 0, h, w))
+		for sy := range w {
+			for sx := range h {
+				stored.SetRGBA(sx, sy, display.RGBAAt(w-1-sy, sx))
+			}
+		}
+
+		return stored
+	case 8:
+		// Displayed = stored rotated 90° CCW; stored is h x w.
+		stored := image.NewRGBA(image.Rect(0, 0, h, w))
+		for sy := range w {
+			for sx := range h {
+				stored.SetRGBA(sx, sy, display.RGBAAt(sy, h-1-sx))
+			}
+		}
+
+		return stored
+	default:
+		return display
+	}
+}
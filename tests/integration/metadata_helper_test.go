@@ -0,0 +1,430 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Identifying values planted in the metadata of generated test images.
+// None of them may appear anywhere in a processed output.
+const (
+	privacyCameraMake   = "FollowPrivacyCam"
+	privacyCameraModel  = "PrivacyProbe X1"
+	privacySerialNumber = "SN-PRIVACY-48213"
+	privacyDateTime     = "2024:03:14 09:26:53"
+	privacyAuthor       = "Dr. Privacy Probe"
+	privacyCity         = "Privacy Ward Tel Aviv"
+	privacyGPSText      = "32,4.9121N"
+)
+
+// privacyMarkers lists every planted value plus the container signatures
+// of the metadata formats themselves.
+var privacyMarkers = []string{
+	privacyCameraMake,
+	privacyCameraModel,
+	privacySerialNumber,
+	privacyDateTime,
+	privacyAuthor,
+	privacyCity,
+	privacyGPSText,
+	"Exif\x00\x00",
+	"http://ns.adobe.com/xap/1.0/",
+	"<x:xmpmeta",
+	"Photoshop 3.0",
+	"8BIM",
+}
+
+// allowedWebPChunks are the RIFF chunks a processed image may contain.
+// EXIF and XMP are the metadata chunks the gateway must drop; anything
+// unknown is rejected too since it could smuggle the same data.
+var allowedWebPChunks = map[string]bool{
+	"VP8 ": true,
+	"VP8L": true,
+	"VP8X": true,
+	"ALPH": true,
+	"ICCP": true,
+	"ANIM": true,
+	"ANMF": true,
+}
+
+// VP8X feature flags announcing metadata chunks (WebP container spec).
+const (
+	vp8xFlagXMP  = 0x04
+	vp8xFlagEXIF = 0x08
+)
+
+// webpChunk is one top-level chunk of a WebP RIFF container.
+type webpChunk struct {
+	FourCC string
+	Data   []byte
+}
+
+// parseWebPChunks splits a WebP file into its top-level RIFF chunks.
+// Calls t.Fatal if the container framing is malformed.
+func parseWebPChunks(t *testing.T, data []byte) []webpChunk {
+	t.Helper()
+
+	require.GreaterOrEqual(t, len(data), 12,
+		"parseWebPChunks: file shorter than RIFF header",
+	)
+	require.Equal(t, "RIFF", string(data[0:4]),
+		"parseWebPChunks: missing RIFF signature",
+	)
+	require.Equal(t, "WEBP", string(data[8:12]),
+		"parseWebPChunks: missing WEBP form type",
+	)
+
+	var chunks []webpChunk
+
+	rest := data[12:]
+	for len(rest) > 0 {
+		require.GreaterOrEqual(t, len(rest), 8,
+			"parseWebPChunks: truncated chunk header",
+		)
+
+		fourCC := string(rest[0:4])
+		size := int(binary.LittleEndian.Uint32(rest[4:8]))
+		require.LessOrEqualf(t, size, len(rest)-8,
+			"parseWebPChunks: chunk %q overruns file", fourCC,
+		)
+
+		chunks = append(chunks, webpChunk{
+			FourCC: fourCC,
+			Data:   rest[8 : 8+size],
+		})
+
+		// Chunk payloads are padded to an even length.
+		next := 8 + size + size%2
+		if next > len(rest) {
+			break
+		}
+
+		rest = rest[next:]
+	}
+
+	return chunks
+}
+
+// assertNoIdentifyingMetadata fails the test if a processed WebP carries
+// any metadata chunk, announces one in its VP8X flags, or contains any
+// of the privacyMarkers anywhere in its bytes. label identifies the image
+// in failure messages.
+func assertNoIdentifyingMetadata(
+	t *testing.T,
+	data []byte,
+	label string,
+) {
+	t.Helper()
+
+	for _, chunk := range parseWebPChunks(t, data) {
+		assert.Truef(t, allowedWebPChunks[chunk.FourCC],
+			"%s: processed WebP carries %q chunk (%d bytes)",
+			label, chunk.FourCC, len(chunk.Data),
+		)
+
+		if chunk.FourCC == "VP8X" && len(chunk.Data) > 0 {
+			flags := chunk.Data[0]
+			assert.Zerof(t, flags&vp8xFlagEXIF,
+				"%s: VP8X announces an EXIF chunk", label,
+			)
+			assert.Zerof(t, flags&vp8xFlagXMP,
+				"%s: VP8X announces an XMP chunk", label,
+			)
+		}
+	}
+
+	for _, marker := range privacyMarkers {
+		assert.Falsef(t, bytes.Contains(data, []byte(marker)),
+			"%s: processed WebP contains %q", label, marker,
+		)
+	}
+}
+
+// assertRouteImagesStripped downloads the processed image of every
+// waypoint on routeID and runs assertNoIdentifyingMetadata on each.
+func assertRouteImagesStripped(
+	t *testing.T,
+	routeID string,
+	authToken string,
+) {
+	t.Helper()
+
+	resp := doRequest(
+		t,
+		http.MethodGet,
+		apiURL+"/api/v1/routes/"+routeID+"?include_images=true",
+		nil,
+		authToken,
+	)
+	require.Equal(t, http.StatusOK, resp.StatusCode,
+		"assertRouteImagesStripped: expected 200 from GET route",
+	)
+
+	body := decodeJSON(t, resp)
+	waypoints, _ := body["waypoints"].([]any)
+
+	for _, raw := range waypoints {
+		wp, _ := raw.(map[string]any)
+
+		u, _ := wp["navigation_image_url"].(string)
+		require.NotEmptyf(t, u,
+			"assertRouteImagesStripped: image %v has no URL",
+			wp["image_id"],
+		)
+
+		assertNoIdentifyingMetadata(
+			t, downloadURL(t, u),
+			fmt.Sprintf("image %v", wp["image_id"]),
+		)
+	}
+}
+
+// withRichMetadata returns a copy of the JPEG base carrying the kind of
+// metadata a phone camera writes: an EXIF block with camera make/model,
+// body serial, capture time, orientation and a GPS position; an XMP
+// packet repeating the GPS position and author; and a Photoshop/IPTC
+// block with by-line and city. The segments are inserted right after
+// SOI. Every identifying value is one of the privacy* constants.
+func withRichMetadata(
+	t *testing.T,
+	base []byte,
+	orientation uint16,
+) []byte {
+	t.Helper()
+
+	require.Equal(t, []byte{0xFF, 0xD8}, base[:2],
+		"withRichMetadata: base image lacks JPEG SOI",
+	)
+
+	var out bytes.Buffer
+
+	out.Write(base[:2])
+	out.Write(jpegSegment(0xE1, append(
+		[]byte("Exif\x00\x00"), exifTIFF(orientation)...,
+	)))
+	out.Write(jpegSegment(0xE1, append(
+		[]byte("http://ns.adobe.com/xap/1.0/\x00"), xmpPacket()...,
+	)))
+	out.Write(jpegSegment(0xED, photoshopIPTC()))
+	out.Write(base[2:])
+
+	return out.Bytes()
+}
+
+// jpegSegment frames payload as a JPEG APPn marker segment.
+func jpegSegment(marker byte, payload []byte) []byte {
+	seg := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+
+	return append(seg, payload...)
+}
+
+// TIFF field types used by the EXIF encoder.
+const (
+	tiffByte     = 1
+	tiffASCII    = 2
+	tiffShort    = 3
+	tiffLong     = 4
+	tiffRational = 5
+)
+
+// tiffEntry is one IFD entry with its value already encoded
+// little-endian.
+type tiffEntry struct {
+	Tag   uint16
+	Type  uint16
+	Count uint32
+	Data  []byte
+}
+
+// tiffASCIIEntry encodes s as a NUL-terminated ASCII value.
+func tiffASCIIEntry(tag uint16, s string) tiffEntry {
+	return tiffEntry{
+		Tag:   tag,
+		Type:  tiffASCII,
+		Count: uint32(len(s) + 1),
+		Data:  []byte(s + "\x00"),
+	}
+}
+
+// tiffShortEntry encodes a single SHORT value.
+func tiffShortEntry(tag, v uint16) tiffEntry {
+	return tiffEntry{
+		Tag:   tag,
+		Type:  tiffShort,
+		Count: 1,
+		Data:  binary.LittleEndian.AppendUint16(nil, v),
+	}
+}
+
+// tiffLongEntry encodes a single LONG value.
+func tiffLongEntry(tag uint16, v uint32) tiffEntry {
+	return tiffEntry{
+		Tag:   tag,
+		Type:  tiffLong,
+		Count: 1,
+		Data:  binary.LittleEndian.AppendUint32(nil, v),
+	}
+}
+
+// tiffRationalEntry encodes num/den pairs as a RATIONAL array.
+func tiffRationalEntry(tag uint16, pairs ...uint32) tiffEntry {
+	var data []byte
+	for _, v := range pairs {
+		data = binary.LittleEndian.AppendUint32(data, v)
+	}
+
+	return tiffEntry{
+		Tag:   tag,
+		Type:  tiffRational,
+		Count: uint32(len(pairs) / 2),
+		Data:  data,
+	}
+}
+
+// tiffIFDLen returns the encoded size of an IFD including its
+// out-of-line value area.
+func tiffIFDLen(entries []tiffEntry) int {
+	n := 2 + 12*len(entries) + 4
+	for _, e := range entries {
+		if len(e.Data) > 4 {
+			n += len(e.Data) + len(e.Data)%2
+		}
+	}
+
+	return n
+}
+
+// encodeTIFFIFD encodes entries as an IFD located at offset within the
+// TIFF stream, with values larger than 4 bytes stored right after it.
+func encodeTIFFIFD(entries []tiffEntry, offset int) []byte {
+	le := binary.LittleEndian
+	dataOff := offset + 2 + 12*len(entries) + 4
+
+	var dir, data []byte
+
+	dir = le.AppendUint16(dir, uint16(len(entries)))
+	for _, e := range entries {
+		dir = le.AppendUint16(dir, e.Tag)
+		dir = le.AppendUint16(dir, e.Type)
+		dir = le.AppendUint32(dir, e.Count)
+
+		if len(e.Data) <= 4 {
+			inline := make([]byte, 4)
+			copy(inline, e.Data)
+			dir = append(dir, inline...)
+
+			continue
+		}
+
+		dir = le.AppendUint32(dir, uint32(dataOff+len(data)))
+		data = append(data, e.Data...)
+
+		if len(e.Data)%2 == 1 {
+			data = append(data, 0)
+		}
+	}
+
+	dir = le.AppendUint32(dir, 0) // no next IFD
+
+	return append(dir, data...)
+}
+
+// exifTIFF builds a little-endian TIFF stream with IFD0, an Exif sub-IFD
+// and a GPS sub-IFD (32°4'54.7"N 34°46'52.3"E).
+func exifTIFF(orientation uint16) []byte {
+	const ifd0Off = 8
+
+	exifIFD := []tiffEntry{
+		tiffASCIIEntry(0x9003, privacyDateTime),     // DateTimeOriginal
+		tiffASCIIEntry(0xA431, privacySerialNumber), // BodySerialNumber
+	}
+	gpsIFD := []tiffEntry{
+		// GPSVersionID 2.3.0.0
+		{Tag: 0x0000, Type: tiffByte, Count: 4, Data: []byte{2, 3, 0, 0}},
+		tiffASCIIEntry(0x0001, "N"),
+		tiffRationalEntry(0x0002, 32, 1, 4, 1, 547, 10),
+		tiffASCIIEntry(0x0003, "E"),
+		tiffRationalEntry(0x0004, 34, 1, 46, 1, 523, 10),
+	}
+	ifd0 := []tiffEntry{
+		tiffASCIIEntry(0x010F, privacyCameraMake),
+		tiffASCIIEntry(0x0110, privacyCameraModel),
+		tiffShortEntry(0x0112, orientation),
+		tiffASCIIEntry(0x0132, privacyDateTime),
+		tiffLongEntry(0x8769, 0), // ExifIFDPointer, patched below
+		tiffLongEntry(0x8825, 0), // GPSInfoIFDPointer, patched below
+	}
+
+	exifOff := ifd0Off + tiffIFDLen(ifd0)
+	gpsOff := exifOff + tiffIFDLen(exifIFD)
+	ifd0[4] = tiffLongEntry(0x8769, uint32(exifOff))
+	ifd0[5] = tiffLongEntry(0x8825, uint32(gpsOff))
+
+	out := []byte{'I', 'I', 42, 0}
+	out = binary.LittleEndian.AppendUint32(out, ifd0Off)
+	out = append(out, encodeTIFFIFD(ifd0, ifd0Off)...)
+	out = append(out, encodeTIFFIFD(exifIFD, exifOff)...)
+	out = append(out, encodeTIFFIFD(gpsIFD, gpsOff)...)
+
+	return out
+}
+
+// xmpPacket returns an XMP packet with GPS, camera and author
+// properties.
+func xmpPacket() []byte {
+	return []byte(`<?xpacket begin="` + "\uFEFF" +
+		`" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:exif="http://ns.adobe.com/exif/1.0/"
+    xmlns:tiff="http://ns.adobe.com/tiff/1.0/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    exif:GPSLatitude="` + privacyGPSText + `"
+    exif:GPSLongitude="34,46.8717E"
+    tiff:Make="` + privacyCameraMake + `"
+    tiff:Model="` + privacyCameraModel + `">
+   <dc:creator><rdf:Seq><rdf:li>` + privacyAuthor +
+		`</rdf:li></rdf:Seq></dc:creator>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`)
+}
+
+// photoshopIPTC returns an APP13 payload holding a Photoshop image
+// resource block with IPTC-IIM by-line (2:80) and city (2:90) records.
+func photoshopIPTC() []byte {
+	iptcRecord := func(dataset byte, value string) []byte {
+		rec := []byte{0x1C, 2, dataset, 0, 0}
+		binary.BigEndian.PutUint16(rec[3:], uint16(len(value)))
+
+		return append(rec, value...)
+	}
+
+	var iptc []byte
+	iptc = append(iptc, iptcRecord(80, privacyAuthor)...)
+	iptc = append(iptc, iptcRecord(90, privacyCity)...)
+
+	out := []byte("Photoshop 3.0\x00")
+	out = append(out, "8BIM"...)
+	out = binary.BigEndian.AppendUint16(out, 0x0404) // IPTC-NAA resource
+	out = append(out, 0, 0)                          // empty Pascal name
+	out = binary.BigEndian.AppendUint32(out, uint32(len(iptc)))
+	out = append(out, iptc...)
+
+	if len(iptc)%2 == 1 {
+		out = append(out, 0)
+	}
+
+	return out
+}
@@ -0,0 +1,98 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// metadataPrivacyCase is one upload carrying identifying metadata.
+type metadataPrivacyCase struct {
+	Name  string
+	Build func(t *testing.T) []byte
+}
+
+// metadataPrivacyCases pairs real photos and generated images with the
+// full EXIF/GPS/XMP/IPTC block. The EXIF orientation and the size vary
+// so both the resize and the no-resize encode paths, and any
+// orientation handling, are covered.
+func metadataPrivacyCases() []metadataPrivacyCase {
+	cases := []metadataPrivacyCase{
+		{
+			Name: "GeneratedLandscape",
+			Build: func(t *testing.T) []byte {
+				return withRichMetadata(t, jpegBytes(t, 1200, 900), 1)
+			},
+		},
+		{
+			Name: "GeneratedPortrait",
+			Build: func(t *testing.T) []byte {
+				return withRichMetadata(t, jpegBytes(t, 900, 1200), 1)
+			},
+		},
+		{
+			Name: "GeneratedRotated90CW",
+			Build: func(t *testing.T) []byte {
+				return withRichMetadata(t, jpegBytes(t, 1200, 900), 6)
+			},
+		},
+		{
+			Name: "GeneratedOversized",
+			Build: func(t *testing.T) []byte {
+				return withRichMetadata(t, jpegBytes(t, 2600, 1400), 1)
+			},
+		},
+	}
+
+	for _, spec := range defaultTestImages {
+		filename := spec.Filename
+		cases = append(cases, metadataPrivacyCase{
+			Name: "Photo_" + filename,
+			Build: func(t *testing.T) []byte {
+				return withRichMetadata(t, loadTestImage(t, filename), 1)
+			},
+		})
+	}
+
+	return cases
+}
+
+// TestMetadataPrivacy_ProcessedImagesAreStripped uploads images whose
+// originals carry GPS coordinates, device serials, capture timestamps
+// and author/location fields, then downloads every processed output and
+// fails if any metadata chunk or identifying value survived.
+func TestMetadataPrivacy_ProcessedImagesAreStripped(t *testing.T) {
+	isolate(t, isolationParallel, labelSecurity)
+	shareState(t, stateImageResults)
+
+	_, token, _ := createAnonymousUser(t)
+	vc := newValkeyClient(t)
+
+	for _, tc := range metadataPrivacyCases() {
+		t.Run(tc.Name, func(t *testing.T) {
+			payload := tc.Build(t)
+
+			// Guard against a vacuous pass: the upload itself must
+			// carry every planted value.
+			for _, marker := range privacyMarkers {
+				require.Truef(t,
+					bytes.Contains(payload, []byte(marker)),
+					"test input is missing planted marker %q", marker,
+				)
+			}
+
+			routeID, imageID, _ := uploadAndProcess(t, vc, token,
+				buildWaypointBody(0, tc.Name+".jpg", len(payload)),
+				payload,
+			)
+
+			img := fetchProcessedImage(
+				t, waypointImageURL(t, routeID, token, imageID),
+			)
+			assertNoIdentifyingMetadata(t, img.Bytes, tc.Name)
+		})
+	}
+}
@@ -0,0 +1,181 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// scrapeMetrics fetches {baseURL}/metrics and parses the Prometheus text
+// exposition format into a map keyed by the full series name, labels
+// included (e.g. `follow_gateway_pipeline_jobs_completed_total{status="failed"}`).
+// Comment lines and unparsable samples are skipped.
+func scrapeMetrics(t *testing.T, baseURL string) map[string]float64 {
+	t.Helper()
+
+	samples, err := fetchMetrics(baseURL)
+	require.NoError(t, err, "scrapeMetrics")
+
+	return samples
+}
+
+// fetchMetrics is scrapeMetrics for callers without a *testing.T, such
+// as a background sampler.
+func fetchMetrics(baseURL string) (map[string]float64, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	resp, err := client.Get(baseURL + "/metrics")
+	if err != nil {
+		return nil, fmt.Errorf("GET %s/metrics: %w", baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s/metrics: status %d",
+			baseURL, resp.StatusCode,
+		)
+	}
+
+	samples := make(map[string]float64)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// The value is the last space-separated field unless a
+		// timestamp follows it; label values never contain a bare
+		// space after the closing brace.
+		series, rest, ok := cutSeries(line)
+		if !ok {
+			continue
+		}
+
+		valueStr, _, _ := strings.Cut(strings.TrimSpace(rest), " ")
+
+		value, err := strconv.ParseFloat(valueStr, 64)
+		if err != nil {
+			continue
+		}
+
+		samples[series] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read %s/metrics: %w", baseURL, err)
+	}
+
+	return samples, nil
+}
+
+// watchMetricPeak polls an unlabelled series on baseURL every interval
+// in the background. The returned stop ends the polling and reports
+// the highest value seen, or false if no scrape exposed the series.
+// Failed scrapes are skipped.
+func watchMetricPeak(
+	baseURL, name string,
+	interval time.Duration,
+) (stop func() (float64, bool)) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	var (
+		peak float64
+		seen bool
+	)
+
+	go func() {
+		defer close(finished)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if samples, err := fetchMetrics(baseURL); err == nil {
+				if v, ok := metricValue(samples, name); ok {
+					peak = max(peak, v)
+					seen = true
+				}
+			}
+
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() (float64, bool) {
+		close(done)
+		<-finished
+
+		return peak, seen
+	}
+}
+
+// cutSeries splits a Prometheus sample line into its series name (with
+// labels) and the remainder holding the value and optional timestamp.
+func cutSeries(line string) (series, rest string, ok bool) {
+	if i := strings.Index(line, "{"); i >= 0 {
+		end := strings.LastIndex(line, "}")
+		if end < i {
+			return "", "", false
+		}
+
+		return line[:end+1], line[end+1:], true
+	}
+
+	return strings.Cut(line, " ")
+}
+
+// metricValue returns the value of an unlabelled series from a scrape,
+// or false when the series is not exposed.
+func metricValue(samples map[string]float64, name string) (float64, bool) {
+	v, ok := samples[name]
+	return v, ok
+}
+
+// sumMetric adds up every series of the given metric name across all
+// label combinations whose label set contains each of the given
+// `key="value"` matchers.
+func sumMetric(
+	samples map[string]float64,
+	name string,
+	matchers ...string,
+) float64 {
+	var total float64
+
+	for series, v := range samples {
+		if series != name && !strings.HasPrefix(series, name+"{") {
+			continue
+		}
+
+		matched := true
+
+		for _, m := range matchers {
+			if !strings.Contains(series, m) {
+				matched = false
+
+				break
+			}
+		}
+
+		if matched {
+			total += v
+		}
+	}
+
+	return total
+}
@@ -0,0 +1,192 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/stretchr/testify/require"
+)
+
+// minioConfig is the connection info for the object store the services
+// write processed images to.
+type minioConfig struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	UseSSL    bool
+}
+
+// minioConfigFromEnv resolves the MinIO connection from the environment.
+// In docker mode the values come from tests/integration/.env (loaded by
+// setupDocker); MINIO_ENDPOINT overrides the derived endpoint in either
+// mode.
+func minioConfigFromEnv() minioConfig {
+	endpoint := os.Getenv("MINIO_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "localhost:9000"
+		if port := os.Getenv("MINIO_HOST_PORT"); port != "" {
+			endpoint = net.JoinHostPort(
+				envOrDefault("HOST_IP", "localhost"), port,
+			)
+		}
+	}
+
+	return minioConfig{
+		Endpoint:  endpoint,
+		AccessKey: envOrDefault("MINIO_ACCESS_KEY_ID", "minioadmin"),
+		SecretKey: envOrDefault("MINIO_SECRET_ACCESS_KEY", "minioadmin"),
+		Bucket:    envOrDefault("MINIO_BUCKET_NAME", "follow-images"),
+		UseSSL:    os.Getenv("MINIO_USE_SSL") == "true",
+	}
+}
+
+// newMinioClient connects to the object store described by cfg.
+// It returns an error rather than failing a test so it can also be used
+// from TestMain.
+func newMinioClient(cfg minioConfig) (*minio.Client, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds: credentials.NewStaticV4(
+			cfg.AccessKey, cfg.SecretKey, "",
+		),
+		Secure: cfg.UseSSL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("minio client for %s: %w", cfg.Endpoint, err)
+	}
+
+	return client, nil
+}
+
+// listObjectVersions returns every version and delete marker stored
+// under prefix. It takes no testing.T so polling helpers can use it.
+func listObjectVersions(
+	ctx context.Context,
+	client *minio.Client,
+	bucket string,
+	prefix string,
+) ([]minio.ObjectInfo, error) {
+	var out []minio.ObjectInfo
+
+	for obj := range client.ListObjects(ctx, bucket,
+		minio.ListObjectsOptions{
+			Prefix:       prefix,
+			Recursive:    true,
+			WithVersions: true,
+		},
+	) {
+		if obj.Err != nil {
+			return out, fmt.Errorf("list versions %s: %w", prefix, obj.Err)
+		}
+
+		out = append(out, obj)
+	}
+
+	return out, nil
+}
+
+// objectInspector reads the image bucket directly, bypassing the API's
+// presigned URLs, so tests can see every stored version.
+type objectInspector struct {
+	client *minio.Client
+	bucket string
+}
+
+// newObjectInspector connects to the image bucket.
+func newObjectInspector(t *testing.T) *objectInspector {
+	t.Helper()
+
+	cfg := minioConfigFromEnv()
+
+	client, err := newMinioClient(cfg)
+	require.NoError(t, err, "newObjectInspector: client")
+
+	return &objectInspector{client: client, bucket: cfg.Bucket}
+}
+
+// versioningEnabled reports whether the bucket keeps object versions.
+func (o *objectInspector) versioningEnabled(t *testing.T) bool {
+	t.Helper()
+
+	cfg, err := o.client.GetBucketVersioning(context.Background(), o.bucket)
+	require.NoError(t, err, "objectInspector: get bucket versioning")
+
+	return cfg.Enabled()
+}
+
+// objects returns the current (latest, non-deleted) objects under
+// prefix.
+func (o *objectInspector) objects(
+	t *testing.T,
+	prefix string,
+) []minio.ObjectInfo {
+	t.Helper()
+
+	var out []minio.ObjectInfo
+
+	for obj := range o.client.ListObjects(context.Background(), o.bucket,
+		minio.ListObjectsOptions{Prefix: prefix, Recursive: true},
+	) {
+		require.NoErrorf(t, obj.Err, "objectInspector: list %s", prefix)
+		out = append(out, obj)
+	}
+
+	return out
+}
+
+// versions returns every version and delete marker under prefix.
+func (o *objectInspector) versions(
+	t *testing.T,
+	prefix string,
+) []minio.ObjectInfo {
+	t.Helper()
+
+	out, err := listObjectVersions(
+		context.Background(), o.client, o.bucket, prefix,
+	)
+	require.NoError(t, err, "objectInspector")
+
+	return out
+}
+
+// stat returns the metadata of the latest version of key.
+func (o *objectInspector) stat(t *testing.T, key string) minio.ObjectInfo {
+	t.Helper()
+
+	info, err := o.client.StatObject(
+		context.Background(), o.bucket, key, minio.StatObjectOptions{},
+	)
+	require.NoErrorf(t, err, "objectInspector: stat %s", key)
+
+	return info
+}
+
+// download returns the bytes of key at versionID, or of the latest
+// version when versionID is empty.
+func (o *objectInspector) download(
+	t *testing.T,
+	key string,
+	versionID string,
+) []byte {
+	t.Helper()
+
+	obj, err := o.client.GetObject(
+		context.Background(), o.bucket, key,
+		minio.GetObjectOptions{VersionID: versionID},
+	)
+	require.NoErrorf(t, err, "objectInspector: get %s", key)
+	defer obj.Close()
+
+	data, err := io.ReadAll(obj)
+	require.NoErrorf(t, err, "objectInspector: read %s", key)
+
+	return data
+}
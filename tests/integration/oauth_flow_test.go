@@ -0,0 +1,300 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeIdPs returns both fake providers, for tests that hold for each.
+func fakeIdPs() []*fakeIdP {
+	return []*fakeIdP{fakeGoogle, fakeApple}
+}
+
+// TestOAuthSignIn_PromotesAnonymousUser verifies that a first OAuth
+// sign-in from an anonymous session turns it into a registered
+// account that keeps the anonymous user's routes, and that signing in
+// again with the same provider identity returns that account.
+func TestOAuthSignIn_PromotesAnonymousUser(t *testing.T) {
+	isolate(t, isolationParallel)
+	requireFakeOIDC(t)
+
+	for _, p := range fakeIdPs() {
+		t.Run(p.Name, func(t *testing.T) {
+			_, anonToken, _ := createAnonymousUser(t)
+			routeID := prepareRoute(t, anonToken)
+
+			id := p.newIdentity(false)
+			first := requireOAuthSignIn(t, p, id, anonToken)
+
+			waitForOwnerType(t, routeID, first.AccessToken, "user",
+				10*time.Second,
+			)
+
+			// A later sign-in, from another device's anonymous session.
+			_, otherAnon, _ := createAnonymousUser(t)
+			again := requireOAuthSignIn(t, p, id, otherAnon)
+			assert.Equal(t, first.UserID, again.UserID,
+				"the same %s subject must map to the same account", p.Name,
+			)
+
+			resp := doRequest(t, http.MethodGet,
+				apiURL+"/api/v1/routes/"+routeID, nil, again.AccessToken,
+			)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode,
+				"the promoted route must be reachable from the new session",
+			)
+		})
+	}
+}
+
+// TestOAuthSignIn_LinksVerifiedEmail verifies that a provider identity
+// with a verified email matching an existing password account signs
+// into that account, and that the password keeps working. An
+// unverified email must not: anyone can create a provider account
+// claiming someone else's address, so the API refuses it with 409 as
+// it refuses registering a taken email.
+func TestOAuthSignIn_LinksVerifiedEmail(t *testing.T) {
+	isolate(t, isolationParallel)
+	requireFakeOIDC(t)
+
+	for _, p := range fakeIdPs() {
+		t.Run(p.Name, func(t *testing.T) {
+			_, anonToken, _ := createAnonymousUser(t)
+			email := uniqueEmail()
+			accountID, _, _ := registerAndConfirm(t, anonToken, email)
+
+			t.Run("Unverified", func(t *testing.T) {
+				id := p.newIdentity(false)
+				id.Email = email
+				id.EmailVerified = false
+
+				_, otherAnon, _ := createAnonymousUser(t)
+				resp := oauthSignIn(t, p, p.idToken(t, id), "", otherAnon)
+				resp.Body.Close()
+				assert.Equal(t, http.StatusConflict, resp.StatusCode,
+					"an unverified provider email must not sign into "+
+						"the account registered with that address",
+				)
+			})
+
+			t.Run("Verified", func(t *testing.T) {
+				id := p.newIdentity(false)
+				id.Email = email
+
+				_, otherAnon, _ := createAnonymousUser(t)
+				linked := requireOAuthSignIn(t, p, id, otherAnon)
+				assert.Equal(t, accountID, linked.UserID,
+					"a verified provider email must sign into the "+
+						"existing account",
+				)
+
+				resp := doRequest(t, http.MethodPost,
+					apiURL+"/api/v1/auth/login",
+					map[string]any{"email": email, "password": testPassword},
+					"",
+				)
+				require.Equal(t, http.StatusOK, resp.StatusCode,
+					"password login must still work after linking",
+				)
+
+				body := decodeJSON(t, resp)
+				assert.Equal(t, accountID, body["user_id"])
+			})
+		})
+	}
+}
+
+// TestOAuthSignIn_ApplePrivateRelay verifies Apple's "Hide My Email"
+// flow: the account is created with the relay address, and later
+// sign-ins, whose tokens carry no email at all, still resolve to it
+// by subject.
+func TestOAuthSignIn_ApplePrivateRelay(t *testing.T) {
+	isolate(t, isolationParallel)
+	requireFakeOIDC(t)
+
+	_, anonToken, _ := createAnonymousUser(t)
+
+	id := fakeApple.newIdentity(true)
+	first := requireOAuthSignIn(t, fakeApple, id, anonToken)
+
+	id.Email = ""
+	_, otherAnon, _ := createAnonymousUser(t)
+	again := requireOAuthSignIn(t, fakeApple, id, otherAnon)
+
+	assert.Equal(t, first.UserID, again.UserID,
+		"a token without email must resolve to the account by subject",
+	)
+}
+
+// TestOAuthSignIn_NonceBinding verifies that when the client sends the
+// nonce it gave the provider, the token must carry the same one, so a
+// token captured from another sign-in cannot be injected.
+func TestOAuthSignIn_NonceBinding(t *testing.T) {
+	isolate(t, isolationParallel, labelSecurity)
+	requireFakeOIDC(t)
+
+	for _, p := range fakeIdPs() {
+		t.Run(p.Name, func(t *testing.T) {
+			id := p.newIdentity(false)
+			id.Nonce = uuid.New().String()
+
+			_, anonToken, _ := createAnonymousUser(t)
+			resp := oauthSignIn(t, p, p.idToken(t, id),
+				uuid.New().String(), anonToken,
+			)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode,
+				"a nonce mismatch must be rejected",
+			)
+
+			requireOAuthSignIn(t, p, id, anonToken)
+		})
+	}
+}
+
+// TestOAuthSignIn_RejectsReplay verifies that an ID token is accepted
+// once. A token lifted from one sign-in (a log, a proxy, a
+// compromised device) must not open a session again, even from
+// another anonymous session, while it is still unexpired.
+func TestOAuthSignIn_RejectsReplay(t *testing.T) {
+	isolate(t, isolationParallel, labelSecurity)
+	requireFakeOIDC(t)
+
+	for _, p := range fakeIdPs() {
+		t.Run(p.Name, func(t *testing.T) {
+			token := p.idToken(t, p.newIdentity(false))
+
+			_, anonToken, _ := createAnonymousUser(t)
+			resp := oauthSignIn(t, p, token, "", anonToken)
+			resp.Body.Close()
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			_, otherAnon, _ := createAnonymousUser(t)
+			resp = oauthSignIn(t, p, token, "", otherAnon)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode,
+				"a replayed %s ID token must be rejected", p.Name,
+			)
+		})
+	}
+}
+
+// TestOAuthSignIn_RejectsInvalidTokens goes beyond the garbage-token
+// checks in TestOAuthGoogleInvalidToken and TestOAuthAppleInvalidToken:
+// each token here is well formed and, unless the case is about the
+// signature, signed with the provider's published key.
+func TestOAuthSignIn_RejectsInvalidTokens(t *testing.T) {
+	isolate(t, isolationParallel, labelSecurity)
+	requireFakeOIDC(t)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	cases := []struct {
+		Name  string
+		Forge func(t *testing.T, p *fakeIdP, claims map[string]any) string
+	}{
+		{
+			Name: "WrongAudience",
+			Forge: func(t *testing.T, p *fakeIdP, c map[string]any) string {
+				c["aud"] = "someone-elses-client"
+				delete(c, "azp")
+
+				return p.sign(t, c)
+			},
+		},
+		{
+			Name: "OtherProviderAudience",
+			Forge: func(t *testing.T, p *fakeIdP, c map[string]any) string {
+				// Valid for the other provider's client ID.
+				other := fakeApple
+				if p == fakeApple {
+					other = fakeGoogle
+				}
+
+				c["aud"] = other.ClientID
+
+				return p.sign(t, c)
+			},
+		},
+		{
+			Name: "WrongIssuer",
+			Forge: func(t *testing.T, p *fakeIdP, c map[string]any) string {
+				c["iss"] = "https://issuer.example.com"
+
+				return p.sign(t, c)
+			},
+		},
+		{
+			Name: "Expired",
+			Forge: func(t *testing.T, p *fakeIdP, c map[string]any) string {
+				past := time.Now().Add(-2 * time.Hour)
+				c["iat"] = past.Unix()
+				c["auth_time"] = past.Unix()
+				c["exp"] = past.Add(time.Hour).Unix()
+
+				return p.sign(t, c)
+			},
+		},
+		{
+			Name: "MissingSubject",
+			Forge: func(t *testing.T, p *fakeIdP, c map[string]any) string {
+				delete(c, "sub")
+
+				return p.sign(t, c)
+			},
+		},
+		{
+			Name: "UnpublishedKey",
+			Forge: func(t *testing.T, p *fakeIdP, c map[string]any) string {
+				// The provider's kid, someone else's key.
+				return forgeJWT(t,
+					map[string]any{"alg": "RS256", "kid": p.kid},
+					c, rs256Signer(t, otherKey),
+				)
+			},
+		},
+		{
+			Name: "UnknownKeyID",
+			Forge: func(t *testing.T, p *fakeIdP, c map[string]any) string {
+				return forgeJWT(t,
+					map[string]any{"alg": "RS256", "kid": "rotated-away"},
+					c, rs256Signer(t, otherKey),
+				)
+			},
+		},
+		{
+			Name: "AlgNone",
+			Forge: func(t *testing.T, p *fakeIdP, c map[string]any) string {
+				return forgeJWT(t,
+					map[string]any{"alg": "none", "kid": p.kid},
+					c, unsigned,
+				)
+			},
+		},
+	}
+
+	for _, p := range fakeIdPs() {
+		for _, tc := range cases {
+			t.Run(p.Name+"/"+tc.Name, func(t *testing.T) {
+				claims := p.claims(p.newIdentity(false))
+				token := tc.Forge(t, p, claims)
+
+				_, anonToken, _ := createAnonymousUser(t)
+				resp := oauthSignIn(t, p, token, "", anonToken)
+				resp.Body.Close()
+				assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+			})
+		}
+	}
+}
@@ -0,0 +1,220 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yoseforb/follow-pkg/valkey"
+)
+
+// TestObjectStorage_KeyLayoutMatchesUploadToken checks that the gateway
+// writes each processed image exactly where its upload token's
+// storage_key claim says (with the extension switched to .webp), that
+// nothing else is left under the image's prefix, and that the stored
+// object matches the result message byte for byte.
+func TestObjectStorage_KeyLayoutMatchesUploadToken(t *testing.T) {
+	isolate(t, isolationParallel)
+	shareState(t, stateImageResults)
+
+	_, token, _ := createAnonymousUser(t)
+	vc := newValkeyClient(t)
+	objects := newObjectInspector(t)
+	db := newDBInspector(t)
+
+	payload := jpegBytes(t, 800, 600)
+	routeID := prepareRoute(t, token)
+
+	created := createRouteWithWaypointBodies(
+		t, token, routeID,
+		[]map[string]any{
+			buildWaypointBody(0, "layout-a.jpg", len(payload)),
+			buildWaypointBody(1, "layout-b.jpg", len(payload)),
+		},
+	)
+	require.Len(t, created.PresignedURLs, 2)
+
+	for _, upload := range created.PresignedURLs {
+		t.Run(upload.ImageID, func(t *testing.T) {
+			claims := uploadTokenClaims(t, upload.UploadToken)
+
+			claimKey, _ := claims["storage_key"].(string)
+			assert.Equal(t, upload.ImageID, claims["image_id"],
+				"token image_id must match the presigned entry",
+			)
+			assert.Equal(t,
+				imageStorageKeyPrefix+upload.ImageID+path.Ext(claimKey),
+				claimKey,
+				"storage_key claim must be images/{image_id}.{ext}",
+			)
+
+			result := uploadProcessed(t, vc, upload, payload)
+
+			wantKey := strings.TrimSuffix(claimKey, path.Ext(claimKey)) +
+				".webp"
+			assert.Equal(t, wantKey,
+				result.Fields[valkey.ResultFieldStorageKey],
+				"result storage_key must be the claim key as .webp",
+			)
+
+			current := objects.objects(
+				t, imageStorageKeyPrefix+upload.ImageID,
+			)
+			require.Len(t, current, 1,
+				"exactly one object must exist for the image "+
+					"(the original upload must not be persisted)",
+			)
+			assert.Equal(t, wantKey, current[0].Key)
+
+			versions := objects.versions(
+				t, imageStorageKeyPrefix+upload.ImageID,
+			)
+			assert.Len(t, versions, 1,
+				"a freshly processed image must have a single version",
+			)
+
+			info := objects.stat(t, wantKey)
+			assert.Equal(t, "image/webp", info.ContentType)
+			assert.Equal(t,
+				result.Fields[valkey.ResultFieldFileSize],
+				strconv.FormatInt(info.Size, 10),
+			)
+			assert.Equal(t,
+				strings.Trim(result.Fields[valkey.ResultFieldETag], `"`),
+				strings.Trim(info.ETag, `"`),
+			)
+
+			sum := sha256.Sum256(objects.download(t, wantKey, ""))
+			assert.Equal(t,
+				result.Fields[valkey.ResultFieldSHA256],
+				hex.EncodeToString(sum[:]),
+				"stored bytes must hash to the result sha256",
+			)
+
+			require.Eventually(t, func() bool {
+				img := db.image(t, upload.ImageID)
+				return img != nil && img.StorageKey == wantKey
+			}, 15*time.Second, 200*time.Millisecond,
+				"image row storage_key must be updated to %s", wantKey,
+			)
+		})
+	}
+}
+
+// TestObjectStorage_RetentionPolicy pins down what happens to stored
+// objects when an image stops being used. The bucket is versioned, so a
+// plain DeleteObject only adds a delete marker and keeps the bytes; the
+// policy asserted here is that no version and no delete marker of a
+// replaced or deleted image survives.
+func TestObjectStorage_RetentionPolicy(t *testing.T) {
+	isolate(t, isolationParallel)
+	shareState(t, stateImageResults)
+
+	objects := newObjectInspector(t)
+	if !objects.versioningEnabled(t) {
+		t.Log("bucket versioning is off; " +
+			"only current objects can be left behind")
+	}
+
+	t.Run("ReplacedImage", func(t *testing.T) {
+		_, token, _ := createAnonymousUser(t)
+		vc := newValkeyClient(t)
+		db := newDBInspector(t)
+
+		routeID := createProcessedRoute(t, token, 1)
+		publishRoute(t, routeID, token)
+
+		waypoints := db.waypoints(t, routeID)
+		require.Len(t, waypoints, 1)
+
+		oldImageID := waypoints[0].ImageID
+		require.NotEmpty(t,
+			objects.versions(t, imageStorageKeyPrefix+oldImageID),
+			"original image must be stored before replacement",
+		)
+
+		payload := jpegBytes(t, 700, 500)
+		replacement := prepareImageReplacement(
+			t, routeID, waypoints[0].ID, token,
+			"replacement.jpg", len(payload),
+		)
+
+		uploadProcessed(t, vc, PresignedURLEntry{
+			ImageID:     replacement.ImageID,
+			UploadURL:   replacement.UploadURL,
+			UploadToken: replacement.UploadToken,
+		}, payload)
+
+		require.Eventually(t, func() bool {
+			wps := db.waypoints(t, routeID)
+			return len(wps) == 1 && wps[0].ImageID == replacement.ImageID
+		}, 15*time.Second, 200*time.Millisecond,
+			"waypoint must be swapped to the replacement image",
+		)
+
+		assert.Len(t,
+			objects.versions(t, imageStorageKeyPrefix+replacement.ImageID),
+			1, "replacement image must have a single version",
+		)
+
+		assertObjectVersionsPurged(t, oldImageID)
+
+		deleteRouteVerified(t, routeID, token)
+		assertObjectVersionsPurged(t, oldImageID)
+	})
+
+	t.Run("DeletedRoute", func(t *testing.T) {
+		_, token, _ := createAnonymousUser(t)
+
+		routeID := createProcessedRoute(t, token, 2)
+		target := routeCascadeTarget(t, routeID, token)
+
+		for _, imageID := range target.ImageIDs {
+			require.NotEmpty(t,
+				objects.versions(t, imageStorageKeyPrefix+imageID),
+				"image %s must be stored before deletion", imageID,
+			)
+		}
+
+		deleteRouteVerified(t, routeID, token)
+
+		for _, imageID := range target.ImageIDs {
+			assertObjectVersionsPurged(t, imageID)
+		}
+	})
+}
+
+// assertObjectVersionsPurged waits until no version or delete marker
+// remains under the image's prefix.
+func assertObjectVersionsPurged(t *testing.T, imageID string) {
+	t.Helper()
+
+	v := newCascadeVerifier(t)
+
+	var leftovers []string
+
+	deadline := time.Now().Add(defaultCascadeTimeout)
+	for time.Now().Before(deadline) {
+		leftovers = v.objectLeftovers(context.Background(), imageID)
+		if len(leftovers) == 0 {
+			return
+		}
+
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	assert.Failf(t, "stored versions retained",
+		"image %s still has %d stored version(s) after %s:\n%s",
+		imageID, len(leftovers), defaultCascadeTimeout,
+		formatLeftovers(leftovers),
+	)
+}
@@ -0,0 +1,488 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+)
+
+// Audiences follow-api is configured to accept. Issuers stay the real
+// ones, so the API's issuer checks run unchanged; only where the keys
+// come from and which client the token is for differ from production.
+const (
+	fakeGoogleClientID = "follow-test.apps.googleusercontent.com"
+	fakeAppleClientID  = "app.follow.test"
+)
+
+// appleRelayDomain hosts the forwarding addresses Apple hands out when
+// a user chooses "Hide My Email".
+const appleRelayDomain = "privaterelay.appleid.com"
+
+// fakeIdP is one identity provider served by the fake OIDC server:
+// its own signing key, JWKS and discovery document, mirroring the
+// provider's real ID token format.
+type fakeIdP struct {
+	// Name is the path segment both here and in follow-api's
+	// /auth/oauth/{name} endpoint.
+	Name     string
+	Issuer   string
+	ClientID string
+	// StringBools marks providers (Apple) that encode boolean claims
+	// such as email_verified as the strings "true" and "false".
+	StringBools bool
+
+	key *rsa.PrivateKey
+	kid string
+}
+
+// Fake providers, created by startFakeOIDC.
+var (
+	fakeGoogle *fakeIdP
+	fakeApple  *fakeIdP
+)
+
+// fakeOIDCServer serves the providers' keys; nil until started.
+var fakeOIDCServer *http.Server
+
+// fakeOIDCPort is where the fake OIDC server listens, FAKE_OIDC_PORT
+// or 8099. In docker mode it comes from .env.
+func fakeOIDCPort() string {
+	return envOrDefault("FAKE_OIDC_PORT", "8099")
+}
+
+// fakeOIDCEnv points follow-api's token verification at the fake
+// providers. The compose override sets the same variables with the
+// host reached as host.docker.internal. If the API does not pick them
+// up, requireFakeOIDC fails every flow test and says so.
+func fakeOIDCEnv() []string {
+	base := "http://localhost:" + fakeOIDCPort()
+
+	return []string{
+		"OAUTH_GOOGLE_CLIENT_ID=" + fakeGoogleClientID,
+		"OAUTH_GOOGLE_JWKS_URL=" + base + "/google/jwks",
+		"OAUTH_APPLE_CLIENT_ID=" + fakeAppleClientID,
+		"OAUTH_APPLE_JWKS_URL=" + base + "/apple/jwks",
+	}
+}
+
+// startFakeOIDC generates the providers' keys and starts serving
+// them. It must run before follow-api starts, which may fetch the
+// JWKS at boot. In local mode it binds to loopback; in docker mode
+// the API container reaches it through the docker host gateway, so
+// it binds to all interfaces. A port already in use is logged rather
+// than fatal: only the OAuth flow tests need the server, and
+// requireFakeOIDC fails them.
+func startFakeOIDC(mode string) {
+	fakeGoogle = newFakeIdP("google", "https://accounts.google.com",
+		fakeGoogleClientID, false,
+	)
+	fakeApple = newFakeIdP("apple", "https://appleid.apple.com",
+		fakeAppleClientID, true,
+	)
+
+	mux := http.NewServeMux()
+	for _, p := range []*fakeIdP{fakeGoogle, fakeApple} {
+		mux.HandleFunc("GET /"+p.Name+"/jwks", p.serveJWKS)
+		mux.HandleFunc(
+			"GET /"+p.Name+"/.well-known/openid-configuration",
+			p.serveDiscovery,
+		)
+	}
+
+	host := "127.0.0.1"
+	if mode != "local" {
+		host = "0.0.0.0"
+	}
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, fakeOIDCPort()))
+	if err != nil {
+		log.Error().Err(err).
+			Msg("fake OIDC: cannot listen; OAuth flow tests will fail")
+
+		return
+	}
+
+	fakeOIDCServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		err := fakeOIDCServer.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			log.Error().Err(err).Msg("fake OIDC: server stopped")
+		}
+	}()
+
+	log.Info().Str("addr", ln.Addr().String()).Msg("fake OIDC started")
+}
+
+// stopFakeOIDC shuts the fake OIDC server down, if it was started.
+func stopFakeOIDC() {
+	if fakeOIDCServer != nil {
+		_ = fakeOIDCServer.Close()
+	}
+}
+
+// newFakeIdP creates a provider with a fresh RSA signing key.
+func newFakeIdP(name, issuer, clientID string, stringBools bool) *fakeIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Error().Err(err).Str("idp", name).
+			Msg("fake OIDC: cannot generate key")
+		os.Exit(1)
+	}
+
+	return &fakeIdP{
+		Name:        name,
+		Issuer:      issuer,
+		ClientID:    clientID,
+		StringBools: stringBools,
+		key:         key,
+		kid:         name + "-" + uuid.New().String()[:8],
+	}
+}
+
+// serveJWKS publishes the provider's public key.
+func (p *fakeIdP) serveJWKS(w http.ResponseWriter, _ *http.Request) {
+	pub := p.key.PublicKey
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]any{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": p.kid,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(
+				big.NewInt(int64(pub.E)).Bytes(),
+			),
+		}},
+	})
+}
+
+// serveDiscovery answers for verifiers that locate the JWKS through
+// the discovery document rather than a configured URL.
+func (p *fakeIdP) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	jwksURI := "http://" + r.Host + "/" + p.Name + "/jwks"
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"issuer":                                p.Issuer,
+		"jwks_uri":                              jwksURI,
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+// oidcIdentity is the account an ID token speaks for.
+type oidcIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	// PrivateRelay marks an Apple "Hide My Email" address.
+	PrivateRelay bool
+	Nonce        string
+}
+
+// newIdentity returns a fresh, verified identity at this provider.
+// Apple identities with privateRelay get a relay address.
+func (p *fakeIdP) newIdentity(privateRelay bool) oidcIdentity {
+	id := oidcIdentity{
+		Subject:       p.Name + "-" + uuid.New().String(),
+		EmailVerified: true,
+		PrivateRelay:  privateRelay,
+	}
+
+	if !privateRelay {
+		id.Email = uniqueEmail()
+
+		return id
+	}
+
+	local := strings.ReplaceAll(uuid.New().String(), "-", "")[:12]
+	id.Email = local + "@" + appleRelayDomain
+	recordSecret(secretEmail, id.Email)
+
+	return id
+}
+
+// claims builds the ID token claims the provider would issue for id,
+// valid for an hour from now. An empty Email leaves the email claims
+// out, as Apple does on every sign-in after the first. Every call gets
+// a fresh jti, so two sign-ins for one identity within the same second
+// still present different tokens and are not mistaken for a replay.
+func (p *fakeIdP) claims(id oidcIdentity) map[string]any {
+	now := time.Now()
+
+	claims := map[string]any{
+		"iss":       p.Issuer,
+		"aud":       p.ClientID,
+		"sub":       id.Subject,
+		"iat":       now.Unix(),
+		"exp":       now.Add(time.Hour).Unix(),
+		"auth_time": now.Unix(),
+		"jti":       uuid.New().String(),
+	}
+
+	if id.Email != "" {
+		claims["email"] = id.Email
+		claims["email_verified"] = p.bool(id.EmailVerified)
+	}
+
+	if id.Nonce != "" {
+		claims["nonce"] = id.Nonce
+	}
+
+	switch p.Name {
+	case "google":
+		claims["azp"] = p.ClientID
+	case "apple":
+		claims["nonce_supported"] = true
+		if id.Email != "" {
+			claims["is_private_email"] = p.bool(id.PrivateRelay)
+		}
+	}
+
+	return claims
+}
+
+// bool encodes a boolean claim the way the provider does.
+func (p *fakeIdP) bool(v bool) any {
+	if p.StringBools {
+		return fmt.Sprint(v)
+	}
+
+	return v
+}
+
+// sign issues an ID token with the given claims under the provider's
+// published key. The token is recorded for the secret scan: the API
+// must never log or store it verbatim.
+func (p *fakeIdP) sign(t *testing.T, claims map[string]any) string {
+	t.Helper()
+
+	token, err := p.mint(claims)
+	require.NoError(t, err, "fakeIdP.sign")
+
+	return token
+}
+
+// mint is sign without a test to fail, for the probe in
+// requireFakeOIDC.
+func (p *fakeIdP) mint(claims map[string]any) (string, error) {
+	h, err := json.Marshal(
+		map[string]any{"alg": "RS256", "kid": p.kid, "typ": "JWT"},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(h) + "." +
+		base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(input))
+
+	sig, err := rsa.SignPKCS1v15(nil, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	token := input + "." + base64.RawURLEncoding.EncodeToString(sig)
+	recordSecret(secretToken, token)
+
+	return token, nil
+}
+
+// idToken issues a valid ID token for id.
+func (p *fakeIdP) idToken(t *testing.T, id oidcIdentity) string {
+	t.Helper()
+
+	return p.sign(t, p.claims(id))
+}
+
+// oauthSignIn exchanges an ID token at follow-api's
+// /auth/oauth/{provider} endpoint. nonce is sent only when non-empty.
+func oauthSignIn(
+	t *testing.T,
+	p *fakeIdP,
+	idToken, nonce, authToken string,
+) *http.Response {
+	t.Helper()
+
+	body := map[string]any{"id_token": idToken}
+	if nonce != "" {
+		body["nonce"] = nonce
+	}
+
+	return doRequest(t, http.MethodPost,
+		apiURL+"/api/v1/auth/oauth/"+p.Name, body, authToken,
+	)
+}
+
+// fakeOIDCProbe caches whether follow-api trusts the fake providers,
+// decided by the first test that asks.
+var fakeOIDCProbe struct {
+	once sync.Once
+	err  error
+}
+
+// requireFakeOIDC fails t unless follow-api accepts a valid ID token
+// from each fake provider. Without it, every negative OAuth test would
+// pass against an API that trusts no fake token at all.
+func requireFakeOIDC(t *testing.T) {
+	t.Helper()
+
+	fakeOIDCProbe.once.Do(func() {
+		fakeOIDCProbe.err = probeFakeOIDC()
+	})
+
+	if fakeOIDCProbe.err != nil {
+		t.Fatalf("follow-api does not trust the fake OIDC providers: %v; "+
+			"it must read OAUTH_{GOOGLE,APPLE}_{CLIENT_ID,JWKS_URL} "+
+			"as set by fakeOIDCEnv", fakeOIDCProbe.err,
+		)
+	}
+}
+
+// probeFakeOIDC signs a fresh anonymous user in once per provider with
+// a valid token. It reports problems as an error rather than through a
+// test, so the result can be cached for every caller.
+func probeFakeOIDC() error {
+	if fakeOIDCServer == nil {
+		return errors.New("fake OIDC server is not running")
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	post := func(
+		path string,
+		body any,
+		token string,
+	) (*http.Response, error) {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest(http.MethodPost,
+			apiURL+"/api/v1"+path, bytes.NewReader(b),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		return client.Do(req)
+	}
+
+	var refused []string
+
+	for _, p := range fakeIdPs() {
+		resp, err := post("/users/anonymous", map[string]any{}, "")
+		if err != nil {
+			return fmt.Errorf("create anonymous user: %w", err)
+		}
+
+		var anon struct {
+			AccessToken string `json:"access_token"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&anon)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK || err != nil {
+			return fmt.Errorf("create anonymous user: status %d",
+				resp.StatusCode,
+			)
+		}
+
+		idToken, err := p.mint(p.claims(p.newIdentity(false)))
+		if err != nil {
+			return fmt.Errorf("%s: sign ID token: %w", p.Name, err)
+		}
+
+		resp, err = post("/auth/oauth/"+p.Name,
+			map[string]any{"id_token": idToken}, anon.AccessToken,
+		)
+		if err != nil {
+			return fmt.Errorf("%s: sign in: %w", p.Name, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			refused = append(refused,
+				fmt.Sprintf("%s answered %d", p.Name, resp.StatusCode),
+			)
+		}
+	}
+
+	if len(refused) > 0 {
+		return errors.New(strings.Join(refused, ", "))
+	}
+
+	return nil
+}
+
+// oauthSession is what a successful OAuth sign-in returns.
+type oauthSession struct {
+	UserID       string
+	AccessToken  string
+	RefreshToken string
+}
+
+// requireOAuthSignIn signs in with a valid token for id and fails the
+// test unless the API answers 200 with a session.
+func requireOAuthSignIn(
+	t *testing.T,
+	p *fakeIdP,
+	id oidcIdentity,
+	authToken string,
+) oauthSession {
+	t.Helper()
+
+	resp := oauthSignIn(t, p, p.idToken(t, id), id.Nonce, authToken)
+	require.Equalf(t, http.StatusOK, resp.StatusCode,
+		"%s sign-in must succeed", p.Name,
+	)
+
+	body := decodeJSON(t, resp)
+	s := oauthSession{}
+	s.UserID, _ = body["user_id"].(string)
+	s.AccessToken, _ = body["access_token"].(string)
+	s.RefreshToken, _ = body["refresh_token"].(string)
+
+	require.NotEmpty(t, s.UserID, "%s sign-in: missing user_id", p.Name)
+	require.NotEmpty(t, s.AccessToken,
+		"%s sign-in: missing access_token", p.Name,
+	)
+
+	return s
+}
@@ -0,0 +1,642 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Documented page_size bounds for GET /api/v1/routes.
+const (
+	routesDefaultPageSize = 20
+	routesMaxPageSize     = 100
+)
+
+// paginationMeta is the decoded `pagination` object of a listing
+// response. Only `count` is guaranteed; the other fields are checked
+// when the API exposes them.
+type paginationMeta struct {
+	Count      int
+	Total      *int
+	Page       *int
+	PageSize   *int
+	TotalPages *int
+}
+
+// routesPage is one decoded page of GET /api/v1/routes.
+type routesPage struct {
+	IDs        []string
+	Pagination paginationMeta
+}
+
+// fetchRoutesPage requests one page and decodes it. Calls t.Fatal on a
+// non-200 response.
+func fetchRoutesPage(
+	t *testing.T,
+	authToken string,
+	params url.Values,
+	page int,
+	pageSize int,
+) routesPage {
+	t.Helper()
+
+	q := url.Values{}
+	for k, v := range params {
+		q[k] = v
+	}
+
+	q.Set("page", strconv.Itoa(page))
+	q.Set("page_size", strconv.Itoa(pageSize))
+
+	resp := doRequest(
+		t, http.MethodGet, apiURL+"/api/v1/routes?"+q.Encode(),
+		nil, authToken,
+	)
+	require.Equalf(t, http.StatusOK, resp.StatusCode,
+		"fetchRoutesPage: GET /api/v1/routes?%s", q.Encode(),
+	)
+
+	return decodeRoutesPage(t, decodeJSON(t, resp))
+}
+
+// decodeRoutesPage extracts route IDs and the pagination object from a
+// decoded listing body.
+func decodeRoutesPage(t *testing.T, body map[string]any) routesPage {
+	t.Helper()
+
+	items, ok := body["routes"].([]any)
+	require.True(t, ok, "listing must contain a 'routes' array")
+
+	raw, ok := body["pagination"].(map[string]any)
+	require.True(t, ok, "listing must contain a 'pagination' object")
+
+	count, ok := raw["count"].(float64)
+	require.True(t, ok, "pagination.count must be a number")
+
+	optInt := func(keys ...string) *int {
+		for _, k := range keys {
+			if v, ok := raw[k].(float64); ok {
+				n := int(v)
+				return &n
+			}
+		}
+
+		return nil
+	}
+
+	page := routesPage{
+		Pagination: paginationMeta{
+			Count:      int(count),
+			Total:      optInt("total", "total_count"),
+			Page:       optInt("page"),
+			PageSize:   optInt("page_size"),
+			TotalPages: optInt("total_pages"),
+		},
+	}
+
+	for _, item := range items {
+		r, _ := item.(map[string]any)
+		id, _ := r["route_id"].(string)
+		require.NotEmpty(t, id, "every listed route must have a route_id")
+		page.IDs = append(page.IDs, id)
+	}
+
+	return page
+}
+
+// walkStableListing walks every page of a listing whose contents are
+// known to be exactly want and checks the pagination invariants:
+//
+//   - no page is larger than pageSize and no route appears twice
+//   - the union of all pages is exactly want
+//   - pagination.count is either the page length or the total, and
+//     means the same thing on every page
+//   - total, page, page_size and total_pages agree when present
+//   - the page after the last one is empty
+func walkStableListing(
+	t *testing.T,
+	authToken string,
+	params url.Values,
+	pageSize int,
+	want []string,
+) {
+	t.Helper()
+
+	seen := make(map[string]int, len(want))
+	lastPage := max(1, int(math.Ceil(float64(len(want))/float64(pageSize))))
+
+	countIsTotal := -1 // unknown until a page disambiguates
+
+	for page := 1; page <= lastPage+1; page++ {
+		got := fetchRoutesPage(t, authToken, params, page, pageSize)
+		meta := got.Pagination
+
+		assert.LessOrEqualf(t, len(got.IDs), pageSize,
+			"page %d/size %d: more routes than page_size", page, pageSize,
+		)
+
+		if page > lastPage {
+			assert.Emptyf(t, got.IDs,
+				"page %d/size %d: page past the end must be empty",
+				page, pageSize,
+			)
+		}
+
+		for _, id := range got.IDs {
+			seen[id]++
+			assert.Equalf(t, 1, seen[id],
+				"page %d/size %d: route %s listed more than once",
+				page, pageSize, id,
+			)
+		}
+
+		switch {
+		case meta.Count == len(got.IDs) && meta.Count == len(want):
+			// Ambiguous: page holds everything.
+		case meta.Count == len(got.IDs):
+			require.NotEqualf(t, 1, countIsTotal,
+				"page %d/size %d: pagination.count switched meaning",
+				page, pageSize,
+			)
+
+			countIsTotal = 0
+		case meta.Count == len(want):
+			require.NotEqualf(t, 0, countIsTotal,
+				"page %d/size %d: pagination.count switched meaning",
+				page, pageSize,
+			)
+
+			countIsTotal = 1
+		default:
+			t.Errorf(
+				"page %d/size %d: pagination.count=%d is neither the "+
+					"page length %d nor the total %d",
+				page, pageSize, meta.Count, len(got.IDs), len(want),
+			)
+		}
+
+		if meta.Total != nil {
+			assert.Equalf(t, len(want), *meta.Total,
+				"page %d/size %d: pagination.total", page, pageSize,
+			)
+		}
+
+		if meta.Page != nil {
+			assert.Equalf(t, page, *meta.Page,
+				"page %d/size %d: pagination.page", page, pageSize,
+			)
+		}
+
+		if meta.PageSize != nil {
+			assert.Equalf(t, pageSize, *meta.PageSize,
+				"page %d/size %d: pagination.page_size", page, pageSize,
+			)
+		}
+
+		if meta.TotalPages != nil && len(want) > 0 {
+			assert.Equalf(t, lastPage, *meta.TotalPages,
+				"page %d/size %d: pagination.total_pages", page, pageSize,
+			)
+		}
+	}
+
+	var got []string
+	for id := range seen {
+		got = append(got, id)
+	}
+
+	assert.ElementsMatchf(t, want, got,
+		"size %d: union of all pages must equal the stable set", pageSize,
+	)
+}
+
+// createPublishedRoutes publishes n single-waypoint routes for the
+// token's user, one at a time, and returns their IDs. Routes are
+// deleted on cleanup.
+func createPublishedRoutes(
+	t *testing.T,
+	authToken string,
+	n int,
+) []string {
+	t.Helper()
+
+	payload := jpegBytes(t, 320, 240)
+	ids := make([]string, n)
+
+	for i := range n {
+		routeID := prepareRoute(t, authToken)
+		t.Cleanup(func() { deleteRoute(t, routeID, authToken) })
+
+		created := createRouteWithWaypointBodies(
+			t, authToken, routeID,
+			[]map[string]any{
+				buildWaypointBody(0, "page.jpg", len(payload)),
+			},
+		)
+		require.Len(t, created.PresignedURLs, 1)
+
+		upload := created.PresignedURLs[0]
+		resp := uploadToGateway(
+			t, upload.UploadURL, upload.UploadToken, payload,
+		)
+		resp.Body.Close()
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		waitForRouteReady(t, routeID, authToken, 60*time.Second)
+		publishRoute(t, routeID, authToken)
+
+		ids[i] = routeID
+	}
+
+	return ids
+}
+
+// TestPagination_InvariantsUnderConcurrentWrites publishes a fixed set
+// of routes for one user, then walks that user's listing at several
+// page sizes while other users concurrently create, publish and delete
+// public routes. The walked user's own listing is a stable snapshot and
+// must paginate exactly; the discovery listing, which the writers churn,
+// must stay well-formed and free of duplicates within a page.
+func TestPagination_InvariantsUnderConcurrentWrites(t *testing.T) {
+	isolate(t, isolationParallel, labelSlow)
+
+	const stableRoutes = 5
+
+	_, token, _ := createAnonymousUser(t)
+	want := createPublishedRoutes(t, token, stableRoutes)
+
+	writerTokens := make([]string, 3)
+	for i := range writerTokens {
+		_, writerTokens[i], _ = createAnonymousUser(t)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel() // stop writers if a walk fails the test early
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		writeErr []error
+		writes   int
+	)
+
+	record := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err != nil {
+			writeErr = append(writeErr, err)
+		} else {
+			writes++
+		}
+	}
+
+	payload := jpegBytes(t, 320, 240)
+
+	for i, wt := range writerTokens {
+		wg.Add(1)
+
+		// Writer 0 drives routes all the way to published; the rest
+		// churn pending routes, which is the cheaper, faster write.
+		publish := i == 0
+
+		go func() {
+			defer wg.Done()
+
+			for ctx.Err() == nil {
+				record(churnRoute(ctx, wt, payload, publish))
+			}
+		}()
+	}
+
+	discovery := url.Values{"discovery_mode": {"true"}}
+
+	for round := range 3 {
+		for _, size := range []int{1, 2, 3, stableRoutes, 100} {
+			walkStableListing(t, token, nil, size, want)
+		}
+
+		walkChurningListing(t, token, discovery, 5)
+		t.Logf("round %d complete", round+1)
+	}
+
+	cancel()
+	wg.Wait()
+
+	t.Logf("concurrent writers completed %d route cycles", writes)
+
+	for _, err := range writeErr {
+		t.Errorf("concurrent writer: %v", err)
+	}
+}
+
+// walkChurningListing walks a listing that is being modified
+// concurrently. Offset pagination may legitimately skip or repeat routes
+// across pages while rows move, so only per-page invariants are checked.
+// Stops after maxPages to bound the walk on a busy database.
+func walkChurningListing(
+	t *testing.T,
+	authToken string,
+	params url.Values,
+	pageSize int,
+) {
+	t.Helper()
+
+	const maxPages = 20
+
+	for page := 1; page <= maxPages; page++ {
+		got := fetchRoutesPage(t, authToken, params, page, pageSize)
+
+		assert.LessOrEqualf(t, len(got.IDs), pageSize,
+			"churning page %d: more routes than page_size", page,
+		)
+
+		inPage := make(map[string]bool, len(got.IDs))
+		for _, id := range got.IDs {
+			assert.Falsef(t, inPage[id],
+				"churning page %d: route %s repeated within page",
+				page, id,
+			)
+			inPage[id] = true
+		}
+
+		if len(got.IDs) < pageSize {
+			return
+		}
+	}
+}
+
+// churnRoute performs one public route life cycle for the token's user
+// without touching testing.T, so it can run on a writer goroutine:
+// prepare, create-waypoints, optionally upload + wait ready + publish,
+// then delete. Returns the first unexpected response as an error.
+func churnRoute(
+	ctx context.Context,
+	authToken string,
+	payload []byte,
+	publish bool,
+) error {
+	status, body, err := apiCall(
+		http.MethodPost, apiURL+"/api/v1/routes/prepare",
+		map[string]any{}, authToken,
+	)
+	if err := expectStatus("prepare", http.StatusOK, status, err); err != nil {
+		return err
+	}
+
+	routeID, _ := body["route_id"].(string)
+	routeURL := apiURL + "/api/v1/routes/" + routeID
+
+	defer func() {
+		_, _, _ = apiCall(http.MethodDelete, routeURL, nil, authToken)
+	}()
+
+	metadata := defaultRouteMetadata()
+	metadata["route_id"] = routeID
+	metadata["visibility"] = "public"
+	metadata["waypoints"] = []map[string]any{
+		buildWaypointBody(0, "churn.jpg", len(payload)),
+	}
+
+	status, body, err = apiCall(
+		http.MethodPost, routeURL+"/create-waypoints", metadata, authToken,
+	)
+	err = expectStatus("create-waypoints", http.StatusOK, status, err)
+	if err != nil {
+		return err
+	}
+
+	if !publish {
+		return nil
+	}
+
+	urls, _ := body["presigned_urls"].([]any)
+	if len(urls) != 1 {
+		return fmt.Errorf("create-waypoints: %d presigned urls", len(urls))
+	}
+
+	entry, _ := urls[0].(map[string]any)
+	uploadURL, _ := entry["upload_url"].(string)
+	uploadToken, _ := entry["upload_token"].(string)
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPut, uploadURL, bytes.NewReader(payload),
+	)
+	if err != nil {
+		return fmt.Errorf("upload request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+uploadToken)
+
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		return fmt.Errorf("upload: %w", err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("upload: status %d", resp.StatusCode)
+	}
+
+	deadline := time.Now().Add(60 * time.Second)
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("route %s never became ready", routeID)
+		}
+
+		_, body, err = apiCall(http.MethodGet, routeURL, nil, authToken)
+		if err == nil {
+			route, _ := body["route"].(map[string]any)
+			if route != nil && route["route_status"] == "ready" {
+				break
+			}
+		}
+
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	status, _, err = apiCall(
+		http.MethodPost, routeURL+"/publish", map[string]any{}, authToken,
+	)
+	return expectStatus("publish", http.StatusOK, status, err)
+}
+
+// expectStatus turns an apiCall result into an error unless the call
+// succeeded with the wanted status.
+func expectStatus(op string, want, got int, err error) error {
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if got != want {
+		return fmt.Errorf("%s: status %d, want %d", op, got, want)
+	}
+
+	return nil
+}
+
+// apiCall is a goroutine-safe counterpart of doRequest + decodeJSON: it
+// reports transport and decode failures as errors instead of failing
+// the test. A non-JSON body yields a nil map.
+func apiCall(
+	method, rawURL string,
+	body any,
+	authToken string,
+) (int, map[string]any, error) {
+	var reqBody *bytes.Reader
+
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		reqBody = bytes.NewReader(encoded)
+	} else {
+		reqBody = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, rawURL, reqBody)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+authToken)
+	}
+
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	var decoded map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&decoded)
+
+	return resp.StatusCode, decoded, nil
+}
+
+// TestPagination_Boundaries checks page and page_size edge values on a
+// user with a known number of routes. Out-of-range values must either be
+// rejected with a JSON 400 or be clamped to the documented bounds
+// (page >= 1, 1 <= page_size <= 100); they must never produce a 5xx or
+// more than routesMaxPageSize routes.
+func TestPagination_Boundaries(t *testing.T) {
+	isolate(t, isolationParallel)
+
+	const stableRoutes = 3
+
+	_, token, _ := createAnonymousUser(t)
+	want := createPublishedRoutes(t, token, stableRoutes)
+
+	firstPage := fetchRoutesPage(t, token, nil, 1, routesDefaultPageSize)
+	require.ElementsMatch(t, want, firstPage.IDs)
+
+	tests := []struct {
+		name string
+		page string
+		size string
+		// wantIDs is what a 200 response must contain; nil means the
+		// page must be empty. When wantLen is set, the page must instead
+		// hold wantLen routes drawn from the user's routes.
+		wantIDs []string
+		wantLen int
+		// mayReject allows a 400 instead of (clamped) success.
+		mayReject bool
+	}{
+		{"PageZero", "0", "20", firstPage.IDs, 0, true},
+		{"PageNegative", "-1", "20", firstPage.IDs, 0, true},
+		{"PageNotANumber", "abc", "20", firstPage.IDs, 0, true},
+		{"PageOutOfRange", "2", "20", nil, 0, false},
+		{"PageHuge", "1000000", "20", nil, 0, false},
+		{"PageMaxInt32", strconv.Itoa(math.MaxInt32), "20", nil, 0, true},
+		{"PageMaxInt64", strconv.Itoa(math.MaxInt64), "20", nil, 0, true},
+		{"PageSizeMax", "1", strconv.Itoa(routesMaxPageSize), want, 0, false},
+		{"PageSizeOverMax", "1", "101", want, 0, true},
+		{"PageSizeHuge", "1", "1000000", want, 0, true},
+		{"PageSizeZero", "1", "0", want, 0, true},
+		{"PageSizeNegative", "1", "-5", want, 0, true},
+		{"PageSizeOne", "1", "1", nil, 1, false},
+		{"PageSizeTwoSecondPage", "2", "2", nil, 1, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			q := url.Values{"page": {tc.page}, "page_size": {tc.size}}
+
+			status, body, err := apiCall(
+				http.MethodGet, apiURL+"/api/v1/routes?"+q.Encode(),
+				nil, token,
+			)
+			require.NoError(t, err)
+			require.Lessf(t, status, http.StatusInternalServerError,
+				"page=%s page_size=%s must not be a server error",
+				tc.page, tc.size,
+			)
+			require.NotNilf(t, body,
+				"page=%s page_size=%s: response must be JSON",
+				tc.page, tc.size,
+			)
+
+			if status == http.StatusBadRequest {
+				assert.Truef(t, tc.mayReject,
+					"page=%s page_size=%s is valid and must not be rejected",
+					tc.page, tc.size,
+				)
+
+				return
+			}
+
+			require.Equal(t, http.StatusOK, status)
+
+			got := decodeRoutesPage(t, body)
+			assert.LessOrEqual(t, len(got.IDs), routesMaxPageSize,
+				"no response may exceed the maximum page_size",
+			)
+
+			if tc.wantLen > 0 {
+				assert.Len(t, got.IDs, tc.wantLen)
+				assert.Subset(t, want, got.IDs)
+			} else {
+				assert.ElementsMatch(t, tc.wantIDs, got.IDs)
+			}
+
+			if got.Pagination.PageSize != nil {
+				assert.LessOrEqual(t,
+					*got.Pagination.PageSize, routesMaxPageSize,
+					"pagination.page_size must be clamped to the maximum",
+				)
+				assert.GreaterOrEqual(t, *got.Pagination.PageSize, 1,
+					"pagination.page_size must be at least 1",
+				)
+			}
+		})
+	}
+}
@@ -0,0 +1,380 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// Tables the inspector reads, per the schema layout in the architecture
+// reference (section 4.4).
+const (
+	tableRoutes         = "route.routes"
+	tableWaypoints      = "route.waypoints"
+	tableImages         = "images.images"
+	tableAnonymousUsers = `"user".anonymous_users`
+	tableSessions       = `"user".sessions`
+)
+
+// postgresDSN resolves the connection string for the database the API
+// writes to. POSTGRES_DSN wins outright; otherwise the URL is built
+// from the POSTGRES_* keys that tests/integration/.env provides in
+// docker mode, falling back to a default local install.
+func postgresDSN() string {
+	if dsn := os.Getenv("POSTGRES_DSN"); dsn != "" {
+		return dsn
+	}
+
+	host := "localhost"
+	port := envOrDefault("POSTGRES_PORT", "5432")
+
+	if p := os.Getenv("POSTGRES_HOST_PORT"); p != "" {
+		host = envOrDefault("HOST_IP", "localhost")
+		port = p
+	}
+
+	dsn := url.URL{
+		Scheme: "postgres",
+		User: url.UserPassword(
+			envOrDefault("POSTGRES_USER", "follow"),
+			envOrDefault("POSTGRES_PASSWORD", "follow"),
+		),
+		Host: net.JoinHostPort(host, port),
+		Path: envOrDefault("POSTGRES_DB", "follow"),
+		RawQuery: url.Values{
+			"sslmode": {envOrDefault("POSTGRES_SSLMODE", "disable")},
+		}.Encode(),
+	}
+
+	return dsn.String()
+}
+
+// dbInspector is a read-only view of the API database for white-box
+// assertions. Writes are blocked twice: every session is opened with
+// default_transaction_read_only=on, and every statement is checked
+// client-side before it is sent.
+type dbInspector struct {
+	pool *pgxpool.Pool
+}
+
+// newDBInspector connects to the API database. The pool is closed when
+// t finishes.
+func newDBInspector(t *testing.T) *dbInspector {
+	t.Helper()
+
+	in, err := openDBInspector(context.Background())
+	require.NoError(t, err,
+		"newDBInspector: set POSTGRES_DSN to point at the API database",
+	)
+
+	t.Cleanup(in.Close)
+
+	return in
+}
+
+// openDBInspector is newDBInspector for callers without a test, such
+// as the end-of-suite checks. The caller closes it.
+func openDBInspector(ctx context.Context) (*dbInspector, error) {
+	cfg, err := pgxpool.ParseConfig(postgresDSN())
+	if err != nil {
+		return nil, fmt.Errorf("db inspector: invalid DSN: %w", err)
+	}
+
+	cfg.MaxConns = 4
+	cfg.ConnConfig.RuntimeParams["default_transaction_read_only"] = "on"
+	cfg.ConnConfig.RuntimeParams["application_name"] = "follow-integration"
+
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("db inspector: failed to create pool: %w", err)
+	}
+
+	err = pool.Ping(ctx)
+	if err != nil {
+		pool.Close()
+
+		return nil, fmt.Errorf("db inspector: database unreachable: %w", err)
+	}
+
+	return &dbInspector{pool: pool}, nil
+}
+
+// Close closes the connection pool.
+func (in *dbInspector) Close() {
+	in.pool.Close()
+}
+
+// readOnlyKeywords are the statement types the inspector will send.
+var readOnlyKeywords = []string{"SELECT", "WITH", "SHOW", "EXPLAIN"}
+
+// guardReadOnly rejects anything that is not a single read statement.
+// A WITH must not contain a data-modifying CTE.
+func guardReadOnly(sql string) error {
+	trimmed := strings.TrimSpace(sql)
+	trimmed = strings.TrimSuffix(trimmed, ";")
+
+	if strings.Contains(trimmed, ";") {
+		return fmt.Errorf("db inspector: multiple statements in %q", sql)
+	}
+
+	fields := strings.Fields(strings.ToUpper(trimmed))
+	if len(fields) == 0 {
+		return fmt.Errorf("db inspector: empty statement")
+	}
+
+	if !slices.Contains(readOnlyKeywords, fields[0]) {
+		return fmt.Errorf("db inspector: %s is not read-only", fields[0])
+	}
+
+	for _, f := range fields[1:] {
+		switch strings.TrimLeft(f, "(") {
+		case "INSERT", "UPDATE", "DELETE", "MERGE", "TRUNCATE":
+			return fmt.Errorf(
+				"db inspector: data-modifying %s in %q", f, sql,
+			)
+		}
+	}
+
+	return nil
+}
+
+// queryRow runs a guarded single-row query. It takes no testing.T so
+// polling helpers can treat errors as data.
+func (in *dbInspector) queryRow(
+	ctx context.Context,
+	sql string,
+	args ...any,
+) pgx.Row {
+	if err := guardReadOnly(sql); err != nil {
+		return errRow{err}
+	}
+
+	return in.pool.QueryRow(ctx, sql, args...)
+}
+
+// errRow is a pgx.Row that only reports err.
+type errRow struct{ err error }
+
+func (r errRow) Scan(...any) error { return r.err }
+
+// jsonRows runs SELECT to_jsonb(r) FROM table r WHERE where and returns
+// one JSON object per row. Going through to_jsonb keeps the typed
+// helpers below tolerant of columns added by later migrations.
+func (in *dbInspector) jsonRows(
+	t *testing.T,
+	table string,
+	where string,
+	args ...any,
+) []json.RawMessage {
+	t.Helper()
+
+	sql := fmt.Sprintf(
+		"SELECT to_jsonb(r) FROM %s r WHERE %s", table, where,
+	)
+	require.NoError(t, guardReadOnly(sql))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := in.pool.Query(ctx, sql, args...)
+	require.NoErrorf(t, err, "db inspector: query %s", table)
+
+	out, err := pgx.CollectRows(rows, pgx.RowTo[json.RawMessage])
+	require.NoErrorf(t, err, "db inspector: scan %s", table)
+
+	return out
+}
+
+// inspectRows decodes jsonRows into T. Every typed row embeds
+// dbColumns, which also receives the full column map so a test can
+// reach columns the struct does not name.
+func inspectRows[T any](
+	t *testing.T,
+	in *dbInspector,
+	table string,
+	where string,
+	args ...any,
+) []T {
+	t.Helper()
+
+	raw := in.jsonRows(t, table, where, args...)
+	out := make([]T, len(raw))
+
+	for i, r := range raw {
+		require.NoErrorf(t, json.Unmarshal(r, &out[i]),
+			"db inspector: decode %s row", table,
+		)
+
+		if row, ok := any(&out[i]).(columnSetter); ok {
+			require.NoError(t, row.setColumns(r))
+		}
+	}
+
+	return out
+}
+
+// columnSetter is implemented by rows embedding dbColumns.
+type columnSetter interface {
+	setColumns(data []byte) error
+}
+
+// dbColumns holds every column of a row, keyed by column name.
+type dbColumns struct {
+	Columns map[string]any `json:"-"`
+}
+
+func (c *dbColumns) setColumns(data []byte) error {
+	return json.Unmarshal(data, &c.Columns)
+}
+
+// dbTime decodes both timestamptz and zone-less timestamp values as
+// rendered by to_jsonb.
+type dbTime struct{ time.Time }
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *dbTime) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil || s == "" {
+		return err
+	}
+
+	for _, layout := range []string{
+		time.RFC3339Nano, "2006-01-02T15:04:05.999999999",
+	} {
+		if ts, err := time.Parse(layout, s); err == nil {
+			d.Time = ts
+			return nil
+		}
+	}
+
+	return fmt.Errorf("db inspector: unrecognised timestamp %q", s)
+}
+
+// dbRoute is a row of route.routes.
+type dbRoute struct {
+	dbColumns
+
+	ID          string  `json:"id"`
+	OwnerID     string  `json:"owner_id"`
+	RouteStatus string  `json:"route_status"`
+	Visibility  string  `json:"visibility"`
+	Version     int     `json:"version"`
+	CreatedAt   dbTime  `json:"created_at"`
+	UpdatedAt   dbTime  `json:"updated_at"`
+	DeletedAt   *dbTime `json:"deleted_at"`
+}
+
+// dbWaypoint is a row of route.waypoints.
+type dbWaypoint struct {
+	dbColumns
+
+	ID                        string  `json:"id"`
+	RouteID                   string  `json:"route_id"`
+	Position                  int     `json:"position"`
+	ImageID                   string  `json:"image_id"`
+	PendingReplacementImageID *string `json:"pending_replacement_image_id"`
+	MarkerX                   float64 `json:"marker_x"`
+	MarkerY                   float64 `json:"marker_y"`
+}
+
+// dbImage is a row of images.images (see section 8.2).
+type dbImage struct {
+	dbColumns
+
+	ID              string `json:"id"`
+	StorageKey      string `json:"storage_key"`
+	ContentType     string `json:"content_type"`
+	FileSizeBytes   int64  `json:"file_size_bytes"`
+	Status          string `json:"status"`
+	SHA256          string `json:"sha256"`
+	ETag            string `json:"etag"`
+	ProcessedWidth  int    `json:"processed_width"`
+	ProcessedHeight int    `json:"processed_height"`
+	ErrorCode       string `json:"error_code"`
+}
+
+// dbUser is a row of "user".anonymous_users.
+type dbUser struct {
+	dbColumns
+
+	ID        string `json:"id"`
+	CreatedAt dbTime `json:"created_at"`
+}
+
+// dbSession is a row of "user".sessions.
+type dbSession struct {
+	dbColumns
+
+	ID        string  `json:"id"`
+	UserID    string  `json:"user_id"`
+	CreatedAt dbTime  `json:"created_at"`
+	ExpiresAt dbTime  `json:"expires_at"`
+	RevokedAt *dbTime `json:"revoked_at"`
+}
+
+// route returns the route row for id, or nil if there is none.
+func (in *dbInspector) route(t *testing.T, id string) *dbRoute {
+	t.Helper()
+
+	return firstOrNil(
+		inspectRows[dbRoute](t, in, tableRoutes, "id = $1", id),
+	)
+}
+
+// waypoints returns the waypoint rows of routeID ordered by position.
+func (in *dbInspector) waypoints(t *testing.T, routeID string) []dbWaypoint {
+	t.Helper()
+
+	return inspectRows[dbWaypoint](t, in, tableWaypoints,
+		"route_id = $1 ORDER BY position", routeID,
+	)
+}
+
+// image returns the image row for id, or nil if there is none.
+func (in *dbInspector) image(t *testing.T, id string) *dbImage {
+	t.Helper()
+
+	return firstOrNil(
+		inspectRows[dbImage](t, in, tableImages, "id = $1", id),
+	)
+}
+
+// user returns the user row for id, or nil if there is none.
+func (in *dbInspector) user(t *testing.T, id string) *dbUser {
+	t.Helper()
+
+	return firstOrNil(
+		inspectRows[dbUser](t, in, tableAnonymousUsers, "id = $1", id),
+	)
+}
+
+// sessions returns the session rows of userID, newest first.
+func (in *dbInspector) sessions(t *testing.T, userID string) []dbSession {
+	t.Helper()
+
+	return inspectRows[dbSession](t, in, tableSessions,
+		"user_id = $1 ORDER BY created_at DESC", userID,
+	)
+}
+
+// firstOrNil returns a pointer to the first row, or nil when empty.
+func firstOrNil[T any](rows []T) *T {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	return &rows[0]
+}
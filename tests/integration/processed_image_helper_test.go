@@ -0,0 +1,285 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"bytes"
+	"crypto/md5" //nolint:gosec // MinIO single-part ETag is an MD5 digest
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	valkeygo "github.com/valkey-io/valkey-go"
+	"github.com/yoseforb/follow-pkg/valkey"
+	"golang.org/x/image/webp"
+)
+
+// defaultGatewayMaxImageWidth mirrors the gateway's IMG_GW_MAX_IMAGE_WIDTH
+// default (architecture section 8.1).
+const defaultGatewayMaxImageWidth = 1920
+
+// processedImage is a processed navigation image downloaded from MinIO via
+// its presigned URL, together with the HTTP metadata MinIO served it with.
+type processedImage struct {
+	Bytes       []byte
+	ContentType string
+	ETag        string
+	Width       int
+	Height      int
+}
+
+// gatewayMaxImageWidth returns the resize threshold the gateway under
+// test was started with. Honours IMG_GW_MAX_IMAGE_WIDTH so a run against
+// a gateway with a non-default limit still asserts the right rule.
+func gatewayMaxImageWidth(t *testing.T) int {
+	t.Helper()
+
+	raw := envOrDefault(
+		"IMG_GW_MAX_IMAGE_WIDTH",
+		strconv.Itoa(defaultGatewayMaxImageWidth),
+	)
+
+	width, err := strconv.Atoi(raw)
+	require.NoError(t, err,
+		"gatewayMaxImageWidth: IMG_GW_MAX_IMAGE_WIDTH=%q is not an int",
+		raw,
+	)
+
+	return width
+}
+
+// expectedProcessedSize applies the section 8.1 resize formula: images
+// wider than maxWidth are scaled down to maxWidth keeping aspect ratio;
+// anything else keeps its original dimensions (never upscale, never crop).
+func expectedProcessedSize(origW, origH, maxWidth int) (int, int) {
+	if origW <= maxWidth {
+		return origW, origH
+	}
+
+	scale := float64(maxWidth) / float64(origW)
+
+	return maxWidth, int(math.Round(float64(origH) * scale))
+}
+
+// fetchProcessedImage downloads the processed object from a presigned
+// download URL and decodes it as WebP. Calls t.Fatal if the download
+// fails or the bytes are not a decodable WebP image.
+func fetchProcessedImage(
+	t *testing.T,
+	downloadURL string,
+) processedImage {
+	t.Helper()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	resp, err := client.Get(downloadURL)
+	require.NoError(t, err,
+		"fetchProcessedImage: GET presigned URL failed",
+	)
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err,
+		"fetchProcessedImage: failed to read object body",
+	)
+	require.Equal(t, http.StatusOK, resp.StatusCode,
+		"fetchProcessedImage: unexpected status; body: %s", data,
+	)
+
+	cfg, err := webp.DecodeConfig(bytes.NewReader(data))
+	require.NoError(t, err,
+		"fetchProcessedImage: processed object is not a valid WebP",
+	)
+
+	_, err = webp.Decode(bytes.NewReader(data))
+	require.NoError(t, err,
+		"fetchProcessedImage: WebP header parses but pixels do not decode",
+	)
+
+	return processedImage{
+		Bytes:       data,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        strings.Trim(resp.Header.Get("ETag"), `"`),
+		Width:       cfg.Width,
+		Height:      cfg.Height,
+	}
+}
+
+// verifyProcessedImage checks a downloaded processed image against the
+// success message the gateway published on image:result for it:
+//
+//   - object and message content type are image/webp
+//   - decoded dimensions equal processed_width/processed_height
+//   - processed dimensions follow the section 8.1 resize rules
+//   - sha256, etag and file_size describe exactly the downloaded bytes
+func verifyProcessedImage(
+	t *testing.T,
+	img processedImage,
+	result streamMessage,
+) {
+	t.Helper()
+
+	f := result.Fields
+	imageID := f[valkey.ResultFieldImageID]
+
+	require.Equal(t, valkey.ResultStatusProcessed, f[valkey.ResultFieldStatus],
+		"image %s: result message is not a success message", imageID,
+	)
+
+	assert.Equal(t, "image/webp", f[valkey.ResultFieldContentType],
+		"image %s: result content_type", imageID,
+	)
+	assert.Equal(t, "image/webp", img.ContentType,
+		"image %s: MinIO served Content-Type", imageID,
+	)
+	assert.Truef(t,
+		strings.HasSuffix(f[valkey.ResultFieldStorageKey], ".webp"),
+		"image %s: storage_key %q must end in .webp",
+		imageID, f[valkey.ResultFieldStorageKey],
+	)
+
+	processedW := resultInt(t, result, valkey.ResultFieldProcessedWidth)
+	processedH := resultInt(t, result, valkey.ResultFieldProcessedHeight)
+	originalW := resultInt(t, result, valkey.ResultFieldOriginalWidth)
+	originalH := resultInt(t, result, valkey.ResultFieldOriginalHeight)
+
+	assert.Equal(t, processedW, img.Width,
+		"image %s: decoded width vs processed_width", imageID,
+	)
+	assert.Equal(t, processedH, img.Height,
+		"image %s: decoded height vs processed_height", imageID,
+	)
+
+	wantW, wantH := expectedProcessedSize(
+		originalW, originalH, gatewayMaxImageWidth(t),
+	)
+	assert.Equal(t, wantW, processedW,
+		"image %s: processed_width for original %dx%d",
+		imageID, originalW, originalH,
+	)
+	// round() in the resize formula may land either side of .5 depending
+	// on float precision in the gateway's implementation.
+	assert.InDelta(t, wantH, processedH, 1,
+		"image %s: processed_height for original %dx%d",
+		imageID, originalW, originalH,
+	)
+
+	sum := sha256.Sum256(img.Bytes)
+	assert.Equal(t, hex.EncodeToString(sum[:]), f[valkey.ResultFieldSHA256],
+		"image %s: sha256 must match downloaded bytes", imageID,
+	)
+
+	assert.Equal(t,
+		strconv.Itoa(len(img.Bytes)), f[valkey.ResultFieldFileSize],
+		"image %s: file_size must match downloaded length", imageID,
+	)
+
+	etag := strings.Trim(f[valkey.ResultFieldETag], `"`)
+	assert.Equal(t, etag, img.ETag,
+		"image %s: result etag must match the object's ETag", imageID,
+	)
+
+	// Single-part PutObject ETags are the hex MD5 of the content;
+	// multipart ETags carry a "-N" part-count suffix and are opaque.
+	if !strings.Contains(etag, "-") {
+		digest := md5.Sum(img.Bytes) //nolint:gosec // see import comment
+		assert.Equal(t, hex.EncodeToString(digest[:]), etag,
+			"image %s: etag must be the MD5 of the object bytes", imageID,
+		)
+	}
+}
+
+// uploadAndProcess creates a route with the single waypoint body,
+// uploads payload as its image and waits until the image is processed
+// and the route is ready. The route is deleted when the test ends.
+// Returns the route, the image and its image:result message.
+func uploadAndProcess(
+	t *testing.T,
+	vc valkeygo.Client,
+	token string,
+	waypoint map[string]any,
+	payload []byte,
+) (routeID, imageID string, result streamMessage) {
+	t.Helper()
+
+	routeID = prepareRoute(t, token)
+	t.Cleanup(func() { deleteRoute(t, routeID, token) })
+
+	route := createRouteWithWaypointBodies(
+		t, token, routeID, []map[string]any{waypoint},
+	)
+	require.Len(t, route.PresignedURLs, 1)
+
+	upload := route.PresignedURLs[0]
+	result = uploadProcessed(t, vc, upload, payload)
+
+	waitForRouteReady(t, routeID, token, 30*time.Second)
+
+	return routeID, upload.ImageID, result
+}
+
+// uploadProcessed uploads payload with upload's token and waits for
+// the gateway to report the image processed.
+func uploadProcessed(
+	t *testing.T,
+	vc valkeygo.Client,
+	upload PresignedURLEntry,
+	payload []byte,
+) streamMessage {
+	t.Helper()
+
+	startID := fmt.Sprintf("%d-0", time.Now().UnixMilli())
+
+	resp := uploadToGateway(t, upload.UploadURL, upload.UploadToken, payload)
+	resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode,
+		"gateway must accept the upload",
+	)
+
+	return awaitProcessed(t, vc, upload.ImageID, startID)
+}
+
+// awaitProcessed waits for imageID's image:result message from startID
+// on and requires it to report success.
+func awaitProcessed(
+	t *testing.T,
+	vc valkeygo.Client,
+	imageID, startID string,
+) streamMessage {
+	t.Helper()
+
+	result := waitForResultMessage(t, vc, imageID, startID, 60*time.Second)
+	require.Equal(t,
+		valkey.ResultStatusProcessed,
+		result.Fields[valkey.ResultFieldStatus],
+		"processing failed: error_code=%s message=%s",
+		result.Fields[valkey.ResultFieldErrorCode],
+		result.Fields[valkey.ResultFieldErrorMessage],
+	)
+
+	return result
+}
+
+// resultInt parses an integer field of an image:result message.
+func resultInt(t *testing.T, result streamMessage, field string) int {
+	t.Helper()
+
+	raw := result.Fields[field]
+
+	v, err := strconv.Atoi(raw)
+	require.NoErrorf(t, err,
+		"resultInt: %s=%q on message %s is not an int",
+		field, raw, result.ID,
+	)
+
+	return v
+}
@@ -0,0 +1,114 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yoseforb/follow-pkg/valkey"
+)
+
+// processedImageCase is one upload whose processed output is verified
+// byte-for-byte against its image:result message.
+type processedImageCase struct {
+	Name string
+	// Build returns the upload payload. OrigW/OrigH, when non-zero, are
+	// the pixel dimensions of the payload and are asserted against the
+	// original_width/original_height the gateway reports.
+	Build func(t *testing.T) []byte
+	OrigW int
+	OrigH int
+}
+
+// processedImageCases covers both sides of the section 8.1 resize
+// threshold with generated JPEGs plus the real photos used elsewhere.
+func processedImageCases(maxWidth int) []processedImageCase {
+	generated := func(w, h int) processedImageCase {
+		return processedImageCase{
+			Name:  fmt.Sprintf("Generated%dx%d", w, h),
+			Build: func(t *testing.T) []byte { return jpegBytes(t, w, h) },
+			OrigW: w,
+			OrigH: h,
+		}
+	}
+
+	cases := []processedImageCase{
+		// Smaller than the limit: never upscaled.
+		generated(640, 480),
+		// Exactly the limit: kept as is.
+		generated(maxWidth, maxWidth*9/16),
+		// Wider than the limit: downscaled, height rounded.
+		generated(maxWidth+481, 1003),
+		// Tall portrait narrower than the limit: height is not capped.
+		generated(maxWidth/2, maxWidth*2),
+	}
+
+	for _, spec := range defaultTestImages {
+		filename := spec.Filename
+		cases = append(cases, processedImageCase{
+			Name: "Testdata_" + filename,
+			Build: func(t *testing.T) []byte {
+				return loadTestImage(t, filename)
+			},
+		})
+	}
+
+	return cases
+}
+
+// TestProcessedImage_OutputMatchesResult uploads each case, fetches the
+// processed WebP through the navigation_image_url the API hands out,
+// and verifies it against the gateway's image:result message: decoded
+// dimensions, resize rules, sha256, etag, file_size and content type.
+func TestProcessedImage_OutputMatchesResult(t *testing.T) {
+	isolate(t, isolationParallel)
+	shareState(t, stateImageResults)
+
+	_, token, _ := createAnonymousUser(t)
+	vc := newValkeyClient(t)
+
+	maxWidth := gatewayMaxImageWidth(t)
+
+	for _, tc := range processedImageCases(maxWidth) {
+		t.Run(tc.Name, func(t *testing.T) {
+			payload := tc.Build(t)
+
+			routeID, imageID, result := uploadAndProcess(t, vc, token,
+				buildWaypointBody(0, tc.Name+".jpg", len(payload)),
+				payload,
+			)
+
+			if tc.OrigW != 0 {
+				assert.Equal(t, strconv.Itoa(tc.OrigW),
+					result.Fields[valkey.ResultFieldOriginalWidth],
+					"original_width must be the uploaded width",
+				)
+				assert.Equal(t, strconv.Itoa(tc.OrigH),
+					result.Fields[valkey.ResultFieldOriginalHeight],
+					"original_height must be the uploaded height",
+				)
+			}
+
+			assert.Contains(t,
+				result.Fields[valkey.ResultFieldStorageKey], imageID,
+				"storage_key must embed the image ID",
+			)
+
+			img := fetchProcessedImage(
+				t, waypointImageURL(t, routeID, token, imageID),
+			)
+			verifyProcessedImage(t, img, result)
+
+			t.Logf(
+				"%s: original %sx%s -> processed %dx%d, %d bytes",
+				tc.Name,
+				result.Fields[valkey.ResultFieldOriginalWidth],
+				result.Fields[valkey.ResultFieldOriginalHeight],
+				img.Width, img.Height, len(img.Bytes),
+			)
+		})
+	}
+}
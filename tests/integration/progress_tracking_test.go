@@ -16,6 +16,8 @@ import (
 // writes {stage: "queued"} to image:status:{image_id} hash immediately when
 // creating a route (before any upload occurs).
 func TestValkeyProgressTracking_InitialStatusSetByAPI(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	_, token, _ := createAnonymousUser(t)
 	routeID := prepareRoute(t, token)
 	route := createRouteWithWaypoints(t, token, routeID, defaultTestImages)
@@ -44,6 +46,8 @@ func TestValkeyProgressTracking_InitialStatusSetByAPI(t *testing.T) {
 func TestValkeyProgressTracking_StageTransitionsOnUpload(
 	t *testing.T,
 ) {
+	isolate(t, isolationParallel)
+
 	_, token, _ := createAnonymousUser(t)
 	routeID := prepareRoute(t, token)
 	route := createRouteWithWaypoints(t, token, routeID, defaultTestImages)
@@ -97,6 +101,8 @@ func TestValkeyProgressTracking_StageTransitionsOnUpload(
 // TestValkeyProgressTracking_TTLSet verifies that the image:status:{id} hash
 // key has a TTL (it must expire eventually — no orphan keys).
 func TestValkeyProgressTracking_TTLSet(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	_, token, _ := createAnonymousUser(t)
 	routeID := prepareRoute(t, token)
 	route := createRouteWithWaypoints(t, token, routeID, defaultTestImages)
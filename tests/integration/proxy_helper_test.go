@@ -0,0 +1,113 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// caddyComposeFile is the override that adds Caddy in proxy mode,
+// relative to the project root.
+const caddyComposeFile = "tests/integration/docker-compose.caddy.test.yml"
+
+// caddyRootCertPath is where Caddy keeps the root of its internal CA,
+// which signs the certificate for https://localhost.
+const caddyRootCertPath = "/data/caddy/pki/authorities/local/root.crt"
+
+// Direct service addresses, bypassing Caddy. Only set in proxy mode,
+// where apiURL and gatewayURL point at the proxy.
+var (
+	directAPIURL     string
+	directGatewayURL string
+)
+
+// proxyMode reports whether the suite runs behind Caddy.
+func proxyMode() bool {
+	return envOrDefault("INTEGRATION_TEST_MODE", "local") == "proxy"
+}
+
+// setProxyServiceURLs routes the API and gateway through Caddy. The
+// site is served as "localhost" whatever HOST_IP says, since that is
+// the name in Caddyfile.local and on its certificate. Caddyfile.local
+// strips the /upload prefix before the gateway sees the request.
+func setProxyServiceURLs(envMap map[string]string) {
+	directAPIURL, directGatewayURL = apiURL, gatewayURL
+
+	base := "https://localhost:" + envMap["CADDY_HTTPS_HOST_PORT"]
+	apiURL = base
+	gatewayURL = base + "/upload"
+}
+
+// trustCaddyRoot copies Caddy's root certificate out of the container
+// and points SSL_CERT_FILE at it. Go loads the system roots on first
+// use, so every client in the run (and any fuzz worker, which inherits
+// the environment) then trusts the proxy without per-client TLS
+// configuration. Nothing else in the suite speaks TLS.
+func trustCaddyRoot(ctx context.Context) {
+	c, err := composeStack.ServiceContainer(ctx, "caddy")
+	if err != nil {
+		log.Error().Err(err).Msg("proxy mode: no caddy container")
+		os.Exit(1)
+	}
+
+	var pem []byte
+
+	// Caddy creates its CA while loading the config, which may finish
+	// just after the healthcheck first passes.
+	for range 10 {
+		rc, err := c.CopyFileFromContainer(ctx, caddyRootCertPath)
+		if err == nil {
+			pem, err = io.ReadAll(rc)
+			rc.Close()
+		}
+
+		if err == nil && len(pem) > 0 {
+			break
+		}
+
+		time.Sleep(time.Second)
+	}
+
+	if len(pem) == 0 {
+		log.Error().Str("path", caddyRootCertPath).
+			Msg("proxy mode: caddy root certificate not found")
+		os.Exit(1)
+	}
+
+	f, err := os.CreateTemp("", "follow-caddy-root-*.crt")
+	if err == nil {
+		_, err = f.Write(pem)
+		f.Close()
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("proxy mode: cannot store caddy root")
+		os.Exit(1)
+	}
+
+	err = os.Setenv("SSL_CERT_FILE", f.Name())
+	if err != nil {
+		log.Error().Err(err).Msg("proxy mode: cannot set SSL_CERT_FILE")
+		os.Exit(1)
+	}
+
+	log.Info().Str("root", f.Name()).Msg("proxy mode: trusting caddy CA")
+}
+
+// countingReader records how many bytes of a request body were sent.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+
+	return n, err
+}
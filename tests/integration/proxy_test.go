@@ -0,0 +1,305 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// proxyBodyLimits are the request_body limits in Caddyfile.local.
+const (
+	proxyAPIBodyLimit    = 1 << 20
+	proxyUploadBodyLimit = 15 << 20
+)
+
+// proxySecurityHeaders are the headers Caddy must add to every
+// response, with the value each must have.
+var proxySecurityHeaders = map[string]string{
+	"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+	"X-Content-Type-Options":    "nosniff",
+	"X-Frame-Options":           "DENY",
+	"Referrer-Policy":           "no-referrer",
+}
+
+// TestReverseProxy checks what Caddy adds on top of the services when
+// the suite runs with INTEGRATION_TEST_MODE=proxy: security headers,
+// body limits, unbuffered SSE and Expect: 100-continue passthrough.
+func TestReverseProxy(t *testing.T) {
+	isolate(t, isolationParallel, labelProxy, labelSecurity)
+
+	t.Run("SecurityHeaders", func(t *testing.T) {
+		for _, target := range []string{
+			apiURL + "/health",
+			gatewayURL + "/health",
+			apiURL + "/api/v1/routes", // 401, still through the proxy
+		} {
+			resp := doRequest(t, http.MethodGet, target, nil, "")
+			resp.Body.Close()
+
+			for name, want := range proxySecurityHeaders {
+				assert.Equalf(t, want, resp.Header.Get(name),
+					"%s: %s", target, name,
+				)
+			}
+
+			assert.Emptyf(t, resp.Header.Get("Server"),
+				"%s: the proxy must not advertise itself", target,
+			)
+		}
+	})
+
+	t.Run("RequestBodyLimits", func(t *testing.T) {
+		_, token, _ := createAnonymousUser(t)
+
+		// A login body past the API limit.
+		oversized := `{"email":"` + strings.Repeat("a", proxyAPIBodyLimit) +
+			`@example.com","password":"x"}`
+
+		req, err := http.NewRequest(http.MethodPost,
+			apiURL+"/api/v1/auth/login", strings.NewReader(oversized),
+		)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode,
+			"API bodies over 1MB must be refused at the proxy",
+		)
+
+		// Uploads past the gateway's own cap and past the proxy's.
+		payload := jpegBytes(t, 64, 64)
+		created := createRouteWithWaypointBodies(t, token,
+			prepareRoute(t, token),
+			[]map[string]any{
+				buildWaypointBody(0, "proxy.jpg", len(payload)),
+			},
+		)
+		require.Len(t, created.PresignedURLs, 1)
+
+		upload := created.PresignedURLs[0]
+		require.Truef(t,
+			strings.HasPrefix(upload.UploadURL, gatewayURL),
+			"upload URL %s must go through the proxy", upload.UploadURL,
+		)
+
+		for _, size := range []int{
+			gatewayMaxUploadBytes + 1, proxyUploadBodyLimit + 1,
+		} {
+			resp, err := uploadToGatewayWithExpectContinue(
+				upload.UploadURL, upload.UploadToken, make([]byte, size),
+			)
+			require.NoErrorf(t, err, "upload of %d bytes", size)
+			resp.Body.Close()
+			assert.Equalf(t,
+				http.StatusRequestEntityTooLarge, resp.StatusCode,
+				"upload of %d bytes", size,
+			)
+		}
+
+		resp = uploadToGateway(t,
+			upload.UploadURL, upload.UploadToken, payload,
+		)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode,
+			"an upload within the limits must still go through",
+		)
+	})
+
+	t.Run("SSEUnbuffered", func(t *testing.T) {
+		assertSSEUnbuffered(t)
+	})
+
+	t.Run("ExpectContinue", func(t *testing.T) {
+		// A rejected upload must be answered before the body is sent:
+		// Caddy has to pass the Expect header to the gateway instead of
+		// answering 100 Continue itself, which its transport only does
+		// with expect_continue_timeout set (see Caddyfile.local).
+		body := &countingReader{r: bytes.NewReader(make([]byte, 1<<20))}
+
+		req, err := http.NewRequest(http.MethodPut,
+			gatewayURL+"/api/v1/upload", body,
+		)
+		require.NoError(t, err)
+		req.ContentLength = 1 << 20
+		req.Header.Set("Authorization", "Bearer not-a-token")
+		req.Header.Set("Expect", "100-continue")
+
+		client := &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: secretScanning(&http.Transport{
+				DisableKeepAlives:     true,
+				ExpectContinueTimeout: 5 * time.Second,
+			}),
+		}
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Zero(t, body.n,
+			"the body was sent before the gateway answered, so the "+
+				"proxy answered 100 Continue on its own",
+		)
+
+		// And an accepted one still completes.
+		_, token, _ := createAnonymousUser(t)
+		payload := jpegBytes(t, 64, 64)
+		created := createRouteWithWaypointBodies(t, token,
+			prepareRoute(t, token),
+			[]map[string]any{
+				buildWaypointBody(0, "proxy.jpg", len(payload)),
+			},
+		)
+		require.Len(t, created.PresignedURLs, 1)
+
+		resp, err = uploadToGatewayWithExpectContinue(
+			created.PresignedURLs[0].UploadURL,
+			created.PresignedURLs[0].UploadToken,
+			payload,
+		)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	})
+}
+
+// assertSSEUnbuffered opens a route's status stream through the proxy,
+// uploads the route's image and checks that events arrive as they
+// happen. A buffering proxy delivers the whole stream at once when the
+// upstream closes it, so the events' arrival times would bunch up.
+func assertSSEUnbuffered(t *testing.T) {
+	t.Helper()
+
+	_, token, _ := createAnonymousUser(t)
+	payload := jpegBytes(t, 640, 480)
+	routeID := prepareRoute(t, token)
+	created := createRouteWithWaypointBodies(t, token, routeID,
+		[]map[string]any{
+			buildWaypointBody(0, "proxy.jpg", len(payload)),
+		},
+	)
+	require.Len(t, created.PresignedURLs, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		apiURL+"/api/v1/routes/"+routeID+"/status/stream", nil,
+	)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+
+	resp, err := (&http.Client{Timeout: 0}).Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	upload := created.PresignedURLs[0]
+	uploadResp := uploadToGateway(t,
+		upload.UploadURL, upload.UploadToken, payload,
+	)
+	uploadResp.Body.Close()
+	require.Equal(t, http.StatusAccepted, uploadResp.StatusCode)
+
+	uploaded := time.Now()
+	events := make(chan SSEEvent, 100)
+	go readSSEEvents(reportContext(ctx, t), resp.Body, events)
+
+	var arrivals []time.Time
+
+	for event := range events {
+		arrivals = append(arrivals, time.Now())
+		t.Logf("SSE via proxy: %s %s after upload",
+			event.Type, time.Since(uploaded),
+		)
+
+		if event.Type == "complete" {
+			break
+		}
+	}
+
+	require.GreaterOrEqual(t, len(arrivals), 2,
+		"need at least two events to judge buffering",
+	)
+
+	// Processing takes seconds, so unbuffered events are spread out.
+	spread := arrivals[len(arrivals)-1].Sub(arrivals[0])
+	assert.Greaterf(t, spread, 250*time.Millisecond,
+		"%d events arrived within %s: the proxy is buffering the stream",
+		len(arrivals), spread,
+	)
+}
+
+// TestReverseProxy_ForwardedClientIP checks that the rate limiter sees
+// the client's address through the proxy, not Caddy's, and that a
+// client cannot pick its own address with X-Forwarded-For. Needs the
+// rate-limit profile as well:
+//
+//	INTEGRATION_TEST_MODE=proxy \
+//	COMPOSE_EXTRA_FILES=tests/integration/docker-compose.ratelimit.test.yml \
+//	go test -tags=integration -run TestReverseProxy_ForwardedClientIP ./...
+//
+// The host reaches both Caddy and follow-api's published port from the
+// same docker bridge address, so once a budget is spent through the
+// proxy a direct request must be throttled too. Had the limiter keyed
+// on Caddy's address, the direct request would have a fresh budget.
+func TestReverseProxy_ForwardedClientIP(t *testing.T) {
+	isolate(t, isolationDestructive, labelProxy, labelSecurity)
+
+	if !strings.Contains(
+		os.Getenv("COMPOSE_EXTRA_FILES"), rateLimitComposeFile,
+	) {
+		t.Skipf("start the stack with COMPOSE_EXTRA_FILES=%s",
+			rateLimitComposeFile,
+		)
+	}
+
+	e := rateLimitedEndpoints()[0]
+	exhaustRateLimit(t, http.DefaultClient, e)
+
+	send := func(base string, header http.Header) int {
+		req, err := http.NewRequest(e.Method, base+e.Path, nil)
+		require.NoError(t, err)
+
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusTooManyRequests,
+		send(apiURL, http.Header{
+			"X-Forwarded-For": {"203.0.113.7"},
+			"X-Real-Ip":       {"203.0.113.7"},
+		}),
+		"a spoofed X-Forwarded-For must not buy a fresh budget",
+	)
+
+	assert.Equal(t, http.StatusTooManyRequests, send(directAPIURL, nil),
+		"the budget spent through the proxy must belong to the client "+
+			"address, not to the proxy's",
+	)
+}
@@ -0,0 +1,223 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// rateLimitComposeFile is the docker-mode override that turns the
+// limiter on. Pass it through COMPOSE_EXTRA_FILES to run the suite.
+const rateLimitComposeFile = "tests/integration/" +
+	"docker-compose.ratelimit.test.yml"
+
+// rateLimitProbeMax bounds how many requests a suite sends while
+// looking for the first 429, RATE_LIMIT_PROBE_MAX or 300. The profile
+// runs at follow-api's own limits, so this must stay above them.
+func rateLimitProbeMax(t *testing.T) int {
+	t.Helper()
+
+	n, err := strconv.Atoi(envOrDefault("RATE_LIMIT_PROBE_MAX", "300"))
+	require.NoError(t, err, "RATE_LIMIT_PROBE_MAX must be an integer")
+	require.Positive(t, n, "RATE_LIMIT_PROBE_MAX must be positive")
+
+	return n
+}
+
+// rateLimitProfileEnv starts follow-api with the limiter on.
+// RATE_LIMIT_ENABLED is the only limiter setting the stack defines;
+// the limits are follow-api's defaults, which exhaustRateLimit
+// measures rather than assumes. Keep it in sync with
+// docker-compose.ratelimit.test.yml. RATE_LIMIT_PROFILE_ENV (comma-
+// separated KEY=VALUE pairs) is appended, so limits can be tuned
+// without editing the suite.
+func rateLimitProfileEnv() []string {
+	env := []string{"RATE_LIMIT_ENABLED=true"}
+
+	if extra := os.Getenv("RATE_LIMIT_PROFILE_ENV"); extra != "" {
+		for kv := range strings.SplitSeq(extra, ",") {
+			env = append(env, strings.TrimSpace(kv))
+		}
+	}
+
+	return env
+}
+
+// enableRateLimitProfile switches the running stack to the rate-limit
+// profile for the rest of the test. In local mode follow-api is
+// restarted with rateLimitProfileEnv and restored on cleanup, like
+// TestTokenExpiry does. In docker mode the stack cannot be reconfigured
+// mid-run, so the test is skipped unless it was started with
+// rateLimitComposeFile.
+func enableRateLimitProfile(t *testing.T) {
+	t.Helper()
+
+	if envOrDefault("INTEGRATION_TEST_MODE", "local") != "local" {
+		if !strings.Contains(
+			os.Getenv("COMPOSE_EXTRA_FILES"), rateLimitComposeFile,
+		) {
+			t.Skipf("rate-limit profile: start the docker stack with "+
+				"COMPOSE_EXTRA_FILES=%s", rateLimitComposeFile,
+			)
+		}
+
+		return
+	}
+
+	restartAPIProcess(t, rateLimitProfileEnv()...)
+	t.Cleanup(func() {
+		restartAPIProcess(t)
+	})
+}
+
+// clientFrom returns an HTTP client whose connections originate from
+// sourceIP, so one test host can act as several client IPs. On Linux
+// the whole of 127.0.0.0/8 is routed to loopback, which is enough to
+// give each suite its own limiter bucket against a local follow-api.
+func clientFrom(sourceIP string) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		LocalAddr: &net.TCPAddr{IP: net.ParseIP(sourceIP)},
+	}
+
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: secretScanning(&http.Transport{
+			DisableKeepAlives: true,
+			DialContext: func(
+				ctx context.Context, _, addr string,
+			) (net.Conn, error) {
+				// Force IPv4: "localhost" may resolve to ::1, which an
+				// IPv4 source address cannot reach.
+				return dialer.DialContext(ctx, "tcp4", addr)
+			},
+		}),
+	}
+}
+
+// requireSourceIP skips the test when connections from sourceIP cannot
+// reach follow-api (non-Linux loopback, or a docker port proxy that
+// would hide the source address anyway).
+func requireSourceIP(t *testing.T, sourceIP string) {
+	t.Helper()
+
+	if envOrDefault("INTEGRATION_TEST_MODE", "local") != "local" {
+		t.Skip("docker port publishing rewrites the client address")
+	}
+
+	resp, err := clientFrom(sourceIP).Get(apiURL + "/health")
+	if err != nil {
+		t.Skipf("cannot reach follow-api from %s: %v", sourceIP, err)
+	}
+
+	resp.Body.Close()
+}
+
+// rateLimitedEndpoint is one request the limiter must eventually refuse.
+type rateLimitedEndpoint struct {
+	Name   string
+	Method string
+	Path   string
+	Body   func() any
+}
+
+// send issues the endpoint's request through client.
+func (e rateLimitedEndpoint) send(
+	t *testing.T,
+	client *http.Client,
+) *http.Response {
+	t.Helper()
+
+	var reqBody io.Reader
+
+	if e.Body != nil {
+		encoded, err := json.Marshal(e.Body())
+		require.NoError(t, err, "%s: marshal body", e.Name)
+
+		reqBody = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(e.Method, apiURL+e.Path, reqBody)
+	require.NoError(t, err, "%s: new request", e.Name)
+
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	require.NoError(t, err, "%s: transport error", e.Name)
+
+	return resp
+}
+
+// rateLimitHit is the first 429 an endpoint returned.
+type rateLimitHit struct {
+	// Allowed is how many requests succeeded before it.
+	Allowed int
+	Header  http.Header
+	Body    []byte
+}
+
+// exhaustRateLimit sends the endpoint's request through client until it
+// is refused with 429, failing if that does not happen within
+// rateLimitProbeMax requests or if any earlier response is a 5xx.
+func exhaustRateLimit(
+	t *testing.T,
+	client *http.Client,
+	e rateLimitedEndpoint,
+) rateLimitHit {
+	t.Helper()
+
+	probeMax := rateLimitProbeMax(t)
+
+	for i := range probeMax {
+		resp := e.send(t, client)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err, "%s: read body", e.Name)
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return rateLimitHit{
+				Allowed: i,
+				Header:  resp.Header,
+				Body:    body,
+			}
+		}
+
+		require.Lessf(t, resp.StatusCode, http.StatusInternalServerError,
+			"%s: request %d failed: %s", e.Name, i+1, body,
+		)
+	}
+
+	require.FailNowf(t, "rate limit never tripped",
+		"%s: no 429 after %d requests", e.Name, probeMax,
+	)
+
+	return rateLimitHit{}
+}
+
+// retryAfter parses a Retry-After header given in seconds.
+func retryAfter(t *testing.T, h http.Header) time.Duration {
+	t.Helper()
+
+	raw := h.Get("Retry-After")
+	require.NotEmpty(t, raw, "429 must carry Retry-After")
+
+	secs, err := strconv.Atoi(raw)
+	require.NoErrorf(t, err, "Retry-After %q must be delay-seconds", raw)
+	require.Positive(t, secs, "Retry-After must be positive")
+
+	return time.Duration(secs) * time.Second
+}
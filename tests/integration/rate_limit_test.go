@@ -0,0 +1,370 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rateLimitedEndpoints are the unauthenticated entry points the limiter
+// protects. Bodies are built per request so emails stay unique.
+func rateLimitedEndpoints() []rateLimitedEndpoint {
+	return []rateLimitedEndpoint{
+		{
+			Name:   "CreateAnonymousUser",
+			Method: http.MethodPost,
+			Path:   "/api/v1/users/anonymous",
+		},
+		{
+			Name:   "Login",
+			Method: http.MethodPost,
+			Path:   "/api/v1/auth/login",
+			Body: func() any {
+				return map[string]any{
+					"email":    uniqueEmail(),
+					"password": "not-the-password",
+				}
+			},
+		},
+		{
+			Name:   "ForgotPassword",
+			Method: http.MethodPost,
+			Path:   "/api/v1/auth/forgot-password",
+			Body: func() any {
+				return map[string]any{"email": uniqueEmail()}
+			},
+		},
+		{
+			Name:   "Refresh",
+			Method: http.MethodPost,
+			Path:   "/api/v1/auth/refresh",
+			Body: func() any {
+				return map[string]any{"refresh_token": "not-a-token"}
+			},
+		},
+	}
+}
+
+// rateLimitHeaders are the limit headers a 429 may carry: the common
+// X-RateLimit-* set or the IETF RateLimit-* draft.
+var rateLimitHeaders = []string{
+	"X-RateLimit-Limit",
+	"X-RateLimit-Remaining",
+	"X-RateLimit-Reset",
+	"RateLimit-Limit",
+	"RateLimit-Remaining",
+	"RateLimit-Reset",
+	"RateLimit",
+}
+
+// TestRateLimit runs follow-api under the rate-limit profile and checks
+// what a throttled client sees: a 429 with the API's JSON error shape
+// and Retry-After/limit headers, limits kept per client IP without the
+// IP being stored in the clear or under an unkeyed hash, access
+// restored once the window has passed, and limiter keys that change
+// with SECURITY_IP_HASH_KEY.
+//
+// Each subtest connects from its own loopback address so buckets do
+// not bleed into each other; in docker mode every request shares one
+// address and the per-IP checks are skipped.
+func TestRateLimit(t *testing.T) {
+	isolate(t, isolationDestructive, labelSlow)
+
+	enableRateLimitProfile(t)
+
+	// clientFor returns a client bound to ip when the stack can see it,
+	// falling back to the default address otherwise.
+	clientFor := func(t *testing.T, ip string) *http.Client {
+		t.Helper()
+
+		if envOrDefault("INTEGRATION_TEST_MODE", "local") != "local" {
+			return http.DefaultClient
+		}
+
+		requireSourceIP(t, ip)
+
+		return clientFrom(ip)
+	}
+
+	t.Run("ErrorShape", func(t *testing.T) {
+		for i, e := range rateLimitedEndpoints() {
+			t.Run(e.Name, func(t *testing.T) {
+				ip := fmt.Sprintf("127.0.0.%d", 10*(i+1))
+				hit := exhaustRateLimit(t, clientFor(t, ip), e)
+
+				t.Logf("%s: %d request(s) allowed before 429",
+					e.Name, hit.Allowed,
+				)
+
+				assert.Contains(t,
+					hit.Header.Get("Content-Type"), "application/json",
+				)
+
+				var body map[string]any
+				require.NoError(t, json.Unmarshal(hit.Body, &body),
+					"429 body must be JSON: %s", hit.Body,
+				)
+				assert.NotEmpty(t, body["name"],
+					"429 body must carry the error name",
+				)
+				assert.NotEmpty(t, body["message"],
+					"429 body must carry a message",
+				)
+
+				retryAfter(t, hit.Header)
+
+				var present []string
+
+				for _, h := range rateLimitHeaders {
+					if hit.Header.Get(h) != "" {
+						present = append(present, h)
+					}
+				}
+
+				assert.NotEmptyf(t, present,
+					"429 must carry rate-limit headers (one of %v)",
+					rateLimitHeaders,
+				)
+
+				for _, h := range []string{
+					"X-RateLimit-Remaining", "RateLimit-Remaining",
+				} {
+					if v := hit.Header.Get(h); v != "" {
+						assert.Equalf(t, "0", v,
+							"%s must be 0 once throttled", h,
+						)
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("PerClientIP", func(t *testing.T) {
+		throttled, fresh := "127.0.0.60", "127.0.0.61"
+		requireSourceIP(t, throttled)
+		requireSourceIP(t, fresh)
+
+		before := valkeyKeys(t)
+
+		e := rateLimitedEndpoints()[0]
+		exhaustRateLimit(t, clientFrom(throttled), e)
+
+		resp := e.send(t, clientFrom(throttled))
+		resp.Body.Close()
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode,
+			"the throttled address must stay throttled",
+		)
+
+		resp = e.send(t, clientFrom(fresh))
+		resp.Body.Close()
+		assert.NotEqual(t, http.StatusTooManyRequests, resp.StatusCode,
+			"another address must have its own budget",
+		)
+
+		assertIPNotStoredInClear(t, before, throttled, fresh)
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		ip := "127.0.0.70"
+		client := clientFor(t, ip)
+
+		e := rateLimitedEndpoints()[0]
+		hit := exhaustRateLimit(t, client, e)
+		wait := retryAfter(t, hit.Header)
+
+		require.LessOrEqualf(t, wait, 2*time.Minute,
+			"Retry-After %s is too long for the test profile", wait,
+		)
+
+		time.Sleep(wait + time.Second)
+
+		resp := e.send(t, client)
+		resp.Body.Close()
+		assert.NotEqual(t, http.StatusTooManyRequests, resp.StatusCode,
+			"requests must be accepted again after Retry-After",
+		)
+	})
+
+	// Runs last: it restarts follow-api with another SECURITY_IP_HASH_KEY
+	// and back. An address must then land on a different limiter key;
+	// if it does not, the key is derived without the secret.
+	t.Run("KeyedHash", func(t *testing.T) {
+		ip := "127.0.0.80"
+		requireSourceIP(t, ip)
+
+		// Refresh with a bogus token stores nothing but limiter state.
+		e := rateLimitedEndpoints()[3]
+		send := func() []string {
+			before := valkeyKeys(t)
+
+			resp := e.send(t, clientFrom(ip))
+			resp.Body.Close()
+
+			return newValkeyKeys(t, before)
+		}
+
+		first := send()
+		require.NotEmpty(t, first,
+			"the limiter must keep its state for %s in Valkey", ip,
+		)
+
+		secret := make([]byte, 32)
+		_, err := rand.Read(secret)
+		require.NoError(t, err)
+
+		restartAPIProcess(t, append(rateLimitProfileEnv(),
+			"SECURITY_IP_HASH_KEY="+
+				base64.StdEncoding.EncodeToString(secret),
+		)...)
+		t.Cleanup(func() {
+			restartAPIProcess(t, rateLimitProfileEnv()...)
+		})
+
+		second := send()
+
+		current := valkeyKeys(t)
+		for _, k := range first {
+			require.Containsf(t, current, k,
+				"limiter key %q expired during the restart, so a new "+
+					"key for %s proves nothing", k, ip,
+			)
+		}
+
+		var moved []string
+
+		for _, k := range second {
+			for _, old := range first {
+				prefix := old[:strings.LastIndex(old, ":")+1]
+				if strings.HasPrefix(k, prefix) {
+					moved = append(moved, k)
+
+					break
+				}
+			}
+		}
+
+		assert.NotEmptyf(t, moved,
+			"with a new SECURITY_IP_HASH_KEY, %s must get a new limiter "+
+				"key next to %v; the key ignores the secret", ip, first,
+		)
+	})
+}
+
+// valkeyKeys returns every key in Valkey.
+func valkeyKeys(t *testing.T) []string {
+	t.Helper()
+
+	vc := newValkeyClient(t)
+	ctx := context.Background()
+
+	var (
+		keys   []string
+		cursor uint64
+	)
+
+	for {
+		entry, err := vc.Do(ctx,
+			vc.B().Scan().Cursor(cursor).Count(500).Build(),
+		).AsScanEntry()
+		require.NoError(t, err, "valkey scan")
+
+		keys = append(keys, entry.Elements...)
+
+		cursor = entry.Cursor
+		if cursor == 0 {
+			return keys
+		}
+	}
+}
+
+// newValkeyKeys returns the keys present now that were not in before.
+func newValkeyKeys(t *testing.T, before []string) []string {
+	t.Helper()
+
+	var added []string
+
+	for _, k := range valkeyKeys(t) {
+		if !slices.Contains(before, k) {
+			added = append(added, k)
+		}
+	}
+
+	return added
+}
+
+// assertIPNotStoredInClear checks the Valkey keys created since before,
+// which hold the limiter state for ips. Each address must have a key of
+// its own, and no key may contain an address in the clear or under an
+// unkeyed digest anyone could recompute. That the digest depends on
+// SECURITY_IP_HASH_KEY is checked by the KeyedHash subtest.
+func assertIPNotStoredInClear(t *testing.T, before []string, ips ...string) {
+	t.Helper()
+
+	added := newValkeyKeys(t, before)
+	require.GreaterOrEqualf(t, len(added), len(ips),
+		"the limiter must keep a Valkey key per client address, "+
+			"new keys: %v", added,
+	)
+
+	for _, ip := range ips {
+		for form, encoded := range unkeyedIPForms(ip) {
+			for _, k := range added {
+				assert.NotContainsf(t, k, encoded,
+					"limiter key %q holds %s as %s", k, ip, form,
+				)
+			}
+		}
+	}
+}
+
+// unkeyedIPForms returns ip as stored without a secret: in the clear
+// and under plain digests, hex and base64 encoded.
+func unkeyedIPForms(ip string) map[string]string {
+	forms := map[string]string{"plain text": ip}
+
+	for name, sum := range map[string][]byte{
+		"MD5":     md5Sum(ip),
+		"SHA-1":   sha1Sum(ip),
+		"SHA-256": sha256Sum(ip),
+	} {
+		forms[name+" hex"] = hex.EncodeToString(sum)
+		forms[name+" base64"] = base64.RawStdEncoding.EncodeToString(sum)
+		forms[name+" base64url"] = base64.RawURLEncoding.EncodeToString(sum)
+	}
+
+	return forms
+}
+
+func md5Sum(s string) []byte {
+	sum := md5.Sum([]byte(s))
+
+	return sum[:]
+}
+
+func sha1Sum(s string) []byte {
+	sum := sha1.Sum([]byte(s))
+
+	return sum[:]
+}
+
+func sha256Sum(s string) []byte {
+	sum := sha256.Sum256([]byte(s))
+
+	return sum[:]
+}
@@ -21,6 +21,9 @@ import (
 // remains in the PEL and can be re-claimed by a new consumer via
 // XAUTOCLAIM.
 func TestValkeyRecovery_PendingMessageRetained(t *testing.T) {
+	isolate(t, isolationSequential)
+	claimState(t, stateImageResults)
+
 	_, token, _ := createAnonymousUser(t)
 	routeID := prepareRoute(t, token)
 	route := createRouteWithWaypoints(t, token, routeID, defaultTestImages)
@@ -72,7 +72,7 @@ func waitForOwnerType(
 // the full registration flow: register, extract verification
 // code from Mailpit, and confirm. Returns the new user ID
 // (PK-swapped after promotion), access token, and refresh
-// token. Caller must clearMailbox before calling if needed.
+// token.
 func registerAndConfirm(
 	t *testing.T,
 	anonToken string,
@@ -133,16 +133,16 @@ func registerAndConfirm(
 // anonymous -> pending -> registered lifecycle with route
 // owner_type transition.
 func TestRegistrationFullFlow(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel, labelSmoke)
 
 	// Step 1: Create anonymous user
-	t.Log("Step 1: Create anonymous user")
+	step(t, "Step 1: Create anonymous user")
 
 	userID, token, _ := createAnonymousUser(t)
 	t.Cleanup(func() { deleteUser(t, userID, token) })
 
 	// Step 2: Create a route as anonymous
-	t.Log("Step 2: Create route as anonymous user")
+	step(t, "Step 2: Create route as anonymous user")
 
 	routeID := prepareRoute(t, token)
 
@@ -173,7 +173,7 @@ func TestRegistrationFullFlow(t *testing.T) {
 	)
 
 	// Step 3: Register with email and password
-	t.Log("Step 3: Register with email and password")
+	step(t, "Step 3: Register with email and password")
 
 	email := uniqueEmail()
 
@@ -199,7 +199,7 @@ func TestRegistrationFullFlow(t *testing.T) {
 	)
 
 	// Step 4: Extract verification code from Mailpit
-	t.Log("Step 4: Extract verification code")
+	step(t, "Step 4: Extract verification code")
 
 	msgID := waitForEmail(t, email)
 	code := extractVerificationCode(t, msgID)
@@ -209,7 +209,7 @@ func TestRegistrationFullFlow(t *testing.T) {
 	)
 
 	// Step 5: Confirm registration
-	t.Log("Step 5: Confirm registration")
+	step(t, "Step 5: Confirm registration")
 
 	confirmResp := doRequest(
 		t, http.MethodPost,
@@ -252,7 +252,7 @@ func TestRegistrationFullFlow(t *testing.T) {
 	token = regToken
 
 	// Step 6: Verify route owner_type transitioned
-	t.Log("Step 6: Verify route owner_type = user")
+	step(t, "Step 6: Verify route owner_type = user")
 
 	waitForOwnerType(
 		t, routeID, regToken, "user", 10*time.Second,
@@ -262,7 +262,7 @@ func TestRegistrationFullFlow(t *testing.T) {
 // TestLoginFlow verifies login with correct credentials,
 // wrong password, and a pending (unverified) account.
 func TestLoginFlow(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel, labelSmoke)
 
 	// Setup: register and confirm user A
 	t.Log("Setup: Create and register user A")
@@ -277,7 +277,7 @@ func TestLoginFlow(t *testing.T) {
 	tokenA = regTokenA
 
 	// Step 1: Login with correct credentials
-	t.Log("Step 1: Login with correct credentials")
+	step(t, "Step 1: Login with correct credentials")
 
 	loginResp := doRequest(
 		t, http.MethodPost,
@@ -300,7 +300,7 @@ func TestLoginFlow(t *testing.T) {
 	assert.NotEmpty(t, loginBody["access_token_expires_at"])
 
 	// Step 2: Login with wrong password
-	t.Log("Step 2: Login with wrong password")
+	step(t, "Step 2: Login with wrong password")
 
 	badPwResp := doRequest(
 		t, http.MethodPost,
@@ -319,9 +319,7 @@ func TestLoginFlow(t *testing.T) {
 	badPwResp.Body.Close()
 
 	// Step 3: Login with pending (unverified) user
-	t.Log("Step 3: Login with pending user")
-
-	clearMailbox(t)
+	step(t, "Step 3: Login with pending user")
 
 	_, tokenB, _ := createAnonymousUser(t)
 	emailB := uniqueEmail()
@@ -366,7 +364,7 @@ func TestLoginFlow(t *testing.T) {
 // TestDuplicateEmailRejection verifies that registering
 // a second user with an already-taken email returns 409.
 func TestDuplicateEmailRejection(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	email := uniqueEmail()
 
@@ -402,13 +400,13 @@ func TestDuplicateEmailRejection(t *testing.T) {
 // an anonymous user, registers, and verifies all routes
 // remain accessible with owner_type transitioned to "user".
 func TestRoutesSurviveRegistration(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	userID, token, _ := createAnonymousUser(t)
 	t.Cleanup(func() { deleteUser(t, userID, token) })
 
 	// Create 3 routes
-	t.Log("Step 1: Create 3 routes as anonymous")
+	step(t, "Step 1: Create 3 routes as anonymous")
 
 	const routeCount = 3
 
@@ -426,7 +424,7 @@ func TestRoutesSurviveRegistration(t *testing.T) {
 	}
 
 	// Register and confirm
-	t.Log("Step 2: Register and confirm")
+	step(t, "Step 2: Register and confirm")
 
 	email := uniqueEmail()
 	_, regToken, _ := registerAndConfirm(
@@ -435,7 +433,7 @@ func TestRoutesSurviveRegistration(t *testing.T) {
 	token = regToken
 
 	// Verify all routes accessible and owner_type = user
-	t.Log("Step 3: Verify routes accessible with new JWT")
+	step(t, "Step 3: Verify routes accessible with new JWT")
 
 	for _, rid := range routeIDs {
 		waitForOwnerType(
@@ -460,13 +458,13 @@ func TestRoutesSurviveRegistration(t *testing.T) {
 // are rejected, attempts are limited, and resend provides
 // a fresh code that succeeds.
 func TestVerificationCodeSecurity(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel, labelSecurity)
 
 	_, token, _ := createAnonymousUser(t)
 	email := uniqueEmail()
 
 	// Register
-	t.Log("Step 1: Register")
+	step(t, "Step 1: Register")
 
 	regResp := doRequest(
 		t, http.MethodPost,
@@ -486,7 +484,7 @@ func TestVerificationCodeSecurity(t *testing.T) {
 	_ = extractVerificationCode(t, msgID)
 
 	// Step 2: Submit wrong code 5 times → 400 each
-	t.Log("Step 2: Submit wrong code 5 times")
+	step(t, "Step 2: Submit wrong code 5 times")
 
 	const maxAttempts = 5
 
@@ -508,7 +506,7 @@ func TestVerificationCodeSecurity(t *testing.T) {
 	}
 
 	// Step 3: 6th attempt → 429 (too many attempts)
-	t.Log("Step 3: 6th attempt returns 429")
+	step(t, "Step 3: 6th attempt returns 429")
 
 	exhaustedResp := doRequest(
 		t, http.MethodPost,
@@ -525,9 +523,9 @@ func TestVerificationCodeSecurity(t *testing.T) {
 	exhaustedResp.Body.Close()
 
 	// Step 4: Resend verification code
-	t.Log("Step 4: Resend verification code")
+	step(t, "Step 4: Resend verification code")
 
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	// Wait for resend cooldown (AUTH_RESEND_COOLDOWN=5s
 	// in test env + margin)
@@ -548,7 +546,7 @@ func TestVerificationCodeSecurity(t *testing.T) {
 	resendResp.Body.Close()
 
 	// Step 5: Extract new code and confirm
-	t.Log("Step 5: Confirm with new code")
+	step(t, "Step 5: Confirm with new code")
 
 	newMsgID := waitForEmail(t, email)
 	newCode := extractVerificationCode(t, newMsgID)
@@ -571,7 +569,7 @@ func TestVerificationCodeSecurity(t *testing.T) {
 // and reset-password cycle: old password stops working,
 // new password works.
 func TestPasswordResetFlow(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel, labelSmoke)
 
 	// Setup: Create and register a user
 	t.Log("Setup: Register and confirm user")
@@ -581,9 +579,9 @@ func TestPasswordResetFlow(t *testing.T) {
 	_, _, _ = registerAndConfirm(t, token, email)
 
 	// Step 1: Request password reset
-	t.Log("Step 1: Forgot password")
+	step(t, "Step 1: Forgot password")
 
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	forgotResp := doRequest(
 		t, http.MethodPost,
@@ -599,14 +597,14 @@ func TestPasswordResetFlow(t *testing.T) {
 	forgotResp.Body.Close()
 
 	// Step 2: Extract reset code from email
-	t.Log("Step 2: Extract reset code")
+	step(t, "Step 2: Extract reset code")
 
 	msgID := waitForEmail(t, email)
 	resetCode := extractVerificationCode(t, msgID)
 	require.Len(t, resetCode, 6)
 
 	// Step 3: Reset password
-	t.Log("Step 3: Reset password")
+	step(t, "Step 3: Reset password")
 
 	const newPassword = "newsecurepass456"
 
@@ -628,7 +626,7 @@ func TestPasswordResetFlow(t *testing.T) {
 	resetResp.Body.Close()
 
 	// Step 4: Login with new password succeeds
-	t.Log("Step 4: Login with new password")
+	step(t, "Step 4: Login with new password")
 
 	newPwResp := doRequest(
 		t, http.MethodPost,
@@ -647,7 +645,7 @@ func TestPasswordResetFlow(t *testing.T) {
 	newPwResp.Body.Close()
 
 	// Step 5: Login with old password fails
-	t.Log("Step 5: Login with old password fails")
+	step(t, "Step 5: Login with old password fails")
 
 	oldPwResp := doRequest(
 		t, http.MethodPost,
@@ -671,7 +669,7 @@ func TestPasswordResetFlow(t *testing.T) {
 // TestRegisterAlreadyRegistered verifies that a fully
 // registered user cannot register again (terminal state).
 func TestRegisterAlreadyRegistered(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	_, token, _ := createAnonymousUser(t)
 	email := uniqueEmail()
@@ -699,7 +697,7 @@ func TestRegisterAlreadyRegistered(t *testing.T) {
 // TestRegisterAlreadyPending verifies that a pending user
 // cannot start registration a second time.
 func TestRegisterAlreadyPending(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	_, token, _ := createAnonymousUser(t)
 	email := uniqueEmail()
@@ -743,6 +741,8 @@ func TestRegisterAlreadyPending(t *testing.T) {
 // TestRegisterNoAuth verifies that register without a JWT
 // returns 401.
 func TestRegisterNoAuth(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	resp := doRequest(
 		t, http.MethodPost,
 		apiURL+"/api/v1/auth/register",
@@ -763,6 +763,8 @@ func TestRegisterNoAuth(t *testing.T) {
 // TestRegisterInvalidEmail verifies that a malformed email
 // is rejected with 400.
 func TestRegisterInvalidEmail(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	_, token, _ := createAnonymousUser(t)
 
 	resp := doRequest(
@@ -785,6 +787,8 @@ func TestRegisterInvalidEmail(t *testing.T) {
 // TestRegisterShortPassword verifies that a password shorter
 // than 8 characters is rejected.
 func TestRegisterShortPassword(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	_, token, _ := createAnonymousUser(t)
 
 	resp := doRequest(
@@ -807,6 +811,8 @@ func TestRegisterShortPassword(t *testing.T) {
 // TestConfirmNotPending verifies that an anonymous user
 // (not pending) cannot confirm registration.
 func TestConfirmNotPending(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	_, token, _ := createAnonymousUser(t)
 
 	resp := doRequest(
@@ -831,6 +837,8 @@ func TestConfirmNotPending(t *testing.T) {
 // TestResendNotPending verifies that an anonymous user
 // cannot resend a verification code.
 func TestResendNotPending(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	_, token, _ := createAnonymousUser(t)
 
 	resp := doRequest(
@@ -855,6 +863,8 @@ func TestResendNotPending(t *testing.T) {
 // TestLoginNonExistentEmail verifies that login with an
 // unknown email returns 401 (never leaks email existence).
 func TestLoginNonExistentEmail(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	resp := doRequest(
 		t, http.MethodPost,
 		apiURL+"/api/v1/auth/login",
@@ -878,6 +888,8 @@ func TestLoginNonExistentEmail(t *testing.T) {
 // forgot-password with an unknown email still returns 204
 // (never leaks email existence).
 func TestForgotPasswordNonExistentEmail(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	resp := doRequest(
 		t, http.MethodPost,
 		apiURL+"/api/v1/auth/forgot-password",
@@ -898,6 +910,8 @@ func TestForgotPasswordNonExistentEmail(t *testing.T) {
 // forgot-password for an anonymous user (not registered)
 // returns 204 silently.
 func TestForgotPasswordAnonymousUser(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	resp := doRequest(
 		t, http.MethodPost,
 		apiURL+"/api/v1/auth/forgot-password",
@@ -917,13 +931,13 @@ func TestForgotPasswordAnonymousUser(t *testing.T) {
 // TestResetPasswordWrongCode verifies that reset-password
 // with a wrong code returns 400.
 func TestResetPasswordWrongCode(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	_, token, _ := createAnonymousUser(t)
 	email := uniqueEmail()
 	_, _, _ = registerAndConfirm(t, token, email)
 
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	forgotResp := doRequest(
 		t, http.MethodPost,
@@ -964,6 +978,8 @@ func TestResetPasswordWrongCode(t *testing.T) {
 // reset-password rejects a new password shorter than 8
 // characters.
 func TestResetPasswordShortNewPassword(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	resp := doRequest(
 		t, http.MethodPost,
 		apiURL+"/api/v1/auth/reset-password",
@@ -986,7 +1002,7 @@ func TestResetPasswordShortNewPassword(t *testing.T) {
 // the JWT returned by confirm-registration and login can
 // be used for authenticated endpoints.
 func TestRegisteredTokenWorksForAuthEndpoints(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	_, token, _ := createAnonymousUser(t)
 	email := uniqueEmail()
@@ -1057,6 +1073,8 @@ func TestRegisteredTokenWorksForAuthEndpoints(t *testing.T) {
 // TestLoginInvalidEmailFormat verifies that login with a
 // malformed email returns 400.
 func TestLoginInvalidEmailFormat(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	resp := doRequest(
 		t, http.MethodPost,
 		apiURL+"/api/v1/auth/login",
@@ -1077,6 +1095,8 @@ func TestLoginInvalidEmailFormat(t *testing.T) {
 // TestForgotPasswordInvalidEmail verifies that
 // forgot-password with a malformed email returns 400.
 func TestForgotPasswordInvalidEmail(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	resp := doRequest(
 		t, http.MethodPost,
 		apiURL+"/api/v1/auth/forgot-password",
@@ -1098,7 +1118,7 @@ func TestForgotPasswordInvalidEmail(t *testing.T) {
 // no-ops on the second call — no new email is sent and the
 // original code remains valid.
 func TestForgotPasswordCooldownSilentNoOp(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	// Setup: Register and confirm user
 	_, token, _ := createAnonymousUser(t)
@@ -1106,7 +1126,7 @@ func TestForgotPasswordCooldownSilentNoOp(t *testing.T) {
 	_, _, _ = registerAndConfirm(t, token, email)
 
 	// Step 1: Request password reset
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	resp1 := doRequest(
 		t, http.MethodPost,
@@ -1126,7 +1146,7 @@ func TestForgotPasswordCooldownSilentNoOp(t *testing.T) {
 	originalCode := extractVerificationCode(t, msgID)
 
 	// Step 3: Immediately call forgot-password again
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	resp2 := doRequest(
 		t, http.MethodPost,
@@ -1169,14 +1189,7 @@ func TestForgotPasswordCooldownSilentNoOp(t *testing.T) {
 // new code that replaces the original.
 // Local mode only — requires API restart with short cooldown.
 func TestForgotPasswordCooldownExpiredResend(t *testing.T) {
-	if envOrDefault(
-		"INTEGRATION_TEST_MODE", "local",
-	) != "local" {
-		t.Skip(
-			"cooldown expiry test requires API restart " +
-				"(local mode only)",
-		)
-	}
+	isolate(t, isolationDestructive, labelLocalOnly)
 
 	restartAPIProcess(
 		t,
@@ -1186,15 +1199,13 @@ func TestForgotPasswordCooldownExpiredResend(t *testing.T) {
 		restartAPIProcess(t)
 	})
 
-	clearMailbox(t)
-
 	// Setup: Register and confirm user
 	_, token, _ := createAnonymousUser(t)
 	email := uniqueEmail()
 	_, _, _ = registerAndConfirm(t, token, email)
 
 	// Step 1: First forgot-password
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	resp1 := doRequest(
 		t, http.MethodPost,
@@ -1217,7 +1228,7 @@ func TestForgotPasswordCooldownExpiredResend(t *testing.T) {
 	time.Sleep(3 * time.Second)
 
 	// Step 3: Call forgot-password again
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	resp2 := doRequest(
 		t, http.MethodPost,
@@ -1262,7 +1273,7 @@ func TestForgotPasswordCooldownExpiredResend(t *testing.T) {
 // TestResendTooSoon verifies that resending a verification
 // code before the cooldown expires returns 429.
 func TestResendTooSoon(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	_, token, _ := createAnonymousUser(t)
 	email := uniqueEmail()
@@ -1301,6 +1312,8 @@ func TestResendTooSoon(t *testing.T) {
 // TestConfirmNoAuth verifies that confirm-registration
 // without a JWT returns 401.
 func TestConfirmNoAuth(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	resp := doRequest(
 		t, http.MethodPost,
 		apiURL+"/api/v1/auth/confirm-registration",
@@ -1318,6 +1331,8 @@ func TestConfirmNoAuth(t *testing.T) {
 // TestResendNoAuth verifies that resend-verification
 // without a JWT returns 401.
 func TestResendNoAuth(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	resp := doRequest(
 		t, http.MethodPost,
 		apiURL+"/api/v1/auth/resend-verification",
@@ -1338,7 +1353,7 @@ func TestResendNoAuth(t *testing.T) {
 // anonymous users race to register the same email, exactly
 // one succeeds (200) and the other gets 409 (email_taken).
 func TestConcurrentRegisterSameEmail(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	email := uniqueEmail()
 
@@ -1366,9 +1381,9 @@ func TestConcurrentRegisterSameEmail(t *testing.T) {
 
 	client := &http.Client{
 		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
+		Transport: secretScanning(&http.Transport{
 			DisableKeepAlives: true,
-		},
+		}),
 	}
 
 	for i := range racers {
@@ -1447,7 +1462,7 @@ func TestConcurrentRegisterSameEmail(t *testing.T) {
 // after the first success fails (verification record was
 // deleted on first confirm).
 func TestConfirmRegistrationIdempotency(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	_, token, _ := createAnonymousUser(t)
 	email := uniqueEmail()
@@ -1516,13 +1531,13 @@ func TestConfirmRegistrationIdempotency(t *testing.T) {
 // same reset code twice fails on the second attempt
 // (verification record deleted after first reset).
 func TestResetPasswordIdempotency(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	_, token, _ := createAnonymousUser(t)
 	email := uniqueEmail()
 	_, _, _ = registerAndConfirm(t, token, email)
 
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	// Request password reset
 	forgotResp := doRequest(
@@ -1634,6 +1649,8 @@ func restartAPIProcess(
 ) {
 	t.Helper()
 
+	requireIsolation(t, isolationDestructive)
+
 	killProcessGroup(
 		"follow-api", apiProcess, apiDrainWait,
 	)
@@ -1687,12 +1704,14 @@ func buildAPIEnv(
 		"RECLAIMER_SCAN_INTERVAL=2s",
 		"AUTH_RESEND_COOLDOWN=5s",
 		"SMTP_HOST=localhost",
-		"SMTP_PORT=1025",
+		"SMTP_PORT="+localSMTPPort,
 		"SMTP_USERNAME=",
 		"SMTP_PASSWORD=",
+		"SMTP_FROM="+defaultSMTPFrom,
 		"AUTH_ARGON2ID_MEMORY=15360",
 		"AUTH_ARGON2ID_ITERATIONS=1",
 	)
+	base = append(base, fakeOIDCEnv()...)
 	base = append(base, extraEnv...)
 	return dedupEnv(base)
 }
@@ -1722,12 +1741,7 @@ func dedupEnv(env []string) []string {
 // TestTokenExpiry restarts the API with a 2s JWT TTL, runs
 // all expiry subtests, then restores the normal API.
 func TestTokenExpiry(t *testing.T) {
-	if envOrDefault("INTEGRATION_TEST_MODE", "local") != "local" {
-		t.Skip(
-			"token expiry tests require API restart " +
-				"(local mode only)",
-		)
-	}
+	isolate(t, isolationDestructive, labelSlow, labelLocalOnly)
 
 	restartAPIProcess(
 		t,
@@ -1772,8 +1786,6 @@ func TestTokenExpiry(t *testing.T) {
 	})
 
 	t.Run("RegisteredToken", func(t *testing.T) {
-		clearMailbox(t)
-
 		_, anonToken, _ := createAnonymousUser(t)
 		email := uniqueEmail()
 		newUserID, regToken, _ := registerAndConfirm(
@@ -1902,7 +1914,7 @@ func TestTokenExpiry(t *testing.T) {
 // with the access token, and verifies the refresh token from
 // that session is dead (session deleted server-side).
 func TestLogoutSingleDevice(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	// Setup: register a user
 	t.Log("Setup: Register and confirm user")
@@ -1914,7 +1926,7 @@ func TestLogoutSingleDevice(t *testing.T) {
 	)
 
 	// Step 1: Login to get a session with refresh token
-	t.Log("Step 1: Login")
+	step(t, "Step 1: Login")
 
 	loginResp := doRequest(
 		t, http.MethodPost,
@@ -1939,7 +1951,7 @@ func TestLogoutSingleDevice(t *testing.T) {
 	require.NotEmpty(t, refreshToken)
 
 	// Step 2: Logout with the access token
-	t.Log("Step 2: POST /auth/logout")
+	step(t, "Step 2: POST /auth/logout")
 
 	logoutResp := doRequest(
 		t, http.MethodPost,
@@ -1955,7 +1967,7 @@ func TestLogoutSingleDevice(t *testing.T) {
 	logoutResp.Body.Close()
 
 	// Step 3: Refresh with the old refresh token → must fail
-	t.Log("Step 3: Refresh with old token fails")
+	step(t, "Step 3: Refresh with old token fails")
 
 	refreshResp := doRequest(
 		t, http.MethodPost,
@@ -1974,7 +1986,7 @@ func TestLogoutSingleDevice(t *testing.T) {
 	refreshResp.Body.Close()
 
 	// Step 4: Login still works (account is not deleted)
-	t.Log("Step 4: Login still works")
+	step(t, "Step 4: Login still works")
 
 	reloginResp := doRequest(
 		t, http.MethodPost,
@@ -1999,7 +2011,7 @@ func TestLogoutSingleDevice(t *testing.T) {
 // POST /auth/logout-all, and verifies both refresh tokens
 // are dead.
 func TestLogoutAllDevices(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	// Setup: register a user
 	t.Log("Setup: Register and confirm user")
@@ -2009,7 +2021,7 @@ func TestLogoutAllDevices(t *testing.T) {
 	_, _, _ = registerAndConfirm(t, anonToken, email)
 
 	// Step 1: Login from device A
-	t.Log("Step 1: Login device A")
+	step(t, "Step 1: Login device A")
 
 	loginA := doRequest(
 		t, http.MethodPost,
@@ -2031,7 +2043,7 @@ func TestLogoutAllDevices(t *testing.T) {
 	require.NotEmpty(t, refreshA)
 
 	// Step 2: Login from device B
-	t.Log("Step 2: Login device B")
+	step(t, "Step 2: Login device B")
 
 	loginB := doRequest(
 		t, http.MethodPost,
@@ -2053,7 +2065,7 @@ func TestLogoutAllDevices(t *testing.T) {
 	require.NotEmpty(t, refreshB)
 
 	// Step 3: Logout all using device A's token
-	t.Log("Step 3: POST /auth/logout-all")
+	step(t, "Step 3: POST /auth/logout-all")
 
 	logoutResp := doRequest(
 		t, http.MethodPost,
@@ -2069,7 +2081,7 @@ func TestLogoutAllDevices(t *testing.T) {
 	logoutResp.Body.Close()
 
 	// Step 4: Both refresh tokens are dead
-	t.Log("Step 4: Both refresh tokens fail")
+	step(t, "Step 4: Both refresh tokens fail")
 
 	refreshRespA := doRequest(
 		t, http.MethodPost,
@@ -2104,7 +2116,7 @@ func TestLogoutAllDevices(t *testing.T) {
 	refreshRespB.Body.Close()
 
 	// Step 5: Fresh login still works
-	t.Log("Step 5: Fresh login works")
+	step(t, "Step 5: Fresh login works")
 
 	freshLogin := doRequest(
 		t, http.MethodPost,
@@ -2128,7 +2140,7 @@ func TestLogoutAllDevices(t *testing.T) {
 // reset password via forgot-password flow, verify old
 // refresh token fails, verify new login works.
 func TestPasswordResetInvalidatesSessions(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel, labelSecurity)
 
 	// Setup: register and login
 	t.Log("Setup: Register, confirm, and login")
@@ -2154,9 +2166,9 @@ func TestPasswordResetInvalidatesSessions(t *testing.T) {
 	require.NotEmpty(t, oldRefresh)
 
 	// Step 1: Forgot password
-	t.Log("Step 1: Forgot password")
+	step(t, "Step 1: Forgot password")
 
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	forgotResp := doRequest(
 		t, http.MethodPost,
@@ -2171,7 +2183,7 @@ func TestPasswordResetInvalidatesSessions(t *testing.T) {
 	forgotResp.Body.Close()
 
 	// Step 2: Extract reset code and reset password
-	t.Log("Step 2: Reset password")
+	step(t, "Step 2: Reset password")
 
 	msgID := waitForEmail(t, email)
 	resetCode := extractVerificationCode(t, msgID)
@@ -2195,7 +2207,7 @@ func TestPasswordResetInvalidatesSessions(t *testing.T) {
 	resetResp.Body.Close()
 
 	// Step 3: Old refresh token is dead
-	t.Log("Step 3: Old refresh token fails")
+	step(t, "Step 3: Old refresh token fails")
 
 	refreshResp := doRequest(
 		t, http.MethodPost,
@@ -2214,7 +2226,7 @@ func TestPasswordResetInvalidatesSessions(t *testing.T) {
 	refreshResp.Body.Close()
 
 	// Step 4: Login with new password works
-	t.Log("Step 4: Login with new password works")
+	step(t, "Step 4: Login with new password works")
 
 	newLoginResp := doRequest(
 		t, http.MethodPost,
@@ -2233,7 +2245,7 @@ func TestPasswordResetInvalidatesSessions(t *testing.T) {
 	newLoginResp.Body.Close()
 
 	// Step 5: Login with old password fails
-	t.Log("Step 5: Login with old password fails")
+	step(t, "Step 5: Login with old password fails")
 
 	oldLoginResp := doRequest(
 		t, http.MethodPost,
@@ -2261,10 +2273,10 @@ func TestPasswordResetInvalidatesSessions(t *testing.T) {
 // references the OLD UUID which no longer exists, so any API
 // call with that access token returns 401 or 404.
 func TestStaleAnonymousTokenAfterPromotion(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel, labelSecurity)
 
 	// Step 1: Create anonymous user and save refresh token
-	t.Log("Step 1: Create anonymous user")
+	step(t, "Step 1: Create anonymous user")
 
 	anonUserID, anonToken, anonRefresh := createAnonymousUser(t)
 	require.NotEmpty(
@@ -2273,7 +2285,7 @@ func TestStaleAnonymousTokenAfterPromotion(t *testing.T) {
 	)
 
 	// Step 2: Register and confirm (PK changes)
-	t.Log("Step 2: Register and confirm")
+	step(t, "Step 2: Register and confirm")
 
 	email := uniqueEmail()
 	newUserID, regToken, _ := registerAndConfirm(
@@ -2287,7 +2299,7 @@ func TestStaleAnonymousTokenAfterPromotion(t *testing.T) {
 	_ = regToken
 
 	// Step 3: Refresh with old anonymous refresh token
-	t.Log("Step 3: Refresh with stale anonymous token")
+	step(t, "Step 3: Refresh with stale anonymous token")
 
 	refreshResp := doRequest(
 		t, http.MethodPost,
@@ -2314,7 +2326,7 @@ func TestStaleAnonymousTokenAfterPromotion(t *testing.T) {
 		require.NotEmpty(t, staleToken)
 
 		// Step 4: Use stale access token → must fail
-		t.Log("Step 4: API call with stale token fails")
+		step(t, "Step 4: API call with stale token fails")
 
 		getResp := doRequest(
 			t, http.MethodGet,
@@ -2356,7 +2368,7 @@ func TestStaleAnonymousTokenAfterPromotion(t *testing.T) {
 // a registered user refreshes, the old refresh token is dead.
 // Replaying the consumed token must return 401.
 func TestRefreshTokenRotationReuseDetection(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel, labelSecurity)
 
 	// Setup: register and login
 	t.Log("Setup: Register, confirm, and login")
@@ -2382,7 +2394,7 @@ func TestRefreshTokenRotationReuseDetection(t *testing.T) {
 	require.NotEmpty(t, oldRefresh)
 
 	// Step 1: Refresh → get new tokens
-	t.Log("Step 1: Refresh to rotate token")
+	step(t, "Step 1: Refresh to rotate token")
 
 	refreshResp := doRequest(
 		t, http.MethodPost,
@@ -2411,7 +2423,7 @@ func TestRefreshTokenRotationReuseDetection(t *testing.T) {
 	time.Sleep(2 * time.Second)
 
 	// Step 2: Replay old refresh token → must fail
-	t.Log("Step 2: Replay old refresh token")
+	step(t, "Step 2: Replay old refresh token")
 
 	replayResp := doRequest(
 		t, http.MethodPost,
@@ -2431,7 +2443,7 @@ func TestRefreshTokenRotationReuseDetection(t *testing.T) {
 
 	// Step 3: New token also dead — reuse detection revokes
 	// the entire session family (OAuth 2.0 Security BCP).
-	t.Log("Step 3: New token also dead (family revoked)")
+	step(t, "Step 3: New token also dead (family revoked)")
 
 	newRefreshResp := doRequest(
 		t, http.MethodPost,
@@ -2456,6 +2468,8 @@ func TestRefreshTokenRotationReuseDetection(t *testing.T) {
 // not crash the server. Anonymous users have no sessions,
 // so the server should return a non-500 status.
 func TestLogoutWithAnonymousToken(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	_, anonToken, _ := createAnonymousUser(t)
 
 	resp := doRequest(
@@ -2480,6 +2494,8 @@ func TestLogoutWithAnonymousToken(t *testing.T) {
 // POST /auth/logout-all with an anonymous user's token does
 // not crash the server.
 func TestLogoutAllWithAnonymousToken(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	_, anonToken, _ := createAnonymousUser(t)
 
 	resp := doRequest(
@@ -2503,6 +2519,8 @@ func TestLogoutAllWithAnonymousToken(t *testing.T) {
 // TestLogoutNoAuth verifies that POST /auth/logout without
 // a JWT returns 401.
 func TestLogoutNoAuth(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	resp := doRequest(
 		t, http.MethodPost,
 		apiURL+"/api/v1/auth/logout",
@@ -2520,6 +2538,8 @@ func TestLogoutNoAuth(t *testing.T) {
 // TestLogoutAllNoAuth verifies that POST /auth/logout-all
 // without a JWT returns 401.
 func TestLogoutAllNoAuth(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	resp := doRequest(
 		t, http.MethodPost,
 		apiURL+"/api/v1/auth/logout-all",
@@ -2538,7 +2558,7 @@ func TestLogoutAllNoAuth(t *testing.T) {
 // simultaneously on the same session. Exactly one path
 // should win; neither should 500.
 func TestConcurrentLogoutAndRefresh(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	// Setup: register and login
 	t.Log("Setup: Register, confirm, and login")
@@ -2567,7 +2587,7 @@ func TestConcurrentLogoutAndRefresh(t *testing.T) {
 	require.NotEmpty(t, refreshToken)
 
 	// Fire logout and refresh concurrently
-	t.Log("Step 1: Fire logout + refresh concurrently")
+	step(t, "Step 1: Fire logout + refresh concurrently")
 
 	type result struct {
 		name   string
@@ -2578,9 +2598,9 @@ func TestConcurrentLogoutAndRefresh(t *testing.T) {
 
 	client := &http.Client{
 		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
+		Transport: secretScanning(&http.Transport{
 			DisableKeepAlives: true,
-		},
+		}),
 	}
 
 	var wg sync.WaitGroup
@@ -2669,7 +2689,7 @@ func TestConcurrentLogoutAndRefresh(t *testing.T) {
 // the most recent one. Two logins, reset password, both
 // refresh tokens must be dead.
 func TestPasswordResetKillsMultipleSessions(t *testing.T) {
-	clearMailbox(t)
+	isolate(t, isolationParallel)
 
 	// Setup: register
 	t.Log("Setup: Register and confirm")
@@ -2679,7 +2699,7 @@ func TestPasswordResetKillsMultipleSessions(t *testing.T) {
 	_, _, _ = registerAndConfirm(t, anonToken, email)
 
 	// Step 1: Login from two devices
-	t.Log("Step 1: Login device A and B")
+	step(t, "Step 1: Login device A and B")
 
 	loginA := doRequest(
 		t, http.MethodPost,
@@ -2714,9 +2734,9 @@ func TestPasswordResetKillsMultipleSessions(t *testing.T) {
 	require.NotEmpty(t, refreshB)
 
 	// Step 2: Reset password
-	t.Log("Step 2: Reset password")
+	step(t, "Step 2: Reset password")
 
-	clearMailbox(t)
+	clearMailbox(t, email)
 
 	forgotResp := doRequest(
 		t, http.MethodPost,
@@ -2752,7 +2772,7 @@ func TestPasswordResetKillsMultipleSessions(t *testing.T) {
 	resetResp.Body.Close()
 
 	// Step 3: Both refresh tokens are dead
-	t.Log("Step 3: Both refresh tokens fail")
+	step(t, "Step 3: Both refresh tokens fail")
 
 	refreshRespA := doRequest(
 		t, http.MethodPost,
@@ -2787,7 +2807,7 @@ func TestPasswordResetKillsMultipleSessions(t *testing.T) {
 	refreshRespB.Body.Close()
 
 	// Step 4: Login with new password works
-	t.Log("Step 4: Login with new password works")
+	step(t, "Step 4: Login with new password works")
 
 	newLogin := doRequest(
 		t, http.MethodPost,
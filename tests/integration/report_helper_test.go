@@ -0,0 +1,840 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Limits on what a test record keeps for its failure attachments.
+const (
+	reportExchangeLimit = 10
+	reportBodyLimit     = 4 << 10
+	reportSSELimit      = 500
+	reportLogLimit      = 64 << 10
+)
+
+// Step and test results as the reports spell them.
+const (
+	resultPassed  = "passed"
+	resultFailed  = "failed"
+	resultSkipped = "skipped"
+)
+
+// reportStep is one step(t, ...) of a test or one of its subtests.
+type reportStep struct {
+	Test     string
+	Name     string
+	Start    time.Time
+	Duration time.Duration
+	Result   string
+
+	failedAtStart bool
+}
+
+// reportExchange is one HTTP request a test made and its answer.
+type reportExchange struct {
+	Start    time.Time
+	Method   string
+	URL      string
+	Status   int
+	Duration time.Duration
+	Request  string
+	Response string
+	Err      string
+}
+
+// reportAttachment is a named block of text kept for a failed test.
+type reportAttachment struct {
+	Name    string
+	Content string
+}
+
+// hashSnapshot is the last value a test read from a Valkey hash.
+type hashSnapshot struct {
+	At     time.Time
+	Fields map[string]string
+}
+
+// testRecord collects what the reports show for one top-level test.
+type testRecord struct {
+	mu sync.Mutex
+
+	Name        string
+	Start       time.Time
+	Duration    time.Duration
+	Result      string
+	Steps       []reportStep
+	Attachments []reportAttachment
+
+	// open indexes each (sub)test's running step in Steps.
+	open       map[string]int
+	exchanges  []reportExchange
+	sse        []string
+	hashes     map[string]hashSnapshot
+	logOffsets map[string]int
+}
+
+// report holds a record for every test that got past its phase gate.
+var report struct {
+	mu    sync.Mutex
+	tests map[string]*testRecord
+}
+
+type reportContextKey struct{}
+
+// trackTest starts t's record; isolate calls it once t's phase begins,
+// so time spent waiting for a phase is not counted. When t ends its
+// result is recorded and, if it failed, the attachments collected.
+func trackTest(t *testing.T) {
+	t.Helper()
+
+	rec := &testRecord{
+		Name:       t.Name(),
+		Start:      time.Now(),
+		open:       make(map[string]int),
+		hashes:     make(map[string]hashSnapshot),
+		logOffsets: serviceLogOffsets(),
+	}
+
+	report.mu.Lock()
+	if report.tests == nil {
+		report.tests = make(map[string]*testRecord)
+	}
+	report.tests[t.Name()] = rec
+	report.mu.Unlock()
+
+	t.Cleanup(func() {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+
+		rec.endStep(t)
+		rec.Duration = time.Since(rec.Start)
+
+		switch {
+		case t.Failed():
+			rec.Result = resultFailed
+			rec.attachFailureContext()
+		case t.Skipped():
+			rec.Result = resultSkipped
+		default:
+			rec.Result = resultPassed
+		}
+	})
+}
+
+// recordFor returns the record of t's top-level test, or nil when it is
+// not tracked.
+func recordFor(t *testing.T) *testRecord {
+	name, _, _ := strings.Cut(t.Name(), "/")
+
+	report.mu.Lock()
+	defer report.mu.Unlock()
+
+	return report.tests[name]
+}
+
+// step starts a named step of t, ending the one before it. The name is
+// also logged, so -v output reads as before. A step fails when t starts
+// failing while it runs.
+func step(t *testing.T, name string) {
+	t.Helper()
+
+	t.Log(name)
+
+	rec := recordFor(t)
+	if rec == nil {
+		return
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	_, started := rec.open[t.Name()]
+	rec.endStep(t)
+
+	rec.open[t.Name()] = len(rec.Steps)
+	rec.Steps = append(rec.Steps, reportStep{
+		Test:          t.Name(),
+		Name:          name,
+		Start:         time.Now(),
+		failedAtStart: t.Failed(),
+	})
+
+	// The last step of a subtest ends with the subtest.
+	if !started && t.Name() != rec.Name {
+		t.Cleanup(func() {
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+
+			rec.endStep(t)
+		})
+	}
+}
+
+// endStep closes t's running step, if any. rec.mu must be held.
+func (rec *testRecord) endStep(t *testing.T) {
+	i, ok := rec.open[t.Name()]
+	if !ok || rec.Steps[i].Result != "" {
+		return
+	}
+
+	s := &rec.Steps[i]
+	s.Duration = time.Since(s.Start)
+
+	switch {
+	case t.Failed() && !s.failedAtStart:
+		s.Result = resultFailed
+	case t.Skipped():
+		s.Result = resultSkipped
+	default:
+		s.Result = resultPassed
+	}
+}
+
+// failedStep returns the failed step closest to the failure: a step
+// around a failing subtest fails too, so the most deeply nested one
+// wins, then the earliest.
+func (rec *testRecord) failedStep() (reportStep, bool) {
+	var (
+		found reportStep
+		depth = -1
+	)
+
+	for _, s := range rec.Steps {
+		if s.Result != resultFailed {
+			continue
+		}
+
+		if d := strings.Count(s.Test, "/"); d > depth {
+			found, depth = s, d
+		}
+	}
+
+	return found, depth >= 0
+}
+
+// reportContext returns ctx carrying t's record, so the HTTP transport
+// and the SSE reader can add to it.
+func reportContext(ctx context.Context, t *testing.T) context.Context {
+	rec := recordFor(t)
+	if rec == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, reportContextKey{}, rec)
+}
+
+func recordFromContext(ctx context.Context) *testRecord {
+	rec, _ := ctx.Value(reportContextKey{}).(*testRecord)
+
+	return rec
+}
+
+// reportTransport keeps the last exchanges of the test whose record the
+// request's context carries.
+type reportTransport struct {
+	base http.RoundTripper
+}
+
+// reporting wraps base so requests made with reportContext are kept.
+func reporting(base http.RoundTripper) http.RoundTripper {
+	return reportTransport{base: base}
+}
+
+// installReporter routes every client using http.DefaultTransport
+// through the reporter.
+func installReporter() {
+	http.DefaultTransport = reporting(http.DefaultTransport)
+}
+
+func (r reportTransport) RoundTrip(
+	req *http.Request,
+) (*http.Response, error) {
+	rec := recordFromContext(req.Context())
+	if rec == nil {
+		return r.base.RoundTrip(req)
+	}
+
+	ex := reportExchange{
+		Start:   time.Now(),
+		Method:  req.Method,
+		URL:     req.URL.String(),
+		Request: requestPreview(req),
+	}
+
+	resp, err := r.base.RoundTrip(req)
+	ex.Duration = time.Since(ex.Start)
+
+	switch {
+	case err != nil:
+		ex.Err = err.Error()
+	case strings.Contains(resp.Header.Get("Content-Type"), "json"):
+		ex.Status = resp.StatusCode
+
+		body, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+
+		ex.Response = truncate(string(body), reportBodyLimit)
+		if readErr != nil {
+			// Handing back the part that was read would look like a
+			// complete body to the caller.
+			ex.Err = readErr.Error()
+			resp, err = nil, readErr
+		}
+	default:
+		ex.Status = resp.StatusCode
+		ex.Response = "(" + resp.Header.Get("Content-Type") + " body)"
+	}
+
+	rec.mu.Lock()
+	rec.exchanges = append(rec.exchanges, ex)
+	if n := len(rec.exchanges); n > reportExchangeLimit {
+		rec.exchanges = rec.exchanges[n-reportExchangeLimit:]
+	}
+	rec.mu.Unlock()
+
+	return resp, err
+}
+
+// requestPreview renders a JSON request body, or the size of any other.
+func requestPreview(req *http.Request) string {
+	if req.GetBody == nil ||
+		!strings.Contains(req.Header.Get("Content-Type"), "json") {
+		if req.ContentLength > 0 {
+			return fmt.Sprintf("(%d bytes)", req.ContentLength)
+		}
+
+		return ""
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(body, reportBodyLimit+1))
+
+	return truncate(string(data), reportBodyLimit)
+}
+
+// recordSSEEvent adds an event to the transcript of the test whose
+// record ctx carries.
+func recordSSEEvent(ctx context.Context, event SSEEvent) {
+	rec := recordFromContext(ctx)
+	if rec == nil {
+		return
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if len(rec.sse) < reportSSELimit {
+		rec.sse = append(rec.sse, fmt.Sprintf("%s event=%s id=%s data=%s",
+			time.Now().Format("15:04:05.000"), event.Type, event.ID,
+			event.Data,
+		))
+	}
+}
+
+// recordHash keeps the last value t read from a Valkey hash.
+func recordHash(t *testing.T, key string, fields map[string]string) {
+	rec := recordFor(t)
+	if rec == nil {
+		return
+	}
+
+	rec.mu.Lock()
+	rec.hashes[key] = hashSnapshot{At: time.Now(), Fields: fields}
+	rec.mu.Unlock()
+}
+
+// serviceLogOffsets notes how much output each service has written.
+func serviceLogOffsets() map[string]int {
+	serviceLogsMu.Lock()
+	defer serviceLogsMu.Unlock()
+
+	offsets := make(map[string]int, len(serviceLogs))
+	for name, buf := range serviceLogs {
+		offsets[name] = buf.Len()
+	}
+
+	return offsets
+}
+
+// attachFailureContext turns what rec collected into attachments: each
+// service's output while the test ran (shared with any test running at
+// the same time), the Valkey hashes it read, its SSE transcript and its
+// last HTTP exchanges. rec.mu must be held.
+func (rec *testRecord) attachFailureContext() {
+	serviceLogsMu.Lock()
+	for _, name := range slices.Sorted(maps.Keys(serviceLogs)) {
+		out := serviceLogs[name].Bytes()[rec.logOffsets[name]:]
+		if len(out) == 0 {
+			continue
+		}
+
+		rec.attach("service log: "+name,
+			tail(string(out), reportLogLimit),
+		)
+	}
+	serviceLogsMu.Unlock()
+
+	for _, key := range slices.Sorted(maps.Keys(rec.hashes)) {
+		snap := rec.hashes[key]
+
+		var b strings.Builder
+
+		fmt.Fprintf(&b, "read at %s\n", snap.At.Format("15:04:05.000"))
+
+		for _, field := range slices.Sorted(maps.Keys(snap.Fields)) {
+			fmt.Fprintf(&b, "%s = %s\n", field, snap.Fields[field])
+		}
+
+		rec.attach("valkey: "+key, b.String())
+	}
+
+	if len(rec.sse) > 0 {
+		rec.attach("SSE transcript", strings.Join(rec.sse, "\n"))
+	}
+
+	if len(rec.exchanges) > 0 {
+		var b strings.Builder
+
+		for _, ex := range rec.exchanges {
+			fmt.Fprintf(&b, "%s %s %s -> ", ex.Start.Format("15:04:05.000"),
+				ex.Method, ex.URL,
+			)
+
+			if ex.Err != "" {
+				fmt.Fprintf(&b, "error: %s", ex.Err)
+			} else {
+				fmt.Fprintf(&b, "%d", ex.Status)
+			}
+
+			fmt.Fprintf(&b, " (%s)\n", ex.Duration.Round(time.Millisecond))
+
+			if ex.Request != "" {
+				fmt.Fprintf(&b, "  > %s\n", ex.Request)
+			}
+
+			if ex.Response != "" {
+				fmt.Fprintf(&b, "  < %s\n", ex.Response)
+			}
+		}
+
+		rec.attach("last HTTP exchanges", b.String())
+	}
+}
+
+func (rec *testRecord) attach(name, content string) {
+	rec.Attachments = append(rec.Attachments, reportAttachment{
+		Name: name, Content: content,
+	})
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	return s[:n] + fmt.Sprintf("... (%d bytes more)", len(s)-n)
+}
+
+func tail(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	return fmt.Sprintf("(%d bytes before)...\n", len(s)-n) + s[len(s)-n:]
+}
+
+// reportCase is one test as both reports list it: a tracked test, or
+// one the selector skipped.
+type reportCase struct {
+	Name   string
+	Class  isolationClass
+	Labels []testLabel
+	Result string
+	Reason string
+	Record *testRecord
+}
+
+// reportCases merges the manifest and the records, sorted by name.
+func reportCases() []reportCase {
+	selection.mu.Lock()
+	entries := maps.Clone(selection.entries)
+	selection.mu.Unlock()
+
+	report.mu.Lock()
+	defer report.mu.Unlock()
+
+	var cases []reportCase
+
+	for _, name := range slices.Sorted(maps.Keys(entries)) {
+		e := entries[name]
+		c := reportCase{
+			Name:   name,
+			Class:  e.Class,
+			Labels: e.Labels,
+			Result: resultSkipped,
+			Reason: e.Skip,
+		}
+
+		if rec, ok := report.tests[name]; ok && e.Skip == "" {
+			c.Record = rec
+			c.Result = rec.Result
+		}
+
+		cases = append(cases, c)
+	}
+
+	return cases
+}
+
+// writeTestReports writes junit.xml and report.html to REPORT_DIR.
+// Call it after m.Run.
+func writeTestReports() {
+	dir := os.Getenv("REPORT_DIR")
+	if dir == "" {
+		return
+	}
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		log.Error().Err(err).Str("dir", dir).Msg("cannot create REPORT_DIR")
+		return
+	}
+
+	cases := reportCases()
+
+	for name, write := range map[string]func(io.Writer, []reportCase) error{
+		"junit.xml":   writeJUnit,
+		"report.html": writeHTMLReport,
+	} {
+		path := filepath.Join(dir, name)
+
+		f, err := os.Create(path)
+		if err != nil {
+			log.Error().Err(err).Str("path", path).Msg("cannot write report")
+			continue
+		}
+
+		err = write(f, cases)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err != nil {
+			log.Error().Err(err).Str("path", path).Msg("cannot write report")
+			continue
+		}
+
+		log.Info().Str("path", path).Msg("test report written")
+	}
+}
+
+// JUnit XML, in the shape CI servers read: one suite, one testcase per
+// top-level test, steps in system-out and attachments in system-err.
+type (
+	junitSuites struct {
+		XMLName  xml.Name     `xml:"testsuites"`
+		Name     string       `xml:"name,attr"`
+		Tests    int          `xml:"tests,attr"`
+		Failures int          `xml:"failures,attr"`
+		Skipped  int          `xml:"skipped,attr"`
+		Time     string       `xml:"time,attr"`
+		Suites   []junitSuite `xml:"testsuite"`
+	}
+
+	junitSuite struct {
+		Name      string      `xml:"name,attr"`
+		Tests     int         `xml:"tests,attr"`
+		Failures  int         `xml:"failures,attr"`
+		Skipped   int         `xml:"skipped,attr"`
+		Time      string      `xml:"time,attr"`
+		Timestamp string      `xml:"timestamp,attr"`
+		Cases     []junitCase `xml:"testcase"`
+	}
+
+	junitCase struct {
+		Name       string          `xml:"name,attr"`
+		Classname  string          `xml:"classname,attr"`
+		Time       string          `xml:"time,attr"`
+		Properties []junitProperty `xml:"properties>property,omitempty"`
+		Failure    *junitMessage   `xml:"failure,omitempty"`
+		Skipped    *junitMessage   `xml:"skipped,omitempty"`
+		SystemOut  *junitText      `xml:"system-out,omitempty"`
+		SystemErr  *junitText      `xml:"system-err,omitempty"`
+	}
+
+	junitProperty struct {
+		Name  string `xml:"name,attr"`
+		Value string `xml:"value,attr"`
+	}
+
+	junitMessage struct {
+		Message string `xml:"message,attr,omitempty"`
+		Text    string `xml:",chardata"`
+	}
+
+	// junitText keeps multi-line output readable in the XML.
+	junitText struct {
+		Text string `xml:",cdata"`
+	}
+)
+
+func writeJUnit(w io.Writer, cases []reportCase) error {
+	suite := junitSuite{
+		Name:      "follow-integration-tests",
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	var start, end time.Time
+
+	for _, c := range cases {
+		jc := junitCase{
+			Name:      c.Name,
+			Classname: "integration." + c.Class.String(),
+			Time:      "0",
+		}
+
+		if len(c.Labels) > 0 {
+			jc.Properties = []junitProperty{
+				{Name: "labels", Value: joinLabels(c.Labels)},
+			}
+		}
+
+		if rec := c.Record; rec != nil {
+			rec.mu.Lock()
+			jc.Time = seconds(rec.Duration)
+			if len(rec.Steps) > 0 {
+				jc.SystemOut = &junitText{stepsText(rec.Steps)}
+			}
+
+			var attachments []string
+			for _, a := range rec.Attachments {
+				attachments = append(attachments,
+					"=== "+a.Name+" ===\n"+a.Content,
+				)
+			}
+
+			if len(attachments) > 0 {
+				jc.SystemErr = &junitText{strings.Join(attachments, "\n\n")}
+			}
+
+			if start.IsZero() || rec.Start.Before(start) {
+				start = rec.Start
+			}
+
+			end = maxTime(end, rec.Start.Add(rec.Duration))
+
+			failed, inStep := rec.failedStep()
+			rec.mu.Unlock()
+
+			if c.Result == resultFailed {
+				msg := "test failed; see the go test output"
+				if inStep {
+					msg = fmt.Sprintf("failed in step %q", failed.Name)
+				}
+
+				jc.Failure = &junitMessage{Message: msg}
+			}
+		}
+
+		switch c.Result {
+		case resultFailed:
+			suite.Failures++
+		case resultSkipped:
+			suite.Skipped++
+			jc.Skipped = &junitMessage{Message: c.Reason}
+		}
+
+		suite.Tests++
+		suite.Cases = append(suite.Cases, jc)
+	}
+
+	suite.Time = seconds(end.Sub(start))
+
+	doc := junitSuites{
+		Name:     suite.Name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitSuite{suite},
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	return enc.Encode(doc)
+}
+
+// stepsText lists steps one per line for system-out.
+func stepsText(steps []reportStep) string {
+	var b strings.Builder
+
+	for _, s := range steps {
+		fmt.Fprintf(&b, "[%s] %s: %s (%s)\n",
+			s.Result, s.Test, s.Name, s.Duration.Round(time.Millisecond),
+		)
+	}
+
+	return b.String()
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+
+	return b
+}
+
+// htmlReport is the data behind report.html.
+type htmlReport struct {
+	Generated time.Time
+	Mode      string
+	Selector  string
+	Counts    map[string]int
+	Cases     []htmlCase
+}
+
+type htmlCase struct {
+	reportCase
+
+	Duration    time.Duration
+	Steps       []htmlStep
+	Attachments []reportAttachment
+}
+
+// htmlStep places a step on its test's timeline, in percent.
+type htmlStep struct {
+	reportStep
+
+	Offset, Width float64
+}
+
+func writeHTMLReport(w io.Writer, cases []reportCase) error {
+	data := htmlReport{
+		Generated: time.Now(),
+		Mode:      integrationMode(),
+		Selector:  selection.selector.Raw,
+		Counts:    map[string]int{},
+	}
+
+	for _, c := range cases {
+		data.Counts[c.Result]++
+
+		hc := htmlCase{reportCase: c}
+
+		if rec := c.Record; rec != nil {
+			rec.mu.Lock()
+			hc.Duration = rec.Duration
+			hc.Attachments = slices.Clone(rec.Attachments)
+
+			total := max(rec.Duration.Seconds(), 1e-9)
+			for _, s := range rec.Steps {
+				hc.Steps = append(hc.Steps, htmlStep{
+					reportStep: s,
+					Offset:     100 * s.Start.Sub(rec.Start).Seconds() / total,
+					Width:      max(100*s.Duration.Seconds()/total, 0.5),
+				})
+			}
+			rec.mu.Unlock()
+		}
+
+		data.Cases = append(data.Cases, hc)
+	}
+
+	return htmlReportTemplate.Execute(w, data)
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(
+	template.FuncMap{
+		"ms": func(d time.Duration) time.Duration {
+			return d.Round(time.Millisecond)
+		},
+		"labels": joinLabels,
+		"pct": func(f float64) template.CSS {
+			return template.CSS(fmt.Sprintf("%.2f%%", f))
+		},
+	},
+).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Follow integration tests</title>
+<style>
+body { font: 14px/1.4 system-ui, sans-serif; margin: 2em; color: #222; }
+summary { cursor: pointer; }
+.test { border-left: 4px solid #999; margin: .4em 0; padding: .2em .6em; }
+.passed { border-color: #2a7; } .failed { border-color: #c33; }
+.skipped { border-color: #bbb; color: #777; }
+.meta { color: #666; font-size: 90%; }
+table { border-collapse: collapse; width: 100%; margin: .4em 0; }
+td { padding: .15em .4em; vertical-align: top; }
+td.bar { width: 40%; } .track { position: relative; height: .8em; }
+.track span { position: absolute; top: 0; bottom: 0; background: #2a7; }
+.track span.failed { background: #c33; }
+.track span.skipped { background: #bbb; }
+pre { background: #f6f6f6; padding: .6em; overflow-x: auto; max-height: 30em; }
+</style>
+</head>
+<body>
+<h1>Follow integration tests</h1>
+<p class="meta">{{.Generated.Format "2006-01-02 15:04:05 MST"}} ·
+mode {{.Mode}} · TEST_LABELS={{printf "%q" .Selector}} ·
+{{index .Counts "passed"}} passed, {{index .Counts "failed"}} failed,
+{{index .Counts "skipped"}} skipped</p>
+{{range .Cases}}
+<details class="test {{.Result}}"{{if eq .Result "failed"}} open{{end}}>
+<summary><strong>{{.Name}}</strong> {{.Result}}
+{{if .Record}}in {{ms .Duration}}{{end}}
+<span class="meta">{{.Class}}{{with .Labels}} · {{labels .}}{{end}}</span>
+</summary>
+{{if .Reason}}<p class="meta">{{.Reason}}</p>{{end}}
+{{with .Steps}}<table>
+{{range .}}<tr class="{{.Result}}">
+<td>{{.Test}}</td><td>{{.Name}}</td>
+<td>{{.Result}}</td><td>{{ms .Duration}}</td>
+<td class="bar"><div class="track"><span class="{{.Result}}"
+style="left: {{pct .Offset}}; width: {{pct .Width}}"></span></div></td>
+</tr>
+{{end}}</table>{{end}}
+{{range .Attachments}}<details><summary>{{.Name}}</summary>
+<pre>{{.Content}}</pre></details>
+{{end}}
+</details>
+{{end}}
+</body>
+</html>
+`))
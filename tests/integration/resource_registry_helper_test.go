@@ -0,0 +1,237 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// resourceKind identifies what a tracked resource is. The declaration
+// order is the cleanup order: dependents are torn down before the
+// resources they hang off (revision → image → route → user).
+type resourceKind int
+
+const (
+	resourceRevision resourceKind = iota
+	resourceImage
+	resourceRoute
+	resourceUser
+)
+
+func (k resourceKind) String() string {
+	switch k {
+	case resourceRevision:
+		return "revision"
+	case resourceImage:
+		return "image"
+	case resourceRoute:
+		return "route"
+	case resourceUser:
+		return "user"
+	default:
+		return "unknown"
+	}
+}
+
+// trackedResource is one resource created by a test.
+type trackedResource struct {
+	Kind resourceKind
+	ID   string
+	// ParentID is the route an image or revision belongs to.
+	ParentID string
+	// Token is the credential that owns the resource and is used to
+	// delete it.
+	Token string
+	// Test is the full name of the test that created the resource.
+	Test string
+}
+
+// resourceRegistry holds the resources created by a single test.
+type resourceRegistry struct {
+	mu        sync.Mutex
+	resources []trackedResource
+	keep      bool
+}
+
+var (
+	registriesMu sync.Mutex
+	registries   = map[*testing.T]*resourceRegistry{}
+
+	// resourceLedger records every resource tracked during the run,
+	// keyed by ID, so the end-of-suite leak scan can attribute a
+	// leftover to the test that created it.
+	resourceLedgerMu sync.Mutex
+	resourceLedger   = map[string]trackedResource{}
+)
+
+// registryFor returns the registry for t, creating it and registering
+// its cleanup on first use.
+func registryFor(t *testing.T) *resourceRegistry {
+	t.Helper()
+
+	registriesMu.Lock()
+	defer registriesMu.Unlock()
+
+	if reg, ok := registries[t]; ok {
+		return reg
+	}
+
+	reg := &resourceRegistry{}
+	registries[t] = reg
+
+	t.Cleanup(func() {
+		registriesMu.Lock()
+		delete(registries, t)
+		registriesMu.Unlock()
+
+		reg.cleanup(t)
+	})
+
+	return reg
+}
+
+// trackResource registers res with t's registry and the run ledger.
+func trackResource(t *testing.T, res trackedResource) {
+	t.Helper()
+
+	if res.ID == "" {
+		return
+	}
+
+	res.Test = t.Name()
+
+	reg := registryFor(t)
+	reg.mu.Lock()
+	reg.resources = append(reg.resources, res)
+	reg.mu.Unlock()
+
+	resourceLedgerMu.Lock()
+	resourceLedger[res.ID] = res
+	resourceLedgerMu.Unlock()
+}
+
+// trackUser registers an anonymous user for deletion when t finishes.
+func trackUser(t *testing.T, userID, token string) {
+	t.Helper()
+
+	trackResource(t, trackedResource{
+		Kind:  resourceUser,
+		ID:    userID,
+		Token: token,
+	})
+}
+
+// trackRoute registers a route for deletion when t finishes.
+func trackRoute(t *testing.T, routeID, token string) {
+	t.Helper()
+
+	trackResource(t, trackedResource{
+		Kind:  resourceRoute,
+		ID:    routeID,
+		Token: token,
+	})
+}
+
+// trackImage registers an image issued for routeID. Images have no
+// delete endpoint of their own; they are removed by the route cascade
+// and are tracked so the leak scan can attribute leftovers.
+func trackImage(t *testing.T, imageID, routeID string) {
+	t.Helper()
+
+	trackResource(t, trackedResource{
+		Kind:     resourceImage,
+		ID:       imageID,
+		ParentID: routeID,
+	})
+}
+
+// trackRevision registers a revision of routeID. Like images, revisions
+// are removed with their route and are tracked for attribution only.
+func trackRevision(t *testing.T, revisionID, routeID string) {
+	t.Helper()
+
+	trackResource(t, trackedResource{
+		Kind:     resourceRevision,
+		ID:       revisionID,
+		ParentID: routeID,
+	})
+}
+
+// keepResources opts t out of automatic cleanup and of leak reporting,
+// for tests such as the seed-data generators whose output is meant to
+// outlive the run.
+func keepResources(t *testing.T) {
+	t.Helper()
+
+	reg := registryFor(t)
+	reg.mu.Lock()
+	reg.keep = true
+	reg.mu.Unlock()
+}
+
+// cleanup deletes the registry's resources in dependency order.
+// Resources a test already deleted (404) are not reported.
+func (r *resourceRegistry) cleanup(t *testing.T) {
+	t.Helper()
+
+	r.mu.Lock()
+	resources := slices.Clone(r.resources)
+	keep := r.keep
+	r.mu.Unlock()
+
+	if keep {
+		forgetResources(resources)
+		return
+	}
+
+	slices.SortStableFunc(resources, func(a, b trackedResource) int {
+		return int(a.Kind) - int(b.Kind)
+	})
+
+	for _, res := range resources {
+		var path string
+
+		switch res.Kind {
+		case resourceRoute:
+			path = "/api/v1/routes/" + res.ID
+		case resourceUser:
+			path = "/api/v1/users/anonymous/" + res.ID
+		default:
+			continue
+		}
+
+		status, _, err := apiCall(
+			http.MethodDelete, apiURL+path, nil, res.Token,
+		)
+
+		switch {
+		case err != nil:
+			t.Logf("registry: DELETE %s failed: %v", path, err)
+		case status != http.StatusOK && status != http.StatusNotFound:
+			t.Logf("registry: DELETE %s returned %d", path, status)
+		}
+	}
+}
+
+// forgetResources drops resources from the run ledger so the leak scan
+// ignores them.
+func forgetResources(resources []trackedResource) {
+	resourceLedgerMu.Lock()
+	defer resourceLedgerMu.Unlock()
+
+	for _, res := range resources {
+		delete(resourceLedger, res.ID)
+	}
+}
+
+// ledgerSnapshot returns a copy of the run ledger.
+func ledgerSnapshot() map[string]trackedResource {
+	resourceLedgerMu.Lock()
+	defer resourceLedgerMu.Unlock()
+
+	return maps.Clone(resourceLedger)
+}
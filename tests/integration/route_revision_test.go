@@ -76,6 +76,8 @@ func prepareRevision(
 	err := json.NewDecoder(resp.Body).Decode(&result)
 	require.NoError(t, err, "prepareRevision: failed to decode response")
 
+	trackRevision(t, result.RevisionID, routeID)
+
 	return result, resp.StatusCode
 }
 
@@ -124,6 +126,10 @@ func applyRevision(
 	err := json.NewDecoder(resp.Body).Decode(&result)
 	require.NoError(t, err, "applyRevision: failed to decode response")
 
+	for _, wp := range result.Waypoints {
+		trackImage(t, wp.ImageID, routeID)
+	}
+
 	return result, resp.StatusCode
 }
 
@@ -308,6 +314,8 @@ func getRouteVersion(
 // The revision should become "ready" immediately without image upload,
 // and can be committed right away.
 func TestRevision_HappyPath_AllExistingImages(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	routeID, authToken, imageIDs := setupPublishedRoute(t)
 
 	// Step 1: Prepare revision.
@@ -428,6 +436,8 @@ func TestRevision_HappyPath_AllExistingImages(t *testing.T) {
 // images with new image uploads. Because new images require gateway
 // processing, the apply response status must be "pending".
 func TestRevision_HappyPath_MixedImages(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	routeID, authToken, imageIDs := setupPublishedRoute(t)
 
 	// Prepare revision.
@@ -492,6 +502,8 @@ func TestRevision_HappyPath_MixedImages(t *testing.T) {
 // a second revision on a route that already has an open revision is rejected
 // with an error (route_state_error → 422).
 func TestRevision_DuplicateRevisionRejection(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	routeID, authToken, _ := setupPublishedRoute(t)
 
 	// First prepare must succeed.
@@ -522,6 +534,8 @@ func TestRevision_DuplicateRevisionRejection(t *testing.T) {
 // TestRevision_CommitNotReadyRevision verifies that committing a revision
 // whose images are still pending (not all processed) returns an error.
 func TestRevision_CommitNotReadyRevision(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	routeID, authToken, imageIDs := setupPublishedRoute(t)
 
 	// Prepare revision.
@@ -575,6 +589,8 @@ func TestRevision_CommitNotReadyRevision(t *testing.T) {
 // TestRevision_OwnershipEnforcement_PrepareByOtherUser verifies that a user
 // cannot prepare a revision on a route they do not own.
 func TestRevision_OwnershipEnforcement_PrepareByOtherUser(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	// Create route as userA.
 	routeID, tokenA, _ := setupPublishedRoute(t)
 
@@ -616,6 +632,8 @@ func TestRevision_OwnershipEnforcement_PrepareByOtherUser(t *testing.T) {
 // TestRevision_OwnershipEnforcement_CommitByOtherUser verifies that a user
 // cannot commit a revision they did not create (or for a route they don't own).
 func TestRevision_OwnershipEnforcement_CommitByOtherUser(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	// Create route as userA and prepare+apply a ready revision.
 	routeID, tokenA, imageIDs := setupPublishedRoute(t)
 
@@ -667,6 +685,8 @@ func TestRevision_OwnershipEnforcement_CommitByOtherUser(t *testing.T) {
 // TestRevision_RouteNotPublished verifies that prepare_revision is rejected
 // when the route is not in "published" status.
 func TestRevision_RouteNotPublished(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	_, authToken, _ := createAnonymousUser(t)
 	routeID := prepareRoute(t, authToken)
 	t.Cleanup(func() { deleteRoute(t, routeID, authToken) })
@@ -719,6 +739,8 @@ func TestRevision_RouteNotPublished(t *testing.T) {
 // using a mismatched route_id (a different route than the one the revision
 // belongs to) returns an error.
 func TestRevision_RouteIDMismatch_OnApply(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	// Set up two separate published routes under the same user.
 	routeIDA, authToken, imageIDsA := setupPublishedRoute(t)
 
@@ -0,0 +1,614 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	valkeygo "github.com/valkey-io/valkey-go"
+	"github.com/yoseforb/follow-pkg/valkey"
+)
+
+// searchOwner identifies which of the two search users owns a fixture.
+type searchOwner int
+
+const (
+	searchOwnerA searchOwner = iota
+	searchOwnerB
+)
+
+// searchFixture is one route of the deterministic search dataset. Text
+// fields reuse seedRoute; Status is the lifecycle state the fixture is
+// driven to before any query runs.
+type searchFixture struct {
+	seedRoute
+
+	Owner      searchOwner
+	Visibility string
+	Status     string // "pending", "ready" or "published"
+	// PasswordProtected switches the route to that access method once
+	// it has reached Status; the rest are open.
+	PasswordProtected bool
+}
+
+// searchRoutePassword protects the password_protected fixtures.
+const searchRoutePassword = "search-fixture-pass"
+
+// accessMethod is the fixture's access_method value.
+func (f searchFixture) accessMethod() string {
+	if f.PasswordProtected {
+		return "password_protected"
+	}
+
+	return "open"
+}
+
+// searchFixtures is the dataset the oracle reasons about. It mixes
+// English and Hebrew text, both owners, both visibilities, both access
+// methods and every reachable status so each filter has matching and
+// non-matching rows.
+var searchFixtures = []searchFixture{
+	{
+		seedRoute: seedRoute{
+			Address:      "6 Weizmann St, Tel Aviv",
+			LocationName: "Ichilov Hospital",
+			StartPoint:   "Main Entrance",
+			EndPoint:     "Cardiology, Building B, Floor 3",
+			Description:  "Follow the blue line to Cardiology",
+		},
+		Owner:      searchOwnerA,
+		Visibility: "public",
+		Status:     "published",
+	},
+	{
+		seedRoute: seedRoute{
+			Address:      "Derech Sheba 2, Ramat Gan",
+			LocationName: "Sheba Medical Center",
+			StartPoint:   "Parking Lot C",
+			EndPoint:     "Oncology Institute",
+			Description:  "Quiet corridor past the pharmacy",
+		},
+		Owner:      searchOwnerA,
+		Visibility: "private",
+		Status:     "published",
+	},
+	{
+		seedRoute: seedRoute{
+			Address:      "ויצמן 6, תל אביב",
+			LocationName: "בית החולים איכילוב",
+			StartPoint:   "כניסה ראשית",
+			EndPoint:     "מחלקת קרדיולוגיה, בניין ב",
+			Description:  "ללכת לאורך הקו הכחול עד הקרדיולוגיה",
+		},
+		Owner:      searchOwnerA,
+		Visibility: "public",
+		Status:     "published",
+	},
+	{
+		seedRoute: seedRoute{
+			Address:      "132 Menachem Begin Rd, Tel Aviv",
+			LocationName: "Azrieli Mall",
+			StartPoint:   "Entrance A",
+			EndPoint:     "Food Court, Floor 3",
+			Description:  "Escalators on the left",
+		},
+		Owner:      searchOwnerA,
+		Visibility: "public",
+		Status:     "ready",
+	},
+	{
+		seedRoute: seedRoute{
+			Address:      "8 HaAliya HaShniya St, Haifa",
+			LocationName: "Rambam Health Care Campus",
+			StartPoint:   "Staff Entrance",
+			EndPoint:     "Radiology, Floor -1",
+			Description:  "Badge required past the lifts",
+		},
+		Owner:             searchOwnerA,
+		Visibility:        "public",
+		Status:            "published",
+		PasswordProtected: true,
+	},
+	{
+		seedRoute: seedRoute{
+			Address:      "132 Menachem Begin Rd, Tel Aviv",
+			LocationName: "Azrieli Mall",
+			StartPoint:   "Parking B",
+			EndPoint:     "Cinema, Floor 5",
+			Description:  "Elevator bank near the pharmacy",
+		},
+		Owner:      searchOwnerA,
+		Visibility: "private",
+		Status:     "pending",
+	},
+	{
+		seedRoute: seedRoute{
+			Address:      "6 Weizmann St, Tel Aviv",
+			LocationName: "Ichilov Hospital",
+			StartPoint:   "Underground Parking P2",
+			EndPoint:     "Emergency Room",
+			Description:  "Red signs all the way",
+		},
+		Owner:      searchOwnerB,
+		Visibility: "public",
+		Status:     "published",
+	},
+	{
+		seedRoute: seedRoute{
+			Address:      "6 Weizmann St, Tel Aviv",
+			LocationName: "Ichilov Hospital",
+			StartPoint:   "Emergency Room Entrance",
+			EndPoint:     "ICU, Building A, Floor 4",
+			Description:  "Staff corridor",
+		},
+		Owner:      searchOwnerB,
+		Visibility: "private",
+		Status:     "published",
+	},
+	{
+		seedRoute: seedRoute{
+			Address:      "דרך שיבא 2, רמת גן",
+			LocationName: "מרכז רפואי שיבא",
+			StartPoint:   "חניון ג",
+			EndPoint:     "המכון האונקולוגי",
+			Description:  "מסדרון שקט ליד בית המרקחת",
+		},
+		Owner:      searchOwnerB,
+		Visibility: "public",
+		Status:     "published",
+	},
+	{
+		seedRoute: seedRoute{
+			Address:      "30 Haim Levanon St, Tel Aviv",
+			LocationName: "TEL AVIV University",
+			StartPoint:   "Gate 2",
+			EndPoint:     "Sourasky Central Library",
+			Description:  "Across the main lawn",
+		},
+		Owner:      searchOwnerB,
+		Visibility: "public",
+		Status:     "published",
+	},
+	{
+		seedRoute: seedRoute{
+			Address:      "30 Haim Levanon St, Tel Aviv",
+			LocationName: "Tel Aviv University",
+			StartPoint:   "Gate 7",
+			EndPoint:     "Faculty Lounge, Gilman Building",
+			Description:  "Through the courtyard",
+		},
+		Owner:             searchOwnerB,
+		Visibility:        "public",
+		Status:            "published",
+		PasswordProtected: true,
+	},
+}
+
+// searchTextFilters maps each free-text query parameter to the fixture
+// field it searches.
+var searchTextFilters = map[string]func(seedRoute) string{
+	"location_name": func(r seedRoute) string { return r.LocationName },
+	"address":       func(r seedRoute) string { return r.Address },
+	"description":   func(r seedRoute) string { return r.Description },
+	"start_point":   func(r seedRoute) string { return r.StartPoint },
+	"end_point":     func(r seedRoute) string { return r.EndPoint },
+}
+
+// searchQuery is one GET /api/v1/routes call issued as a given user.
+type searchQuery struct {
+	Name   string
+	As     searchOwner
+	Params url.Values
+}
+
+// searchQueries covers every filter on its own, case-insensitive and
+// Hebrew substring matching, and combinations of filters.
+func searchQueries() []searchQuery {
+	q := func(kv ...string) url.Values {
+		v := url.Values{}
+		for i := 0; i+1 < len(kv); i += 2 {
+			v.Set(kv[i], kv[i+1])
+		}
+
+		return v
+	}
+
+	return []searchQuery{
+		{"OwnDefault", searchOwnerA, q()},
+		{"OwnVisibilityPublic", searchOwnerA, q("visibility", "public")},
+		{"OwnVisibilityPrivate", searchOwnerA, q("visibility", "private")},
+		{"OwnNavigableOnly", searchOwnerA, q("navigable_only", "true")},
+		{"OwnReadyNotNavigable", searchOwnerA, q(
+			"route_status", "ready", "navigable_only", "false",
+		)},
+		{"OwnReadyNavigableOnly", searchOwnerA, q(
+			"route_status", "ready", "navigable_only", "true",
+		)},
+		{"OwnPending", searchOwnerA, q(
+			"route_status", "pending", "navigable_only", "false",
+		)},
+		{"OwnAccessOpen", searchOwnerA, q("access_method", "open")},
+		{"OwnAccessPasswordProtected", searchOwnerA, q(
+			"access_method", "password_protected",
+		)},
+		{"DiscoveryDefault", searchOwnerA, q("discovery_mode", "true")},
+		{"DiscoveryFromB", searchOwnerB, q("discovery_mode", "true")},
+		{"DiscoveryAccessOpen", searchOwnerA, q(
+			"discovery_mode", "true", "access_method", "open",
+		)},
+		{"DiscoveryAccessPasswordProtected", searchOwnerB, q(
+			"discovery_mode", "true", "access_method", "password_protected",
+		)},
+		{"DiscoveryLocationLowercase", searchOwnerA, q(
+			"discovery_mode", "true", "location_name", "ichilov",
+		)},
+		{"DiscoveryLocationUppercase", searchOwnerA, q(
+			"discovery_mode", "true", "location_name", "ICHILOV HOSPITAL",
+		)},
+		{"DiscoveryLocationMixedCase", searchOwnerB, q(
+			"discovery_mode", "true", "location_name", "sHeBa MeDiCaL",
+		)},
+		{"DiscoveryLocationUniversity", searchOwnerA, q(
+			"discovery_mode", "true", "location_name", "tel aviv univ",
+		)},
+		{"DiscoveryHebrewLocation", searchOwnerB, q(
+			"discovery_mode", "true", "location_name", "איכילוב",
+		)},
+		{"DiscoveryHebrewAddress", searchOwnerB, q(
+			"discovery_mode", "true", "address", "תל אביב",
+		)},
+		{"DiscoveryHebrewStartPoint", searchOwnerA, q(
+			"discovery_mode", "true", "start_point", "חניון",
+		)},
+		{"DiscoveryHebrewDescription", searchOwnerA, q(
+			"discovery_mode", "true", "description", "שקט",
+		)},
+		{"DiscoveryHebrewEndPoint", searchOwnerB, q(
+			"discovery_mode", "true", "end_point", "קרדיולוג",
+		)},
+		{"DiscoveryEndPoint", searchOwnerA, q(
+			"discovery_mode", "true", "end_point", "library",
+		)},
+		{"DiscoveryDescription", searchOwnerB, q(
+			"discovery_mode", "true", "description", "BLUE LINE",
+		)},
+		{"DiscoveryNoMatch", searchOwnerA, q(
+			"discovery_mode", "true", "location_name", "no such place",
+		)},
+		{"OwnAddressStreet", searchOwnerA, q("address", "weizmann")},
+		{"OwnDescriptionSharedWord", searchOwnerA, q(
+			"description", "pharmacy",
+		)},
+		{"OwnCombinedPublicCardiology", searchOwnerA, q(
+			"location_name", "ichilov",
+			"end_point", "cardio",
+			"visibility", "public",
+		)},
+		{"OwnCombinedNoOverlap", searchOwnerA, q(
+			"location_name", "sheba", "visibility", "public",
+		)},
+		{"DiscoveryCombinedAddressStart", searchOwnerA, q(
+			"discovery_mode", "true",
+			"address", "tel aviv",
+			"start_point", "gate",
+		)},
+		{"DiscoveryCombinedHebrew", searchOwnerA, q(
+			"discovery_mode", "true",
+			"location_name", "שיבא",
+			"end_point", "אונקולוג",
+			"access_method", "open",
+		)},
+	}
+}
+
+// searchOracle decides whether fixture f should be returned by params
+// when queried as user `as`. It encodes the documented semantics of
+// GET /api/v1/routes: discovery_mode=false lists the caller's own routes,
+// discovery_mode=true lists other users' public routes; route_status
+// defaults to published; navigable_only (default true) keeps only
+// published routes; text filters are case-insensitive substrings.
+func searchOracle(f searchFixture, as searchOwner, params url.Values) bool {
+	if params.Get("discovery_mode") == "true" {
+		if f.Owner == as || f.Visibility != "public" {
+			return false
+		}
+	} else if f.Owner != as {
+		return false
+	}
+
+	status := params.Get("route_status")
+	if status == "" {
+		status = "published"
+	}
+
+	if f.Status != status {
+		return false
+	}
+
+	if params.Get("navigable_only") != "false" && f.Status != "published" {
+		return false
+	}
+
+	if v := params.Get("visibility"); v != "" && v != f.Visibility {
+		return false
+	}
+
+	if v := params.Get("access_method"); v != "" && v != f.accessMethod() {
+		return false
+	}
+
+	for param, field := range searchTextFilters {
+		v := params.Get(param)
+		if v == "" {
+			continue
+		}
+
+		if !containsFold(field(f.seedRoute), v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containsFold reports whether substr is within s, ignoring case.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// TestRouteSearch_FiltersMatchOracle seeds the deterministic dataset
+// under two fresh users and checks every query in searchQueries against
+// searchOracle. The database may hold routes from other tests, so
+// results are compared on the seeded subset; any other route returned
+// must still satisfy the filters on the fields the listing exposes.
+func TestRouteSearch_FiltersMatchOracle(t *testing.T) {
+	isolate(t, isolationParallel)
+
+	_, tokenA, _ := createAnonymousUser(t)
+	_, tokenB, _ := createAnonymousUser(t)
+	tokens := map[searchOwner]string{
+		searchOwnerA: tokenA,
+		searchOwnerB: tokenB,
+	}
+
+	vc := newValkeyClient(t)
+
+	routeIDs := seedSearchFixtures(t, tokens, vc)
+
+	seeded := make(map[string]searchFixture, len(routeIDs))
+	for i, id := range routeIDs {
+		seeded[id] = searchFixtures[i]
+	}
+
+	for _, sq := range searchQueries() {
+		t.Run(sq.Name, func(t *testing.T) {
+			var want []string
+
+			for i, f := range searchFixtures {
+				if searchOracle(f, sq.As, sq.Params) {
+					want = append(want, routeIDs[i])
+				}
+			}
+
+			got := listAllRoutes(t, tokens[sq.As], sq.Params)
+
+			var gotSeeded []string
+
+			for _, r := range got {
+				id, _ := r["route_id"].(string)
+				if _, ok := seeded[id]; ok {
+					gotSeeded = append(gotSeeded, id)
+				}
+
+				assertRouteMatchesFilters(t, r, sq.Params)
+			}
+
+			assert.ElementsMatchf(t, want, gotSeeded,
+				"query %s: seeded routes returned differ from oracle",
+				sq.Params.Encode(),
+			)
+		})
+	}
+}
+
+// seedSearchFixtures drives every fixture to its target status and
+// returns the route IDs in searchFixtures order, then switches the
+// password-protected ones to that access method. Fixtures are seeded one
+// at a time so no user ever holds more than one unfinished route (the
+// API limits pending routes per user); the pending fixture is last for
+// its owner. Routes are deleted on cleanup.
+func seedSearchFixtures(
+	t *testing.T,
+	tokens map[searchOwner]string,
+	vc valkeygo.Client,
+) []string {
+	t.Helper()
+
+	payload := jpegBytes(t, 320, 240)
+	routeIDs := make([]string, len(searchFixtures))
+
+	for i, f := range searchFixtures {
+		token := tokens[f.Owner]
+
+		routeID := prepareRoute(t, token)
+		t.Cleanup(func() { deleteRoute(t, routeID, token) })
+
+		routeIDs[i] = routeID
+
+		metadata := defaultRouteMetadata()
+		metadata["address"] = f.Address
+		metadata["location_name"] = f.LocationName
+		metadata["start_point"] = f.StartPoint
+		metadata["end_point"] = f.EndPoint
+		metadata["description"] = f.Description
+		metadata["visibility"] = f.Visibility
+
+		created := createRouteWithMetadata(
+			t, token, routeID, metadata,
+			[]map[string]any{
+				buildWaypointBody(0, "search.jpg", len(payload)),
+			},
+		)
+		require.Len(t, created.PresignedURLs, 1)
+
+		if f.Status == "pending" {
+			continue
+		}
+
+		upload := created.PresignedURLs[0]
+
+		resp := uploadToGateway(
+			t, upload.UploadURL, upload.UploadToken, payload,
+		)
+		resp.Body.Close()
+		require.Equal(t, http.StatusAccepted, resp.StatusCode,
+			"fixture %d: upload must be accepted", i,
+		)
+
+		waitForImageStatus(
+			t, vc, upload.ImageID, valkey.StageDone, 60*time.Second,
+		)
+		waitForRouteReady(t, routeID, token, 30*time.Second)
+
+		if f.Status == "published" {
+			publishSeedRoute(t, routeID, token, i+1)
+		}
+
+		if f.PasswordProtected {
+			protectSearchRoute(t, routeID, token)
+		}
+	}
+
+	return routeIDs
+}
+
+// protectSearchRoute sets a route's access method to
+// password_protected with searchRoutePassword.
+func protectSearchRoute(t *testing.T, routeID, token string) {
+	t.Helper()
+
+	resp := doRequest(t, http.MethodPut, apiURL+"/api/v1/routes/"+routeID,
+		map[string]any{
+			"access_method": "password_protected",
+			"password":      searchRoutePassword,
+		},
+		token,
+	)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode,
+		"protectSearchRoute: PUT access_method on %s", routeID,
+	)
+}
+
+// listAllRoutes walks GET /api/v1/routes page by page with the maximum
+// page size and returns every route object. Fails if the result set
+// does not terminate within a sane number of pages.
+func listAllRoutes(
+	t *testing.T,
+	authToken string,
+	params url.Values,
+) []map[string]any {
+	t.Helper()
+
+	const (
+		pageSize = 100
+		maxPages = 50
+	)
+
+	var routes []map[string]any
+
+	for page := 1; page <= maxPages; page++ {
+		q := url.Values{}
+		for k, v := range params {
+			q[k] = slices.Clone(v)
+		}
+
+		q.Set("page", fmt.Sprint(page))
+		q.Set("page_size", fmt.Sprint(pageSize))
+
+		resp := doRequest(
+			t, http.MethodGet, apiURL+"/api/v1/routes?"+q.Encode(),
+			nil, authToken,
+		)
+		require.Equal(t, http.StatusOK, resp.StatusCode,
+			"listAllRoutes: GET /api/v1/routes?%s", q.Encode(),
+		)
+
+		body := decodeJSON(t, resp)
+		items, ok := body["routes"].([]any)
+		require.True(t, ok,
+			"listAllRoutes: response must contain a 'routes' array",
+		)
+
+		for _, raw := range items {
+			r, _ := raw.(map[string]any)
+			routes = append(routes, r)
+		}
+
+		if len(items) < pageSize {
+			return routes
+		}
+	}
+
+	t.Fatalf(
+		"listAllRoutes: more than %d pages for %s",
+		maxPages, params.Encode(),
+	)
+
+	return nil
+}
+
+// assertRouteMatchesFilters checks a listed route against the filters
+// in params for every field the listing item exposes. Fields absent
+// from the item are not checked.
+func assertRouteMatchesFilters(
+	t *testing.T,
+	route map[string]any,
+	params url.Values,
+) {
+	t.Helper()
+
+	id := route["route_id"]
+
+	for _, key := range []string{"visibility", "access_method"} {
+		want := params.Get(key)
+		if got, ok := route[key].(string); ok && want != "" {
+			assert.Equalf(t, want, got, "route %v: %s", id, key)
+		}
+	}
+
+	if params.Get("discovery_mode") == "true" {
+		if got, ok := route["visibility"].(string); ok {
+			assert.Equalf(t, "public", got,
+				"route %v: discovery returned a non-public route", id,
+			)
+		}
+	}
+
+	wantStatus := params.Get("route_status")
+	if wantStatus == "" {
+		wantStatus = "published"
+	}
+
+	if got, ok := route["route_status"].(string); ok {
+		assert.Equalf(t, wantStatus, got, "route %v: route_status", id)
+	}
+
+	for param := range searchTextFilters {
+		want := params.Get(param)
+		if got, ok := route[param].(string); ok && want != "" {
+			assert.Truef(t, containsFold(got, want),
+				"route %v: %s=%q does not contain %q",
+				id, param, got, want,
+			)
+		}
+	}
+}
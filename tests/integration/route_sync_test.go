@@ -87,14 +87,16 @@ func syncRoutes(
 //
 //nolint:maintidx // intentionally long: covers 8-step sync scenario end-to-end
 func TestSync_TwoRoutes_VersionProgression(t *testing.T) {
+	isolate(t, isolationParallel)
+
 	// Step 1: Create users
-	t.Log("Step 1: Create users")
+	step(t, "Step 1: Create users")
 
 	_, userAToken, _ := createAnonymousUser(t)
 	_, userBToken, _ := createAnonymousUser(t)
 
 	// Step 2: UserA creates and publishes two routes with different images
-	t.Log("Step 2: UserA creates and publishes two routes")
+	step(t, "Step 2: UserA creates and publishes two routes")
 
 	// Route 1: uses pexels-punttim-240223.jpg and
 	// pexels-arthurbrognoli-2260838.jpg
@@ -189,7 +191,7 @@ func TestSync_TwoRoutes_VersionProgression(t *testing.T) {
 	t.Logf("Route 2 published with version: %d", route2Version)
 
 	// Step 3: UserB syncs both routes at version 0 (old)
-	t.Log("Step 3: UserB syncs both routes at version 0")
+	step(t, "Step 3: UserB syncs both routes at version 0")
 
 	syncResp1, status := syncRoutes(
 		t,
@@ -226,7 +228,7 @@ func TestSync_TwoRoutes_VersionProgression(t *testing.T) {
 	}
 
 	// Step 4: UserB syncs again with current versions
-	t.Log("Step 4: UserB syncs with current versions")
+	step(t, "Step 4: UserB syncs with current versions")
 
 	syncResp2, status := syncRoutes(
 		t,
@@ -264,7 +266,7 @@ func TestSync_TwoRoutes_VersionProgression(t *testing.T) {
 	)
 
 	// Step 5: UserA modifies Route 1 metadata (bumps version)
-	t.Log("Step 5: UserA modifies Route 1 metadata")
+	step(t, "Step 5: UserA modifies Route 1 metadata")
 
 	updateBody := map[string]any{
 		"location_name": "Modified Location Name",
@@ -295,7 +297,7 @@ func TestSync_TwoRoutes_VersionProgression(t *testing.T) {
 	t.Logf("Route 1 version after update: %d", route1VersionAfterUpdate)
 
 	// Step 6: UserB syncs with old versions
-	t.Log("Step 6: UserB syncs with old versions")
+	step(t, "Step 6: UserB syncs with old versions")
 
 	syncResp3, status := syncRoutes(
 		t,
@@ -335,7 +337,7 @@ func TestSync_TwoRoutes_VersionProgression(t *testing.T) {
 	)
 
 	// Step 7: UserA deletes Route 1
-	t.Log("Step 7: UserA deletes Route 1")
+	step(t, "Step 7: UserA deletes Route 1")
 
 	deleteResp := doRequest(
 		t,
@@ -350,7 +352,7 @@ func TestSync_TwoRoutes_VersionProgression(t *testing.T) {
 	deleteResp.Body.Close()
 
 	// Step 8: UserB syncs deleted route
-	t.Log("Step 8: UserB syncs deleted route")
+	step(t, "Step 8: UserB syncs deleted route")
 
 	syncResp4, status := syncRoutes(
 		t,
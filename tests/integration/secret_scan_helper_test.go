@@ -0,0 +1,575 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/rs/zerolog/log"
+	"github.com/testcontainers/testcontainers-go"
+	valkeygo "github.com/valkey-io/valkey-go"
+)
+
+// secretKind is a class of value that must never surface in logs,
+// Valkey or the wrong API response.
+type secretKind int
+
+const (
+	secretPassword secretKind = iota
+	secretVerificationCode
+	secretToken
+	secretEmail
+)
+
+func (k secretKind) String() string {
+	switch k {
+	case secretPassword:
+		return "password"
+	case secretVerificationCode:
+		return "verification_code"
+	case secretToken:
+		return "token"
+	case secretEmail:
+		return "email"
+	default:
+		return fmt.Sprintf("secret(%d)", int(k))
+	}
+}
+
+// secretMinLen keeps trivially short values, such as fuzz or
+// validation-test passwords, out of the scan.
+const secretMinLen = 8
+
+// Secrets generated during the run and the text they are checked
+// against. Everything is kept in memory and scanned once by
+// checkSecretLeaks, since a secret is often learned (say, a code read
+// from Mailpit) after the log line that leaked it was written.
+var (
+	secretsMu    sync.Mutex
+	knownSecrets = map[string]secretKind{testPassword: secretPassword}
+
+	serviceLogsMu sync.Mutex
+	serviceLogs   = map[string]*bytes.Buffer{}
+
+	apiResponsesMu sync.Mutex
+	apiResponses   []capturedResponse
+)
+
+// capturedResponse is one JSON body returned by follow-api or the
+// gateway.
+type capturedResponse struct {
+	Request string
+	Status  int
+	Body    []byte
+}
+
+// recordSecret adds value to the set checkSecretLeaks looks for.
+func recordSecret(kind secretKind, value string) {
+	if kind != secretVerificationCode && len(value) < secretMinLen {
+		return
+	}
+
+	secretsMu.Lock()
+	knownSecrets[value] = kind
+	secretsMu.Unlock()
+}
+
+// serviceLogWriter returns a writer that keeps service's output for the
+// end-of-suite scan.
+func serviceLogWriter(service string) io.Writer {
+	serviceLogsMu.Lock()
+	defer serviceLogsMu.Unlock()
+
+	buf, ok := serviceLogs[service]
+	if !ok {
+		buf = &bytes.Buffer{}
+		serviceLogs[service] = buf
+	}
+
+	return lockedWriter{buf: buf}
+}
+
+// lockedWriter serialises writes from a service's stdout and stderr.
+type lockedWriter struct{ buf *bytes.Buffer }
+
+func (w lockedWriter) Write(p []byte) (int, error) {
+	serviceLogsMu.Lock()
+	defer serviceLogsMu.Unlock()
+
+	return w.buf.Write(p)
+}
+
+// containerLogs ends the docker-mode log streams: stop cancels them,
+// done waits for the copies to finish.
+var containerLogs struct {
+	stop context.CancelFunc
+	done sync.WaitGroup
+}
+
+// followContainerLogs streams the docker-mode service logs into
+// serviceLogs from setup on, so failure reports can attach what a
+// service printed while the test ran and the secret scan sees it all.
+func followContainerLogs(ctx context.Context) {
+	cli, err := testcontainers.NewDockerClientWithOpts(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("service logs: no docker client")
+		return
+	}
+
+	ctx, containerLogs.stop = context.WithCancel(ctx)
+
+	for _, service := range []string{"follow-api", "follow-image-gateway"} {
+		c, err := composeStack.ServiceContainer(ctx, service)
+		if err != nil {
+			log.Warn().Err(err).Str("service", service).
+				Msg("service logs: no container")
+			continue
+		}
+
+		rc, err := cli.ContainerLogs(ctx, c.GetContainerID(),
+			container.LogsOptions{
+				ShowStdout: true,
+				ShowStderr: true,
+				Follow:     true,
+			},
+		)
+		if err != nil {
+			log.Warn().Err(err).Str("service", service).
+				Msg("service logs: cannot follow")
+			continue
+		}
+
+		w := serviceLogWriter(service)
+
+		containerLogs.done.Add(1)
+		go func() {
+			defer containerLogs.done.Done()
+			defer rc.Close()
+
+			_, _ = stdcopy.StdCopy(w, w, rc)
+		}()
+	}
+
+	go func() {
+		<-ctx.Done()
+		containerLogs.done.Wait()
+		cli.Close()
+	}()
+}
+
+// stopContainerLogs ends the streams followContainerLogs started and
+// waits until their output is in serviceLogs. Call it before the stack
+// is torn down.
+func stopContainerLogs() {
+	if containerLogs.stop == nil {
+		return
+	}
+
+	containerLogs.stop()
+	containerLogs.done.Wait()
+}
+
+// secretScanTransport records the credentials tests send to follow-api
+// and the gateway and keeps every JSON body they return, harvesting
+// the tokens those bodies issue.
+type secretScanTransport struct {
+	base http.RoundTripper
+}
+
+// secretScanning wraps base so its traffic is covered by the scan.
+func secretScanning(base http.RoundTripper) http.RoundTripper {
+	return secretScanTransport{base: base}
+}
+
+// installSecretScan routes every client using http.DefaultTransport
+// through the scan.
+func installSecretScan() {
+	http.DefaultTransport = secretScanning(http.DefaultTransport)
+}
+
+func (s secretScanTransport) RoundTrip(
+	req *http.Request,
+) (*http.Response, error) {
+	if !isServiceURL(req.URL) {
+		return s.base.RoundTrip(req)
+	}
+
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			harvestSecrets(body, secretPassword,
+				"password", "new_password", "current_password",
+			)
+		}
+	}
+
+	resp, err := s.base.RoundTrip(req)
+	if err != nil ||
+		!strings.Contains(resp.Header.Get("Content-Type"), "json") {
+		// Event streams never end; binary bodies cannot hold secrets
+		// the scan would recognise.
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err != nil {
+		return resp, nil
+	}
+
+	harvestSecrets(io.NopCloser(bytes.NewReader(body)), secretToken,
+		"access_token", "refresh_token", "upload_token",
+	)
+
+	apiResponsesMu.Lock()
+	apiResponses = append(apiResponses, capturedResponse{
+		Request: req.Method + " " + req.URL.Path,
+		Status:  resp.StatusCode,
+		Body:    body,
+	})
+	apiResponsesMu.Unlock()
+
+	return resp, nil
+}
+
+// isServiceURL reports whether u points at follow-api or the gateway.
+func isServiceURL(u *url.URL) bool {
+	for _, base := range []string{apiURL, gatewayURL} {
+		if parsed, err := url.Parse(base); err == nil &&
+			parsed.Host == u.Host {
+			return true
+		}
+	}
+
+	return false
+}
+
+// harvestSecrets records the string values of fields anywhere in a
+// JSON body (including nested objects and arrays) as secrets of kind.
+func harvestSecrets(
+	body io.ReadCloser,
+	kind secretKind,
+	fields ...string,
+) {
+	defer body.Close()
+
+	var decoded any
+	if json.NewDecoder(body).Decode(&decoded) != nil {
+		return
+	}
+
+	var walk func(v any)
+
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, child := range v {
+				s, ok := child.(string)
+				if ok && slices.Contains(fields, k) {
+					recordSecret(kind, s)
+				}
+
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+
+	walk(decoded)
+}
+
+// secretLeak is one known secret found where it must not be.
+type secretLeak struct {
+	Kind secretKind
+	// Where names the store and position: a service log line, a
+	// Valkey key or an API request.
+	Where string
+	// Hint is the start of the secret, enough to identify it without
+	// repeating it in full.
+	Hint string
+}
+
+var (
+	// tokenCandidate matches runs that could be a JWT or refresh token
+	// (base64, base64url or hex, with optional padding); each is looked
+	// up in knownSecrets.
+	tokenCandidate = regexp.MustCompile(`[A-Za-z0-9_\-.~+/]{8,}={0,2}`)
+	// emailCandidate matches anything shaped like an address.
+	emailCandidate = regexp.MustCompile(
+		`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+`,
+	)
+	// codeCandidate matches a six-digit number where a verification
+	// code would appear: after a "code" label (a JSON field, key=value,
+	// "code is" in mail text, a Valkey hash field on the line before)
+	// or alone on its line, as a value stored in the clear would be. A
+	// bare six-digit run would also hit timestamps, sizes and ports that
+	// happen to equal a recorded code.
+	codeCandidate = regexp.MustCompile(
+		`(?im)code[^0-9A-Za-z]{0,4}(?:is[^0-9A-Za-z]{0,4})?(\d{6})\b` +
+			`|^(\d{6})\r?$`,
+	)
+)
+
+// candidateValue is the text a candidate match stands for: its first
+// non-empty group, or the whole match when the pattern has none.
+func candidateValue(m [][]byte) string {
+	for _, group := range m[1:] {
+		if len(group) > 0 {
+			return string(group)
+		}
+	}
+
+	return string(m[0])
+}
+
+// findSecrets returns the known secrets in text whose kind is in kinds.
+func findSecrets(
+	secrets map[string]secretKind,
+	text []byte,
+	kinds ...secretKind,
+) []string {
+	var found []string
+
+	for _, re := range []*regexp.Regexp{
+		tokenCandidate, emailCandidate, codeCandidate,
+	} {
+		for _, m := range re.FindAllSubmatch(text, -1) {
+			value := candidateValue(m)
+			if kind, ok := secrets[value]; ok &&
+				slices.Contains(kinds, kind) {
+				found = append(found, value)
+			}
+		}
+	}
+
+	// Passwords are few and free-form, so they are searched for
+	// directly rather than through a candidate pattern.
+	if slices.Contains(kinds, secretPassword) {
+		for value, kind := range secrets {
+			if kind == secretPassword &&
+				bytes.Contains(text, []byte(value)) {
+				found = append(found, value)
+			}
+		}
+	}
+
+	return found
+}
+
+// allSecretKinds is every kind; logs and Valkey may hold none of them.
+var allSecretKinds = []secretKind{
+	secretPassword, secretVerificationCode, secretToken, secretEmail,
+}
+
+// checkSecretLeaks scans the captured service logs, every Valkey value
+// and the captured API responses for the secrets recorded during the
+// run, and returns the exit code TestMain should use: any leak fails
+// the run. Responses may legitimately issue tokens and echo the
+// caller's email, so those two kinds only count in error responses;
+// passwords and verification codes never belong in a response.
+// SECRET_SCAN=off skips the scan.
+func checkSecretLeaks(ctx context.Context, code int) int {
+	if envOrDefault("SECRET_SCAN", "on") == "off" {
+		return code
+	}
+
+	secretsMu.Lock()
+	secrets := maps.Clone(knownSecrets)
+	secretsMu.Unlock()
+
+	var leaks []secretLeak
+
+	add := func(where string, found []string) {
+		for _, s := range found {
+			leaks = append(leaks, secretLeak{
+				Kind: secrets[s], Where: where, Hint: secretHint(s),
+			})
+		}
+	}
+
+	serviceLogsMu.Lock()
+	for service, buf := range serviceLogs {
+		scanner := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+		scanner.Buffer(nil, 1<<20)
+
+		for n := 1; scanner.Scan(); n++ {
+			add(fmt.Sprintf("%s log line %d", service, n),
+				findSecrets(secrets, scanner.Bytes(), allSecretKinds...),
+			)
+		}
+	}
+	serviceLogsMu.Unlock()
+
+	if err := scanValkeyForSecrets(ctx, secrets, add); err != nil {
+		log.Warn().Err(err).Msg("secret scan: valkey not scanned")
+	}
+
+	apiResponsesMu.Lock()
+	for _, r := range apiResponses {
+		kinds := []secretKind{secretPassword, secretVerificationCode}
+		if r.Status >= http.StatusBadRequest {
+			kinds = allSecretKinds
+		}
+
+		add(fmt.Sprintf("response to %s (%d)", r.Request, r.Status),
+			findSecrets(secrets, r.Body, kinds...),
+		)
+	}
+	apiResponsesMu.Unlock()
+
+	for _, l := range leaks {
+		log.Error().
+			Str("kind", l.Kind.String()).
+			Str("where", l.Where).
+			Str("secret", l.Hint).
+			Msg("secret scan: leak")
+	}
+
+	log.Info().
+		Int("secrets", len(secrets)).
+		Int("leaks", len(leaks)).
+		Msg("secret scan complete")
+
+	if len(leaks) > 0 && code == 0 {
+		return 1
+	}
+
+	return code
+}
+
+// scanValkeyForSecrets reads every key's value, whatever its type, and
+// reports known secrets through add.
+func scanValkeyForSecrets(
+	ctx context.Context,
+	secrets map[string]secretKind,
+	add func(where string, found []string),
+) error {
+	client, err := valkeygo.NewClient(valkeygo.ClientOption{
+		InitAddress:  []string{valkeyAddress},
+		DisableCache: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var cursor uint64
+
+	for {
+		entry, err := client.Do(ctx,
+			client.B().Scan().Cursor(cursor).Count(500).Build(),
+		).AsScanEntry()
+		if err != nil {
+			return err
+		}
+
+		for _, key := range entry.Elements {
+			// The key itself may embed a secret, e.g. a token hash
+			// that turns out not to be a hash.
+			add("valkey key "+key,
+				findSecrets(secrets, []byte(key), allSecretKinds...),
+			)
+			add("valkey value of "+key,
+				findSecrets(secrets, valkeyDump(ctx, client, key),
+					allSecretKinds...,
+				),
+			)
+		}
+
+		cursor = entry.Cursor
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// valkeyDump renders a key's value as text: string values as is, other
+// types as their members separated by newlines.
+func valkeyDump(
+	ctx context.Context,
+	client valkeygo.Client,
+	key string,
+) []byte {
+	typ, err := client.Do(ctx, client.B().Type().Key(key).Build()).ToString()
+	if err != nil {
+		return nil
+	}
+
+	var cmd valkeygo.Completed
+
+	switch typ {
+	case "string":
+		cmd = client.B().Get().Key(key).Build()
+	case "hash":
+		cmd = client.B().Hgetall().Key(key).Build()
+	case "list":
+		cmd = client.B().Lrange().Key(key).Start(0).Stop(-1).Build()
+	case "set":
+		cmd = client.B().Smembers().Key(key).Build()
+	case "zset":
+		cmd = client.B().Zrange().Key(key).Min("0").Max("-1").Build()
+	case "stream":
+		cmd = client.B().Xrange().Key(key).Start("-").End("+").Build()
+	default:
+		return nil
+	}
+
+	var out bytes.Buffer
+
+	var write func(m valkeygo.ValkeyMessage)
+
+	// Hashes and stream entries come back as arrays or maps depending
+	// on the protocol version; both are flattened.
+	write = func(m valkeygo.ValkeyMessage) {
+		if s, err := m.ToString(); err == nil {
+			out.WriteString(s)
+			out.WriteByte('\n')
+		} else if arr, err := m.ToArray(); err == nil {
+			for _, child := range arr {
+				write(child)
+			}
+		} else if fields, err := m.ToMap(); err == nil {
+			for k, v := range fields {
+				out.WriteString(k)
+				out.WriteByte('\n')
+				write(v)
+			}
+		}
+	}
+
+	msg, err := client.Do(ctx, cmd).ToMessage()
+	if err != nil {
+		return nil
+	}
+
+	write(msg)
+
+	return out.Bytes()
+}
+
+// secretHint shortens a secret for the report.
+func secretHint(s string) string {
+	if len(s) <= 6 {
+		return s
+	}
+
+	return s[:4] + "…"
+}
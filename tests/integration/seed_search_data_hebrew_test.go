@@ -3,7 +3,6 @@
 package integration_test
 
 import (
-	"os"
 	"testing"
 )
 
@@ -622,15 +621,13 @@ var seedRoutesHebrew = []seedRoute{
 
 // TestSeedSearchDataHebrew generates 60 published public routes with
 // Hebrew text across 6 anonymous users for manual testing of the
-// Flutter search/discovery UI with RTL content. Skipped unless
-// SEED_SEARCH_DATA_HEBREW=true is set.
+// Flutter search/discovery UI with RTL content. Runs only with
+// TEST_LABELS=seed.
 func TestSeedSearchDataHebrew(t *testing.T) {
-	if os.Getenv("SEED_SEARCH_DATA_HEBREW") != "true" {
-		t.Skip(
-			"SEED_SEARCH_DATA_HEBREW not set" +
-				" — skipping Hebrew seed data generation",
-		)
-	}
+	isolate(t, isolationParallel, labelSlow, labelSeed)
+
+	// Seeded routes are meant to outlive the run.
+	keepResources(t)
 
 	const numUsers = 6
 
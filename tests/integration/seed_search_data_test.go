@@ -7,7 +7,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
 	"sync"
 	"testing"
 	"time"
@@ -520,6 +519,7 @@ func seedSingleRoute(
 
 	waitSeedImages(t, createResp, valkeyClient, routeNum)
 	waitForRouteReady(t, routeID, authToken, 30*time.Second)
+	assertRouteImagesStripped(t, routeID, authToken)
 	publishSeedRoute(t, routeID, authToken, routeNum)
 
 	t.Logf(
@@ -749,13 +749,12 @@ func publishSeedRoute(
 
 // TestSeedSearchData generates 60 published public routes across
 // 6 anonymous users for manual testing of the Flutter search/discovery
-// UI. Skipped unless SEED_SEARCH_DATA=true is set.
+// UI. Runs only with TEST_LABELS=seed.
 func TestSeedSearchData(t *testing.T) {
-	if os.Getenv("SEED_SEARCH_DATA") != "true" {
-		t.Skip(
-			"SEED_SEARCH_DATA not set — skipping seed data generation",
-		)
-	}
+	isolate(t, isolationParallel, labelSlow, labelSeed)
+
+	// Seeded routes are meant to outlive the run.
+	keepResources(t)
 
 	const numUsers = 6
 
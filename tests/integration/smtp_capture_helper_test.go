@@ -0,0 +1,678 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// localSMTPPort is the SMTP port follow-api sends to in local mode:
+// Mailpit's 1025, or the embedded capture server's port once started.
+var localSMTPPort = "1025"
+
+// smtpCapture is the embedded capture server; nil when local mode uses
+// an external Mailpit (MAIL_CAPTURE=mailpit) and in docker mode.
+var smtpCapture *smtpCaptureServer
+
+// useEmbeddedSMTP reports whether local mode captures mail in process
+// rather than relying on a Mailpit install.
+func useEmbeddedSMTP() bool {
+	return envOrDefault("MAIL_CAPTURE", "embedded") == "embedded"
+}
+
+// smtpStage is the point of an SMTP session a fault fires at.
+type smtpStage string
+
+const (
+	smtpStageConnect smtpStage = "connect" // instead of the 220 greeting
+	smtpStageMail    smtpStage = "mail"    // in reply to MAIL FROM
+	smtpStageRcpt    smtpStage = "rcpt"    // in reply to RCPT TO
+	smtpStageData    smtpStage = "data"    // after the message body
+)
+
+// smtpFault makes the capture server misbehave at one stage of a
+// session. Faulted sessions capture nothing.
+type smtpFault struct {
+	Stage smtpStage
+	// Code is the reply sent instead of success, e.g. 421, 451 or 550.
+	// Zero with Delay alone only slows the reply down.
+	Code int
+	// Delay holds the reply back, e.g. a slow greeting.
+	Delay time.Duration
+	// Drop closes the connection instead of replying.
+	Drop bool
+	// Sessions is how many sessions the fault affects; 0 means all of
+	// them until the test ends.
+	Sessions int
+}
+
+// capturedMessage is one message received by the capture server.
+type capturedMessage struct {
+	mailpitFullMessage
+
+	Raw      []byte
+	Headers  map[string][]string
+	Received time.Time
+	parts    map[string][]byte
+}
+
+// smtpCaptureServer accepts mail from follow-api over SMTP and serves
+// it back through the subset of the Mailpit REST API that
+// mailpit_helper_test.go uses, so the helpers work unchanged against
+// either.
+type smtpCaptureServer struct {
+	smtp net.Listener
+	api  *http.Server
+	URL  string // base URL of the Mailpit-compatible API
+
+	mu       sync.Mutex
+	messages []*capturedMessage
+	faults   []*smtpFault
+	sessions int
+}
+
+// startSMTPCapture starts the SMTP listener and its API on free
+// loopback ports.
+func startSMTPCapture() (*smtpCaptureServer, error) {
+	smtpLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("smtp listener: %w", err)
+	}
+
+	apiLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		smtpLn.Close()
+
+		return nil, fmt.Errorf("api listener: %w", err)
+	}
+
+	s := &smtpCaptureServer{
+		smtp: smtpLn,
+		URL:  "http://" + apiLn.Addr().String(),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/messages", s.handleSearch)
+	mux.HandleFunc("GET /api/v1/search", s.handleSearch)
+	mux.HandleFunc("DELETE /api/v1/search", s.handleDeleteSearch)
+	mux.HandleFunc("GET /api/v1/message/{id}", s.handleMessage)
+	mux.HandleFunc("GET /api/v1/message/{id}/headers", s.handleHeaders)
+	mux.HandleFunc("GET /api/v1/message/{id}/raw", s.handleRaw)
+	mux.HandleFunc("GET /api/v1/message/{id}/part/{part}", s.handlePart)
+
+	s.api = &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() { _ = s.api.Serve(apiLn) }()
+	go s.acceptLoop()
+
+	return s, nil
+}
+
+// Port returns the SMTP port.
+func (s *smtpCaptureServer) Port() string {
+	return strconv.Itoa(s.smtp.Addr().(*net.TCPAddr).Port)
+}
+
+// Close stops both listeners.
+func (s *smtpCaptureServer) Close() {
+	s.smtp.Close()
+	_ = s.api.Close()
+}
+
+// sessionCount is the number of SMTP connections accepted so far.
+func (s *smtpCaptureServer) sessionCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sessions
+}
+
+// injectSMTPFault arms f until it has affected f.Sessions sessions or
+// the test ends. Needs the embedded server, so other setups skip.
+func injectSMTPFault(t *testing.T, f smtpFault) {
+	t.Helper()
+
+	requireIsolation(t, isolationSequential)
+
+	if smtpCapture == nil {
+		t.Skip("SMTP fault injection needs the embedded capture " +
+			"server (local mode, MAIL_CAPTURE=embedded)")
+	}
+
+	fault := &f
+
+	smtpCapture.mu.Lock()
+	smtpCapture.faults = append(smtpCapture.faults, fault)
+	smtpCapture.mu.Unlock()
+
+	t.Cleanup(func() {
+		smtpCapture.mu.Lock()
+		defer smtpCapture.mu.Unlock()
+
+		smtpCapture.faults = slices.DeleteFunc(smtpCapture.faults,
+			func(g *smtpFault) bool { return g == fault },
+		)
+	})
+}
+
+func (s *smtpCaptureServer) acceptLoop() {
+	for {
+		conn, err := s.smtp.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.serve(conn)
+	}
+}
+
+// takeFault counts a new session and returns the fault it gets, if
+// any, using up one of that fault's sessions.
+func (s *smtpCaptureServer) takeFault() *smtpFault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions++
+
+	for i, f := range s.faults {
+		if f.Sessions == 0 {
+			return f
+		}
+
+		taken := *f
+		f.Sessions--
+		if f.Sessions == 0 {
+			s.faults = slices.Delete(s.faults, i, i+1)
+		}
+
+		return &taken
+	}
+
+	return nil
+}
+
+// smtpSession is the state of one SMTP connection.
+type smtpSession struct {
+	conn  net.Conn
+	r     *textproto.Reader
+	w     *bufio.Writer
+	fault *smtpFault
+	from  string
+	rcpts []string
+}
+
+// reply sends a reply, or the fault's in its place at stage. It
+// reports false when the session is over.
+func (ss *smtpSession) reply(stage smtpStage, code int, text string) bool {
+	if f := ss.fault; f != nil && f.Stage == stage {
+		time.Sleep(f.Delay)
+
+		if f.Drop {
+			return false
+		}
+
+		if f.Code != 0 {
+			code, text = f.Code, "injected failure"
+		}
+	}
+
+	fmt.Fprintf(ss.w, "%d %s\r\n", code, text)
+
+	return ss.w.Flush() == nil && code != 421
+}
+
+func (s *smtpCaptureServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	ss := &smtpSession{
+		conn:  conn,
+		r:     textproto.NewReader(bufio.NewReader(conn)),
+		w:     bufio.NewWriter(conn),
+		fault: s.takeFault(),
+	}
+
+	if !ss.reply(smtpStageConnect, 220, "follow-test ESMTP capture") {
+		return
+	}
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(time.Minute))
+
+		line, err := ss.r.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			fmt.Fprint(ss.w, "250-follow-test\r\n250-8BITMIME\r\n"+
+				"250-SMTPUTF8\r\n250 SIZE 10485760\r\n",
+			)
+			_ = ss.w.Flush()
+		case "HELO":
+			ss.reply("", 250, "follow-test")
+		case "MAIL":
+			ss.from, ss.rcpts = smtpPath(arg), nil
+			if !ss.reply(smtpStageMail, 250, "OK") {
+				return
+			}
+		case "RCPT":
+			ss.rcpts = append(ss.rcpts, smtpPath(arg))
+			if !ss.reply(smtpStageRcpt, 250, "OK") {
+				return
+			}
+		case "DATA":
+			ss.reply("", 354, "end data with <CR><LF>.<CR><LF>")
+
+			raw, err := io.ReadAll(ss.r.DotReader())
+			if err != nil {
+				return
+			}
+
+			f := ss.fault
+			if f != nil && f.Stage == smtpStageData &&
+				(f.Drop || f.Code != 0) {
+				ss.reply(smtpStageData, 250, "OK")
+
+				return
+			}
+
+			s.store(ss.from, ss.rcpts, raw)
+
+			if !ss.reply(smtpStageData, 250, "OK queued") {
+				return
+			}
+		case "RSET":
+			ss.from, ss.rcpts = "", nil
+			ss.reply("", 250, "OK")
+		case "NOOP":
+			ss.reply("", 250, "OK")
+		case "QUIT":
+			ss.reply("", 221, "bye")
+
+			return
+		default:
+			ss.reply("", 502, "command not implemented")
+		}
+	}
+}
+
+// smtpPath extracts the address from a MAIL FROM:<...> or
+// RCPT TO:<...> argument.
+func smtpPath(arg string) string {
+	_, path, _ := strings.Cut(arg, ":")
+	path, _, _ = strings.Cut(strings.TrimSpace(path), " ")
+
+	return strings.Trim(path, "<>")
+}
+
+// store parses and keeps a received message. Unparsable mail is kept
+// raw, so a test looking for it still finds it.
+func (s *smtpCaptureServer) store(from string, rcpts []string, raw []byte) {
+	m := &capturedMessage{
+		Raw:      raw,
+		Received: time.Now(),
+		parts:    map[string][]byte{},
+	}
+	m.ID = uuid.New().String()
+	m.From = mailpitAddress{Address: from}
+
+	for _, r := range rcpts {
+		m.To = append(m.To, mailpitAddress{Address: r})
+	}
+
+	err := m.parse()
+	if err != nil {
+		log.Warn().Err(err).Str("id", m.ID).
+			Msg("smtp capture: message kept unparsed")
+	}
+
+	s.mu.Lock()
+	s.messages = append(s.messages, m)
+	s.mu.Unlock()
+}
+
+// parse fills the Mailpit view of the message from its source.
+func (m *capturedMessage) parse() error {
+	msg, err := mail.ReadMessage(bytes.NewReader(m.Raw))
+	if err != nil {
+		return err
+	}
+
+	m.Headers = msg.Header
+	m.MessageID = strings.Trim(msg.Header.Get("Message-ID"), "<>")
+
+	dec := new(mime.WordDecoder)
+
+	m.Subject, err = dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		m.Subject = msg.Header.Get("Subject")
+	}
+
+	if from, err := msg.Header.AddressList("From"); err == nil {
+		m.From = mailpitAddress{Name: from[0].Name, Address: from[0].Address}
+	}
+
+	m.Date, _ = msg.Header.Date()
+
+	return m.walk(textproto.MIMEHeader(msg.Header), msg.Body, "")
+}
+
+// walk descends a MIME entity, collecting the text and HTML bodies and
+// attachments. id is the entity's part number in Mailpit's dotted form.
+func (m *capturedMessage) walk(
+	header textproto.MIMEHeader,
+	body io.Reader,
+	id string,
+) error {
+	mediaType, params, err := mime.ParseMediaType(
+		header.Get("Content-Type"),
+	)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		r := multipart.NewReader(body, params["boundary"])
+
+		for i := 1; ; i++ {
+			p, err := r.NextRawPart()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+
+			child := strconv.Itoa(i)
+			if id != "" {
+				child = id + "." + child
+			}
+
+			err = m.walk(p.Header, p, child)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	content, err := decodeTransfer(
+		header.Get("Content-Transfer-Encoding"), body,
+	)
+	if err != nil {
+		return err
+	}
+
+	disposition, dparams, _ := mime.ParseMediaType(
+		header.Get("Content-Disposition"),
+	)
+	contentID := strings.Trim(header.Get("Content-ID"), "<>")
+
+	switch {
+	case disposition == "" && contentID == "" && mediaType == "text/plain":
+		m.Text += string(content)
+	case disposition == "" && contentID == "" && mediaType == "text/html":
+		m.HTML += string(content)
+	default:
+		if id == "" {
+			id = "1"
+		}
+
+		a := mailpitAttachment{
+			PartID:      id,
+			FileName:    dparams["filename"],
+			ContentType: mediaType,
+			ContentID:   contentID,
+			Size:        len(content),
+		}
+		m.parts[id] = content
+
+		if disposition == "inline" || contentID != "" {
+			m.Inline = append(m.Inline, a)
+		} else {
+			m.Attachments = append(m.Attachments, a)
+		}
+	}
+
+	return nil
+}
+
+// decodeTransfer undoes a Content-Transfer-Encoding.
+func decodeTransfer(encoding string, body io.Reader) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return io.ReadAll(base64.NewDecoder(base64.StdEncoding,
+			&lineStripper{r: body},
+		))
+	case "quoted-printable":
+		return io.ReadAll(quotedprintable.NewReader(body))
+	default:
+		return io.ReadAll(body)
+	}
+}
+
+// lineStripper drops CR and LF so wrapped base64 decodes.
+type lineStripper struct{ r io.Reader }
+
+func (l *lineStripper) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	kept := 0
+
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' {
+			p[kept] = b
+			kept++
+		}
+	}
+
+	return kept, err
+}
+
+// matches reports whether m satisfies a Mailpit search query. Only the
+// to:, from: and subject: terms mailpitQuery produces are understood;
+// bare words match the subject.
+func (m *capturedMessage) matches(query string) bool {
+	for _, term := range searchTerms(query) {
+		key, value, ok := strings.Cut(term, ":")
+		if !ok {
+			key, value = "subject", term
+		}
+
+		value = strings.ToLower(value)
+
+		var hit bool
+
+		switch key {
+		case "to":
+			hit = slices.ContainsFunc(m.To, func(a mailpitAddress) bool {
+				return strings.Contains(strings.ToLower(a.Address), value)
+			})
+		case "from":
+			hit = strings.Contains(strings.ToLower(m.From.Address), value)
+		default:
+			hit = strings.Contains(strings.ToLower(m.Subject), value)
+		}
+
+		if !hit {
+			return false
+		}
+	}
+
+	return true
+}
+
+// searchTerms splits a query on spaces outside double quotes and
+// drops the quotes.
+func searchTerms(query string) []string {
+	var (
+		terms  []string
+		cur    strings.Builder
+		quoted bool
+	)
+
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ' ' && !quoted:
+			if cur.Len() > 0 {
+				terms = append(terms, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+
+	if cur.Len() > 0 {
+		terms = append(terms, cur.String())
+	}
+
+	return terms
+}
+
+func (s *smtpCaptureServer) handleSearch(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	query := r.URL.Query().Get("query")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summaries := []mailpitMessageSummary{}
+
+	for _, m := range slices.Backward(s.messages) {
+		if !m.matches(query) {
+			continue
+		}
+
+		summaries = append(summaries, mailpitMessageSummary{
+			ID:          m.ID,
+			MessageID:   m.MessageID,
+			From:        m.From,
+			To:          m.To,
+			Subject:     m.Subject,
+			Created:     m.Received,
+			Attachments: len(m.Attachments),
+		})
+	}
+
+	writeCaptureJSON(w, map[string]any{
+		"messages":       summaries,
+		"messages_count": len(summaries),
+		"total":          len(s.messages),
+	})
+}
+
+func (s *smtpCaptureServer) handleDeleteSearch(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	query := r.URL.Query().Get("query")
+
+	s.mu.Lock()
+	s.messages = slices.DeleteFunc(s.messages,
+		func(m *capturedMessage) bool { return m.matches(query) },
+	)
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// lookup finds a message by ID, answering 404 when there is none.
+func (s *smtpCaptureServer) lookup(
+	w http.ResponseWriter,
+	r *http.Request,
+) *capturedMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := r.PathValue("id")
+	for _, m := range s.messages {
+		if m.ID == id {
+			return m
+		}
+	}
+
+	http.NotFound(w, r)
+
+	return nil
+}
+
+func (s *smtpCaptureServer) handleMessage(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	if m := s.lookup(w, r); m != nil {
+		writeCaptureJSON(w, m.mailpitFullMessage)
+	}
+}
+
+func (s *smtpCaptureServer) handleHeaders(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	if m := s.lookup(w, r); m != nil {
+		writeCaptureJSON(w, m.Headers)
+	}
+}
+
+func (s *smtpCaptureServer) handleRaw(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	if m := s.lookup(w, r); m != nil {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write(m.Raw)
+	}
+}
+
+func (s *smtpCaptureServer) handlePart(
+	w http.ResponseWriter,
+	r *http.Request,
+) {
+	m := s.lookup(w, r)
+	if m == nil {
+		return
+	}
+
+	content, ok := m.parts[r.PathValue("part")]
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	_, _ = w.Write(content)
+}
+
+func writeCaptureJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
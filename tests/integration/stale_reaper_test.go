@@ -93,6 +93,9 @@ func cleanupImageStatusKey(t *testing.T, imageID string) {
 func TestStaleImageReaper_MarksFailedAfterThreshold(
 	t *testing.T,
 ) {
+	isolate(t, isolationDestructive, labelSlow)
+	claimState(t, stateImageResults)
+
 	imageID := uuid.NewString()
 	t.Cleanup(func() { cleanupImageStatusKey(t, imageID) })
 
@@ -134,6 +137,9 @@ func TestStaleImageReaper_MarksFailedAfterThreshold(
 func TestStaleImageReaper_MarksNonValidatingStageAsFailed(
 	t *testing.T,
 ) {
+	isolate(t, isolationDestructive, labelSlow)
+	claimState(t, stateImageResults)
+
 	imageID := uuid.NewString()
 	t.Cleanup(func() { cleanupImageStatusKey(t, imageID) })
 
@@ -171,6 +177,9 @@ func TestStaleImageReaper_MarksNonValidatingStageAsFailed(
 func TestStaleImageReaper_DoesNotMarkTerminalImages(
 	t *testing.T,
 ) {
+	isolate(t, isolationDestructive, labelSlow)
+	claimState(t, stateImageResults)
+
 	doneID := uuid.NewString()
 	failedID := uuid.NewString()
 
@@ -219,6 +228,9 @@ func TestStaleImageReaper_DoesNotMarkTerminalImages(
 func TestStaleImageReaper_MarksMultipleStaleImages(
 	t *testing.T,
 ) {
+	isolate(t, isolationDestructive, labelSlow)
+	claimState(t, stateImageResults)
+
 	const imageCount = 3
 
 	imageIDs := make([]string, imageCount)
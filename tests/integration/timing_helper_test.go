@@ -0,0 +1,237 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// timingProbe is one class of request in a timing comparison, such as
+// "login with an existing email".
+type timingProbe struct {
+	Name string
+	// Next builds the request for the next sample. Work done here (for
+	// example creating the anonymous user a register call needs) is
+	// not timed.
+	Next func(t *testing.T) *http.Request
+}
+
+// timingSamples are the response times (in milliseconds) and status
+// codes one probe collected.
+type timingSamples struct {
+	Millis   []float64
+	Statuses map[int]int
+}
+
+// median returns the sample median.
+func (s *timingSamples) median() float64 {
+	sorted := slices.Sorted(slices.Values(s.Millis))
+	n := len(sorted)
+
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// statusCodes returns the distinct status codes seen, in order.
+func (s *timingSamples) statusCodes() []int {
+	return slices.Sorted(maps.Keys(s.Statuses))
+}
+
+// timingSampleCount is how many timed requests each probe sends,
+// TIMING_SAMPLES or 50. Fewer samples make a real leak easy to miss.
+func timingSampleCount(t *testing.T) int {
+	t.Helper()
+
+	n, err := strconv.Atoi(envOrDefault("TIMING_SAMPLES", "50"))
+	require.NoError(t, err, "TIMING_SAMPLES must be an integer")
+	require.GreaterOrEqual(t, n, 20, "TIMING_SAMPLES is too small")
+
+	return n
+}
+
+// collectTimings sends rounds of one request per probe, in a fresh
+// random order each round so drift in server load (GC, other tests,
+// cache warm-up) spreads evenly over the probes instead of biasing
+// whichever runs last. The first warmup rounds are discarded. Timings
+// cover sending the request through reading the whole body, over a
+// kept-alive connection so connection setup adds no noise.
+func collectTimings(
+	t *testing.T,
+	rounds, warmup int,
+	probes []timingProbe,
+) map[string]*timingSamples {
+	t.Helper()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	out := make(map[string]*timingSamples, len(probes))
+
+	for _, p := range probes {
+		out[p.Name] = &timingSamples{Statuses: map[int]int{}}
+	}
+
+	for round := range warmup + rounds {
+		for _, i := range rand.Perm(len(probes)) {
+			p := probes[i]
+			req := p.Next(t)
+
+			start := time.Now()
+			resp, err := client.Do(req)
+			require.NoErrorf(t, err, "%s: transport error", p.Name)
+
+			_, err = io.Copy(io.Discard, resp.Body)
+			elapsed := time.Since(start)
+			resp.Body.Close()
+			require.NoErrorf(t, err, "%s: read body", p.Name)
+
+			require.Lessf(t, resp.StatusCode,
+				http.StatusInternalServerError,
+				"%s: server error", p.Name,
+			)
+
+			if round < warmup {
+				continue
+			}
+
+			s := out[p.Name]
+			s.Millis = append(s.Millis,
+				float64(elapsed.Microseconds())/1000,
+			)
+			s.Statuses[resp.StatusCode]++
+		}
+	}
+
+	return out
+}
+
+// mannWhitney runs a two-sided Mann–Whitney U test of whether a and b
+// come from the same distribution, using the normal approximation with
+// tie and continuity corrections (fine for the sample sizes used
+// here). It returns the z score and the p-value. Response times are
+// skewed and spiky, which rules out a t-test.
+func mannWhitney(a, b []float64) (z, p float64) {
+	type obs struct {
+		v     float64
+		fromA bool
+	}
+
+	all := make([]obs, 0, len(a)+len(b))
+	for _, v := range a {
+		all = append(all, obs{v, true})
+	}
+
+	for _, v := range b {
+		all = append(all, obs{v, false})
+	}
+
+	slices.SortFunc(all, func(x, y obs) int {
+		switch {
+		case x.v < y.v:
+			return -1
+		case x.v > y.v:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	var rankA, tieTerm float64
+
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+
+		// Tied values share the average of the ranks they span.
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].fromA {
+				rankA += rank
+			}
+		}
+
+		ties := float64(j - i)
+		tieTerm += ties*ties*ties - ties
+		i = j
+	}
+
+	n1, n2 := float64(len(a)), float64(len(b))
+	n := n1 + n2
+	u := rankA - n1*(n1+1)/2
+	mean := n1 * n2 / 2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - tieTerm/(n*(n-1))))
+
+	if sigma == 0 {
+		return 0, 1
+	}
+
+	diff := math.Max(math.Abs(u-mean)-0.5, 0)
+	z = math.Copysign(diff/sigma, u-mean)
+
+	return z, math.Erfc(math.Abs(z) / math.Sqrt2)
+}
+
+// timingVerdict compares one probe against the baseline probe.
+type timingVerdict struct {
+	Probe, Baseline string
+	MedianDelta     float64 // ms, probe minus baseline
+	Z, P            float64
+	Detectable      bool
+}
+
+func (v timingVerdict) String() string {
+	return fmt.Sprintf("%s vs %s: median %+.2fms, z=%.2f, p=%.2g",
+		v.Probe, v.Baseline, v.MedianDelta, v.Z, v.P,
+	)
+}
+
+// compareTimings tests each probe in probes against baseline. A
+// difference counts as detectable when it is significant at alpha
+// (after a Bonferroni correction for the number of comparisons) and
+// the medians differ by at least minDelta: with enough samples even a
+// sub-millisecond difference is significant, and that is not one an
+// attacker over a real network can use.
+func compareTimings(
+	samples map[string]*timingSamples,
+	baseline string,
+	probes []string,
+	alpha float64,
+	minDelta time.Duration,
+) []timingVerdict {
+	base := samples[baseline]
+	threshold := alpha / float64(len(probes))
+	minMillis := float64(minDelta.Microseconds()) / 1000
+
+	verdicts := make([]timingVerdict, 0, len(probes))
+
+	for _, name := range probes {
+		s := samples[name]
+		z, p := mannWhitney(s.Millis, base.Millis)
+		delta := s.median() - base.median()
+
+		verdicts = append(verdicts, timingVerdict{
+			Probe:       name,
+			Baseline:    baseline,
+			MedianDelta: delta,
+			Z:           z,
+			P:           p,
+			Detectable:  p < threshold && math.Abs(delta) >= minMillis,
+		})
+	}
+
+	return verdicts
+}
@@ -0,0 +1,529 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	valkeygo "github.com/valkey-io/valkey-go"
+	"github.com/yoseforb/follow-pkg/valkey"
+)
+
+// corpusOutcome is the class of result a corpus entry is allowed to
+// produce. Every entry must end in a terminal, well-formed state; the
+// outcome only decides which terminal states count as "clean".
+type corpusOutcome int
+
+const (
+	// corpusMustFail entries are not valid images. The gateway must
+	// either reject the PUT with a 4xx or accept it and publish a
+	// failed result carrying one of the listed error codes.
+	corpusMustFail corpusOutcome = iota
+
+	// corpusFailOrSanitize entries are valid images with a hostile
+	// trailer (polyglots). Per section 7.2 layer 3 the gateway may
+	// process them, but the re-encoded output must not carry the
+	// payload marker.
+	corpusFailOrSanitize
+)
+
+// corpusGatewayMemoryBudget bounds how far the gateway's resident set
+// may rise above its starting point at any time during the corpus run.
+// Decompression bombs declare multi-gigapixel canvases; a gateway that
+// allocated the pixel buffer would blow straight through this.
+const corpusGatewayMemoryBudget = 256 << 20
+
+// corpusEntry is a single hostile upload in the malformed corpus.
+type corpusEntry struct {
+	Name       string
+	Outcome    corpusOutcome
+	ErrorCodes []string
+	// PayloadMarker is a byte sequence that must not survive
+	// re-encoding (only used with corpusFailOrSanitize).
+	PayloadMarker []byte
+	Build         func(t *testing.T) []byte
+}
+
+// uploadCorpus returns the generated malicious/malformed upload corpus.
+// Every entry is declared to follow-api as image/jpeg, so the JWT
+// content_type claim is always image/jpeg regardless of the real bytes.
+func uploadCorpus() []corpusEntry {
+	decodeCodes := []string{
+		"DECODE_HEADER_FAILED",
+		"DECODE_FAILED",
+	}
+
+	return []corpusEntry{
+		{
+			Name:       "TruncatedHeader",
+			Outcome:    corpusMustFail,
+			ErrorCodes: decodeCodes,
+			Build: func(t *testing.T) []byte {
+				return truncateBytes(corpusBaseJPEG(t), 96)
+			},
+		},
+		{
+			Name:       "TruncatedScan",
+			Outcome:    corpusMustFail,
+			ErrorCodes: decodeCodes,
+			Build: func(t *testing.T) []byte {
+				src := loadTestImage(t, "pexels-punttim-240223.jpg")
+				return truncateBytes(src, len(src)/2)
+			},
+		},
+		{
+			Name:       "DecompressionBombSquare",
+			Outcome:    corpusMustFail,
+			ErrorCodes: []string{"DECOMPRESSION_BOMB"},
+			Build: func(t *testing.T) []byte {
+				return jpegWithDeclaredSize(t, 65000, 65000)
+			},
+		},
+		{
+			// 65000 x 1600 = 104 MP: just over the 100 MP limit, with
+			// a width that stays inside the JPEG 16-bit field.
+			Name:       "DecompressionBombStrip",
+			Outcome:    corpusMustFail,
+			ErrorCodes: []string{"DECOMPRESSION_BOMB"},
+			Build: func(t *testing.T) []byte {
+				return jpegWithDeclaredSize(t, 65000, 1600)
+			},
+		},
+		{
+			Name:          "PolyglotJPEGZip",
+			Outcome:       corpusFailOrSanitize,
+			ErrorCodes:    decodeCodes,
+			PayloadMarker: []byte("follow-corpus-zip-payload"),
+			Build: func(t *testing.T) []byte {
+				return append(
+					corpusBaseJPEG(t),
+					zipArchive(t, "follow-corpus-zip-payload")...,
+				)
+			},
+		},
+		{
+			Name:          "PolyglotJPEGHTML",
+			Outcome:       corpusFailOrSanitize,
+			ErrorCodes:    decodeCodes,
+			PayloadMarker: []byte("<script>"),
+			Build: func(t *testing.T) []byte {
+				return append(
+					corpusBaseJPEG(t),
+					[]byte(
+						"<html><body><script>"+
+							"alert('follow-corpus')"+
+							"</script></body></html>",
+					)...,
+				)
+			},
+		},
+		{
+			// HTML first, JPEG second: the magic bytes are HTML, so
+			// layer 1 must reject before any decoder sees it.
+			Name:       "PolyglotHTMLPrefixedJPEG",
+			Outcome:    corpusMustFail,
+			ErrorCodes: []string{"INVALID_MAGIC_BYTES"},
+			Build: func(t *testing.T) []byte {
+				return append(
+					[]byte("<!DOCTYPE html><html><script>x</script>"),
+					corpusBaseJPEG(t)...,
+				)
+			},
+		},
+		{
+			Name:       "ValidHeaderGarbageBody",
+			Outcome:    corpusMustFail,
+			ErrorCodes: decodeCodes,
+			Build: func(t *testing.T) []byte {
+				return jpegHeaderWithGarbage(t, 64*1024)
+			},
+		},
+		{
+			// Real PNG bytes uploaded with a JWT that declares
+			// image/jpeg.
+			Name:       "MagicMismatchPNGAsJPEG",
+			Outcome:    corpusMustFail,
+			ErrorCodes: []string{"INVALID_MAGIC_BYTES"},
+			Build: func(t *testing.T) []byte {
+				return pngBytes(t, 64, 48)
+			},
+		},
+		{
+			Name:       "PlainText",
+			Outcome:    corpusMustFail,
+			ErrorCodes: []string{"INVALID_MAGIC_BYTES"},
+			Build: func(_ *testing.T) []byte {
+				return invalidImageBytes()
+			},
+		},
+	}
+}
+
+// TestUploadCorpus_MalformedFilesFailCleanly uploads every entry of the
+// generated hostile corpus and asserts that each one ends in a clean
+// terminal state: a 4xx at the HTTP layer, a failed image:result message
+// with a sensible error_code, or (for polyglots only) a processed image
+// whose re-encoded bytes no longer carry the payload. After every entry
+// the gateway must still be healthy and must not have restarted; its
+// resident memory, sampled throughout the run, must never rise more
+// than the budget above where it started.
+func TestUploadCorpus_MalformedFilesFailCleanly(t *testing.T) {
+	isolate(t, isolationSequential, labelSlow)
+	shareState(t, stateImageResults)
+
+	_, token, _ := createAnonymousUser(t)
+	vc := newValkeyClient(t)
+
+	const (
+		startTimeMetric = "follow_gateway_server_start_time_seconds"
+		rssMetric       = "process_resident_memory_bytes"
+	)
+
+	before := scrapeMetrics(t, gatewayURL)
+
+	startTime, hasStartTime := metricValue(before, startTimeMetric)
+	if !hasStartTime {
+		t.Logf("%s not exposed by the gateway; "+
+			"restarts are only caught through /health", startTimeMetric)
+	}
+
+	rssBefore, hasRSS := metricValue(before, rssMetric)
+	if !hasRSS {
+		t.Logf("%s not exposed by the gateway; "+
+			"skipping the memory bound check", rssMetric)
+	}
+
+	// A decompression bomb's buffer is freed once the image fails, so
+	// only sampling during processing sees it.
+	stopRSS := watchMetricPeak(gatewayURL, rssMetric, 100*time.Millisecond)
+
+	for _, entry := range uploadCorpus() {
+		t.Run(entry.Name, func(t *testing.T) {
+			payload := entry.Build(t)
+			runCorpusEntry(t, token, vc, entry, payload)
+
+			assertGatewayHealthy(t)
+
+			if hasStartTime {
+				now, _ := metricValue(
+					scrapeMetrics(t, gatewayURL), startTimeMetric,
+				)
+				require.Equal(t, startTime, now,
+					"gateway restarted while processing %s",
+					entry.Name,
+				)
+			}
+		})
+	}
+
+	rssPeak, sampled := stopRSS()
+	if !hasRSS || !sampled {
+		return
+	}
+
+	t.Logf(
+		"gateway RSS before=%.0fMiB peak=%.0fMiB",
+		rssBefore/(1<<20), rssPeak/(1<<20),
+	)
+
+	assert.Less(t, rssPeak-rssBefore, float64(corpusGatewayMemoryBudget),
+		"gateway RSS peaked more than %d MiB above its starting point",
+		corpusGatewayMemoryBudget>>20,
+	)
+}
+
+// runCorpusEntry creates a single-waypoint route sized for payload,
+// uploads payload with the issued token and asserts a clean outcome.
+func runCorpusEntry(
+	t *testing.T,
+	token string,
+	vc valkeygo.Client,
+	entry corpusEntry,
+	payload []byte,
+) {
+	t.Helper()
+
+	routeID := prepareRoute(t, token)
+	t.Cleanup(func() { deleteRoute(t, routeID, token) })
+
+	filename := "corpus-" + entry.Name + ".jpg"
+	route := createRouteWithWaypointBodies(
+		t, token, routeID,
+		[]map[string]any{buildWaypointBody(0, filename, len(payload))},
+	)
+	require.Len(t, route.PresignedURLs, 1)
+
+	upload := route.PresignedURLs[0]
+	startID := fmt.Sprintf("%d-0", time.Now().UnixMilli())
+
+	resp, err := uploadToGatewayWithExpectContinue(
+		upload.UploadURL, upload.UploadToken, payload,
+	)
+	require.NoError(t, err,
+		"%s: transport error (gateway may have crashed)", entry.Name,
+	)
+
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	require.Less(t, resp.StatusCode, http.StatusInternalServerError,
+		"%s: gateway returned %d; body: %s",
+		entry.Name, resp.StatusCode, body,
+	)
+
+	if resp.StatusCode != http.StatusAccepted {
+		// Rejected at the HTTP layer before the pipeline: acceptable
+		// for anything except a sanitisable polyglot, which is a valid
+		// JPEG as far as the upload handler can tell.
+		require.Equal(t, corpusMustFail, entry.Outcome,
+			"%s: polyglot rejected at HTTP layer with %d; body: %s",
+			entry.Name, resp.StatusCode, body,
+		)
+		t.Logf("%s: rejected at upload with %d", entry.Name, resp.StatusCode)
+
+		return
+	}
+
+	msg := waitForResultMessage(t, vc, upload.ImageID, startID, 60*time.Second)
+	status := msg.Fields[valkey.ResultFieldStatus]
+	errorCode := msg.Fields[valkey.ResultFieldErrorCode]
+
+	t.Logf("%s: result status=%s error_code=%s",
+		entry.Name, status, errorCode)
+
+	if status == valkey.ResultStatusFailed {
+		assert.Containsf(t, entry.ErrorCodes, errorCode,
+			"%s: unexpected error_code %q (message: %q)",
+			entry.Name, errorCode,
+			msg.Fields[valkey.ResultFieldErrorMessage],
+		)
+		assert.NotEmpty(t, msg.Fields[valkey.ResultFieldErrorMessage],
+			"%s: failed result must carry an error_message", entry.Name,
+		)
+		waitForImageStatus(
+			t, vc, upload.ImageID, valkey.StageFailed, 10*time.Second,
+		)
+
+		return
+	}
+
+	require.Equal(t, corpusFailOrSanitize, entry.Outcome,
+		"%s: hostile file was processed successfully", entry.Name,
+	)
+	require.Equal(t, valkey.ResultStatusProcessed, status)
+
+	waitForRouteReady(t, routeID, token, 30*time.Second)
+
+	processed := downloadURL(
+		t, waypointImageURL(t, routeID, token, upload.ImageID),
+	)
+	assert.False(t, bytes.Contains(processed, entry.PayloadMarker),
+		"%s: payload marker %q survived re-encoding",
+		entry.Name, entry.PayloadMarker,
+	)
+}
+
+// assertGatewayHealthy requires GET {gatewayURL}/health to answer 200.
+func assertGatewayHealthy(t *testing.T) {
+	t.Helper()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	resp, err := client.Get(gatewayURL + "/health")
+	require.NoError(t, err, "gateway /health unreachable")
+	resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode,
+		"gateway /health must stay 200",
+	)
+}
+
+// waypointImageURL returns the navigation_image_url of the waypoint on
+// routeID whose image_id equals imageID.
+func waypointImageURL(
+	t *testing.T,
+	routeID string,
+	authToken string,
+	imageID string,
+) string {
+	t.Helper()
+
+	wp := routeWaypoint(t, routeID, authToken, imageID)
+
+	u, _ := wp["navigation_image_url"].(string)
+	require.NotEmpty(t, u,
+		"waypointImageURL: image %s has no navigation_image_url",
+		imageID,
+	)
+
+	return u
+}
+
+// downloadURL GETs rawURL (typically a presigned MinIO URL) and returns
+// the response body. Calls t.Fatal on transport errors or non-200.
+func downloadURL(t *testing.T, rawURL string) []byte {
+	t.Helper()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	resp, err := client.Get(rawURL)
+	require.NoError(t, err, "downloadURL: GET failed")
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err, "downloadURL: read failed")
+	require.Equal(t, http.StatusOK, resp.StatusCode,
+		"downloadURL: unexpected status; body: %s", data,
+	)
+
+	return data
+}
+
+// corpusBaseJPEG returns a small, fully valid JPEG used as the carrier for
+// polyglot and truncation entries.
+func corpusBaseJPEG(t *testing.T) []byte {
+	t.Helper()
+
+	return jpegBytes(t, 320, 240)
+}
+
+// gradientImage returns a w x h RGBA image with a deterministic
+// two-axis gradient, so encoders cannot collapse it to a trivial
+// bitstream.
+func gradientImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := range h {
+		for x := range w {
+			img.Set(x, y, color.RGBA{
+				R: uint8(x * 255 / max(w-1, 1)),
+				G: uint8(y * 255 / max(h-1, 1)),
+				B: uint8((x + y) % 256),
+				A: 255,
+			})
+		}
+	}
+
+	return img
+}
+
+// jpegBytes encodes a w x h gradient as baseline JPEG.
+func jpegBytes(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	err := jpeg.Encode(&buf, gradientImage(w, h), &jpeg.Options{Quality: 90})
+	require.NoError(t, err, "jpegBytes: encode failed")
+
+	return buf.Bytes()
+}
+
+// pngBytes encodes a w x h gradient as PNG.
+func pngBytes(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	err := png.Encode(&buf, gradientImage(w, h))
+	require.NoError(t, err, "pngBytes: encode failed")
+
+	return buf.Bytes()
+}
+
+// jpegWithDeclaredSize encodes a tiny JPEG and rewrites the SOF0 frame
+// header to declare width x height. image.DecodeConfig reports the
+// declared size while the entropy-coded data only covers 16x16 pixels,
+// which is exactly the shape of a decompression bomb probe.
+func jpegWithDeclaredSize(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	data := jpegBytes(t, 16, 16)
+
+	// SOF0: FF C0, length(2), precision(1), height(2), width(2).
+	sof := bytes.Index(data, []byte{0xFF, 0xC0})
+	require.GreaterOrEqual(t, sof, 0,
+		"jpegWithDeclaredSize: SOF0 marker not found",
+	)
+
+	data[sof+5] = byte(height >> 8)
+	data[sof+6] = byte(height)
+	data[sof+7] = byte(width >> 8)
+	data[sof+8] = byte(width)
+
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	require.NoError(t, err, "jpegWithDeclaredSize: header no longer parses")
+	require.Equal(t, width, cfg.Width)
+	require.Equal(t, height, cfg.Height)
+
+	return data
+}
+
+// jpegHeaderWithGarbage keeps every marker segment of a valid JPEG up to
+// and including SOS, then replaces the entropy-coded scan with n bytes of
+// seeded pseudo-random data followed by EOI.
+func jpegHeaderWithGarbage(t *testing.T, n int) []byte {
+	t.Helper()
+
+	data := corpusBaseJPEG(t)
+
+	sos := bytes.Index(data, []byte{0xFF, 0xDA})
+	require.GreaterOrEqual(t, sos, 0,
+		"jpegHeaderWithGarbage: SOS marker not found",
+	)
+
+	sosLen := int(data[sos+2])<<8 | int(data[sos+3])
+	header := slices.Clone(data[:sos+2+sosLen])
+
+	rng := rand.New(rand.NewPCG(0xF011, 0x0C0D))
+	garbage := make([]byte, n)
+
+	for i := range garbage {
+		garbage[i] = byte(rng.UintN(256))
+	}
+
+	out := append(header, garbage...)
+
+	return append(out, 0xFF, 0xD9)
+}
+
+// zipArchive returns a ZIP archive containing a single text file whose
+// content is marker.
+func zipArchive(t *testing.T, marker string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:   "payload.txt",
+		Method: zip.Store,
+	})
+	require.NoError(t, err, "zipArchive: create entry failed")
+
+	_, err = w.Write([]byte(marker))
+	require.NoError(t, err, "zipArchive: write entry failed")
+	require.NoError(t, zw.Close(), "zipArchive: close failed")
+
+	return buf.Bytes()
+}
+
+// truncateBytes returns a copy of the first n bytes of data.
+func truncateBytes(data []byte, n int) []byte {
+	return slices.Clone(data[:min(n, len(data))])
+}
@@ -0,0 +1,393 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatewayMaxUploadBytes is the gateway's global upload cap, which
+// applies whatever max_file_size a token claims.
+const gatewayMaxUploadBytes = 10 << 20
+
+// wellFormedStorageKey matches the only key shape follow-api issues:
+// images/{image_id}.{ext}.
+var wellFormedStorageKey = regexp.MustCompile(
+	`^images/[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}` +
+		`\.(jpg|jpeg|png|webp)$`,
+)
+
+// bucketSnapshot records every stored version in the bucket so later
+// writes can be told apart from what was already there.
+type bucketSnapshot map[string]struct{}
+
+// snapshotBucket lists every version and delete marker in the bucket.
+func snapshotBucket(t *testing.T, objects *objectInspector) bucketSnapshot {
+	t.Helper()
+
+	snap := make(bucketSnapshot)
+	for _, v := range objects.versions(t, "") {
+		snap[versionRef(v)] = struct{}{}
+	}
+
+	return snap
+}
+
+// versionRef identifies one stored version.
+func versionRef(v minio.ObjectInfo) string {
+	return v.Key + "@" + v.VersionID
+}
+
+// escapedWrites returns the versions written since before that either
+// do not look like a key follow-api would issue, or belong to one of the
+// watched images. Well-formed keys of other images are ignored, so
+// processing left over from earlier tests does not count.
+func escapedWrites(
+	t *testing.T,
+	objects *objectInspector,
+	before bucketSnapshot,
+	watched ...string,
+) []string {
+	t.Helper()
+
+	var out []string
+
+	for _, v := range objects.versions(t, "") {
+		if _, seen := before[versionRef(v)]; seen {
+			continue
+		}
+
+		suspicious := !wellFormedStorageKey.MatchString(v.Key)
+		for _, id := range watched {
+			if strings.HasPrefix(v.Key, imageStorageKeyPrefix+id) {
+				suspicious = true
+			}
+		}
+
+		if suspicious {
+			out = append(out, versionRef(v))
+		}
+	}
+
+	return out
+}
+
+// TestUploadTokenAbuse_ClaimEscape signs upload tokens with the trusted
+// gateway key whose claims try to reach outside the image they were
+// issued for: traversal in storage_key, and image_id or storage_key
+// pointing at another user's processed image. The gateway must refuse
+// each before accepting bytes, and no object may appear outside the
+// expected key or over the victim's image.
+func TestUploadTokenAbuse_ClaimEscape(t *testing.T) {
+	isolate(t, isolationParallel, labelSecurity)
+
+	_, token, _ := createAnonymousUser(t)
+	_, victimToken, _ := createAnonymousUser(t)
+	objects := newObjectInspector(t)
+	db := newDBInspector(t)
+
+	victimRoute := createProcessedRoute(t, victimToken, 1)
+	victimWaypoints := db.waypoints(t, victimRoute)
+	require.Len(t, victimWaypoints, 1)
+
+	victimImage := victimWaypoints[0].ImageID
+	victimPrefix := imageStorageKeyPrefix + victimImage
+	victimVersions := objects.versions(t, victimPrefix)
+	require.NotEmpty(t, victimVersions, "victim image must be stored")
+
+	claimsRejected := []int{
+		http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden,
+	}
+
+	cases := []struct {
+		name   string
+		mutate func(claims map[string]any, imageID string)
+		want   []int
+	}{
+		{
+			name: "TraversalParent",
+			mutate: func(c map[string]any, id string) {
+				c["storage_key"] = "images/../escaped/" + id + ".jpg"
+			},
+			want: claimsRejected,
+		},
+		{
+			name: "TraversalRelative",
+			mutate: func(c map[string]any, id string) {
+				c["storage_key"] = "../../" + id + ".jpg"
+			},
+			want: claimsRejected,
+		},
+		{
+			name: "TraversalAbsolute",
+			mutate: func(c map[string]any, id string) {
+				c["storage_key"] = "/tmp/" + id + ".jpg"
+			},
+			want: claimsRejected,
+		},
+		{
+			name: "TraversalNested",
+			mutate: func(c map[string]any, id string) {
+				c["storage_key"] = "images/" + id + "/../../escaped.jpg"
+			},
+			want: claimsRejected,
+		},
+		{
+			name: "TraversalEncoded",
+			mutate: func(c map[string]any, id string) {
+				c["storage_key"] = "images/..%2f..%2f" + id + ".jpg"
+			},
+			want: claimsRejected,
+		},
+		{
+			name: "TraversalBackslash",
+			mutate: func(c map[string]any, id string) {
+				c["storage_key"] = `images\..\..\` + id + ".jpg"
+			},
+			want: claimsRejected,
+		},
+		{
+			name: "OtherUsersStorageKey",
+			mutate: func(c map[string]any, _ string) {
+				c["storage_key"] = victimPrefix + ".webp"
+			},
+			want: claimsRejected,
+		},
+		{
+			name: "OtherUsersImageID",
+			mutate: func(c map[string]any, _ string) {
+				c["image_id"] = victimImage
+			},
+			want: claimsRejected,
+		},
+		{
+			// Fully consistent claims for a finished image: the upload
+			// guard (or the claim check) must stop the overwrite.
+			name: "OtherUsersImage",
+			mutate: func(c map[string]any, _ string) {
+				c["image_id"] = victimImage
+				c["storage_key"] = victimPrefix + ".jpg"
+			},
+			want: append(claimsRejected, http.StatusConflict),
+		},
+	}
+
+	payload := jpegBytes(t, 320, 240)
+	routeID := prepareRoute(t, token)
+
+	waypoints := make([]map[string]any, len(cases))
+	for i := range waypoints {
+		waypoints[i] = buildWaypointBody(i, "escape.jpg", len(payload))
+	}
+
+	created := createRouteWithWaypointBodies(t, token, routeID, waypoints)
+	require.Len(t, created.PresignedURLs, len(cases))
+
+	watched := []string{victimImage}
+	for _, upload := range created.PresignedURLs {
+		watched = append(watched, upload.ImageID)
+	}
+
+	before := snapshotBucket(t, objects)
+
+	for i, tc := range cases {
+		upload := created.PresignedURLs[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			forged := resignUploadToken(t, upload.UploadToken,
+				func(c map[string]any) { tc.mutate(c, upload.ImageID) },
+			)
+
+			resp := uploadToGateway(t, upload.UploadURL, forged, payload)
+			resp.Body.Close()
+
+			assert.Containsf(t, tc.want, resp.StatusCode,
+				"%s: expected one of %v, got %d",
+				tc.name, tc.want, resp.StatusCode,
+			)
+		})
+	}
+
+	// Rejection must be synchronous, but give a wrongly accepted upload
+	// time to reach storage before declaring the bucket clean.
+	var escaped []string
+
+	assert.Never(t, func() bool {
+		escaped = escapedWrites(t, objects, before, watched...)
+		return len(escaped) > 0
+	}, 5*time.Second, 500*time.Millisecond,
+		"forged claims must not write outside the expected key",
+	)
+
+	if len(escaped) > 0 {
+		t.Logf("unexpected writes:\n%s", formatLeftovers(escaped))
+	}
+
+	assert.ElementsMatch(t,
+		refsOf(victimVersions), refsOf(objects.versions(t, victimPrefix)),
+		"victim image versions must be untouched",
+	)
+}
+
+// refsOf maps versions to their versionRef.
+func refsOf(versions []minio.ObjectInfo) []string {
+	out := make([]string, len(versions))
+	for i, v := range versions {
+		out[i] = versionRef(v)
+	}
+
+	return out
+}
+
+// TestUploadTokenAbuse_MaxFileSizeInflation raises max_file_size in a
+// re-signed token far past the gateway's global cap and uploads a body
+// just over that cap. The global limit must win with 413 and nothing may
+// be stored for the image.
+func TestUploadTokenAbuse_MaxFileSizeInflation(t *testing.T) {
+	isolate(t, isolationParallel, labelSecurity)
+
+	_, token, _ := createAnonymousUser(t)
+	objects := newObjectInspector(t)
+
+	// The API refuses to issue a token for more than 10MB, so the image
+	// is declared small and only the forged claim and the body grow.
+	image := jpegBytes(t, 320, 240)
+
+	routeID := prepareRoute(t, token)
+	created := createRouteWithWaypointBodies(
+		t, token, routeID,
+		[]map[string]any{
+			buildWaypointBody(0, "inflated.jpg", len(image)),
+		},
+	)
+	require.Len(t, created.PresignedURLs, 1)
+
+	payload := append(image,
+		make([]byte, gatewayMaxUploadBytes+1-len(image))...,
+	)
+
+	upload := created.PresignedURLs[0]
+	forged := resignUploadToken(t, upload.UploadToken,
+		withClaim("max_file_size", 5*gatewayMaxUploadBytes),
+	)
+
+	// Expect: 100-continue lets the gateway refuse on Content-Length
+	// without the client streaming 10MB into a closed connection.
+	resp, err := uploadToGatewayWithExpectContinue(
+		upload.UploadURL, forged, payload,
+	)
+	require.NoError(t, err, "oversized upload must get an HTTP response")
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode,
+		"the global 10MB cap must override an inflated max_file_size",
+	)
+
+	assert.Never(t, func() bool {
+		return len(objects.versions(
+			t, imageStorageKeyPrefix+upload.ImageID,
+		)) > 0
+	}, 5*time.Second, 500*time.Millisecond,
+		"oversized upload must not be stored",
+	)
+}
+
+// TestUploadTokenAbuse_Replay misuses a genuine upload token. Before
+// its own upload, the first image's token is presented at the second
+// image's upload URL and must be refused. After it, the token is
+// replayed with other bytes, once while the image is in flight and
+// once after it has finished processing; both must hit the upload
+// guard (409). The first image ends with a single stored version and
+// the second with none.
+func TestUploadTokenAbuse_Replay(t *testing.T) {
+	isolate(t, isolationParallel, labelSecurity)
+	shareState(t, stateImageResults)
+
+	_, token, _ := createAnonymousUser(t)
+	vc := newValkeyClient(t)
+	objects := newObjectInspector(t)
+
+	first := jpegBytes(t, 640, 480)
+	second := jpegBytes(t, 480, 640)
+
+	routeID := prepareRoute(t, token)
+	created := createRouteWithWaypointBodies(
+		t, token, routeID,
+		[]map[string]any{
+			buildWaypointBody(0, "first.jpg", len(first)),
+			buildWaypointBody(1, "second.jpg", len(second)),
+		},
+	)
+	require.Len(t, created.PresignedURLs, 2)
+
+	upload, other := created.PresignedURLs[0], created.PresignedURLs[1]
+	startID := fmt.Sprintf("%d-0", time.Now().UnixMilli())
+
+	t.Run("TokenAtOtherImage", func(t *testing.T) {
+		resp := uploadToGateway(t, other.UploadURL, upload.UploadToken,
+			second,
+		)
+		resp.Body.Close()
+
+		assert.Containsf(t, []int{
+			http.StatusBadRequest, http.StatusUnauthorized,
+			http.StatusForbidden, http.StatusNotFound,
+		}, resp.StatusCode,
+			"an upload token must only be accepted for its own image, "+
+				"got %d", resp.StatusCode,
+		)
+	})
+
+	resp := uploadToGateway(t, upload.UploadURL, upload.UploadToken, first)
+	resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	replay := func(t *testing.T, body []byte) {
+		t.Helper()
+
+		resp, err := uploadToGatewayWithExpectContinue(
+			upload.UploadURL, upload.UploadToken, body,
+		)
+		require.NoError(t, err, "replay must get an HTTP response")
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusConflict, resp.StatusCode,
+			"a used upload token must not be accepted again",
+		)
+	}
+
+	t.Run("InFlight", func(t *testing.T) {
+		replay(t, second)
+	})
+
+	awaitProcessed(t, vc, upload.ImageID, startID)
+
+	t.Run("AfterProcessed", func(t *testing.T) {
+		replay(t, second)
+	})
+
+	assert.Never(t, func() bool {
+		return len(objects.versions(
+			t, imageStorageKeyPrefix+upload.ImageID,
+		)) > 1
+	}, 5*time.Second, 500*time.Millisecond,
+		"replayed token must not add a version to the first image",
+	)
+	assert.Len(t,
+		objects.versions(t, imageStorageKeyPrefix+upload.ImageID), 1,
+	)
+	assert.Empty(t,
+		objects.versions(t, imageStorageKeyPrefix+other.ImageID),
+		"the second image must not receive bytes through the first "+
+			"image's token",
+	)
+}
@@ -0,0 +1,236 @@
+//go:build integration
+
+package integration_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// timingAlpha is the family-wise significance level per endpoint.
+	timingAlpha = 0.01
+	// timingMinDelta is the smallest median difference worth flagging.
+	timingMinDelta = 3 * time.Millisecond
+	// timingWarmup rounds are sent but not recorded.
+	timingWarmup = 5
+	// timingPoolSize is how many accounts back each of the existing and
+	// pending classes. Requests rotate over them so per-account
+	// throttling (lockout, resend cooldown) does not dominate.
+	timingPoolSize = 5
+)
+
+// timingAccounts are the emails each probe class draws from.
+type timingAccounts struct {
+	Existing []string
+	Pending  []string
+}
+
+// newTimingAccounts registers confirmed and unconfirmed accounts.
+func newTimingAccounts(t *testing.T) timingAccounts {
+	t.Helper()
+
+	var accounts timingAccounts
+
+	for range timingPoolSize {
+		_, anonToken, _ := createAnonymousUser(t)
+		email := uniqueEmail()
+		registerAndConfirm(t, anonToken, email)
+		accounts.Existing = append(accounts.Existing, email)
+
+		_, anonToken, _ = createAnonymousUser(t)
+		email = uniqueEmail()
+		resp := doRequest(t, http.MethodPost,
+			apiURL+"/api/v1/auth/register",
+			map[string]any{"email": email, "password": testPassword},
+			anonToken,
+		)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode,
+			"newTimingAccounts: register pending user",
+		)
+		accounts.Pending = append(accounts.Pending, email)
+	}
+
+	return accounts
+}
+
+// rotate returns a function yielding the pool's emails in turn.
+func rotate(pool []string) func() string {
+	i := 0
+
+	return func() string {
+		email := pool[i%len(pool)]
+		i++
+
+		return email
+	}
+}
+
+// jsonRequest builds a JSON request, with a bearer token if one is
+// given.
+func jsonRequest(
+	t *testing.T,
+	method, url string,
+	body any,
+	authToken string,
+) *http.Request {
+	t.Helper()
+
+	encoded, err := json.Marshal(body)
+	require.NoError(t, err)
+
+	req, err := http.NewRequestWithContext(
+		reportContext(context.Background(), t),
+		method, url, bytes.NewReader(encoded),
+	)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	if authToken != "" {
+		req.Header.Set("Authorization", "Bearer "+authToken)
+	}
+
+	return req
+}
+
+// TestUserEnumerationTiming complements the status-code checks in
+// TestLoginNonExistentEmail, TestForgotPasswordNonExistentEmail and
+// TestForgotPasswordPendingUser: the answers are the same, but if only
+// existing accounts pay for argon2id or an email send, response times
+// still reveal which addresses have an account. For each endpoint it
+// collects interleaved samples for existing, pending and nonexistent
+// emails and fails when either known class is distinguishable from
+// the nonexistent one, by timing or by the status codes it gets back.
+// A status difference (register refusing a taken email with 409, say)
+// is reported as its own finding next to the timing verdict.
+//
+// The test stack runs argon2id with reduced cost, so a leak here is
+// larger in production. TIMING_SAMPLES sets the sample count per class.
+func TestUserEnumerationTiming(t *testing.T) {
+	isolate(t, isolationSequential, labelSlow, labelSecurity)
+
+	if testing.Short() {
+		t.Skip("timing analysis sends hundreds of requests")
+	}
+
+	samples := timingSampleCount(t)
+	accounts := newTimingAccounts(t)
+
+	// nobody returns a fresh address no account has ever used.
+	nobody := func() string { return "nobody-" + uniqueEmail() }
+
+	endpoints := []struct {
+		Name  string
+		Build func(t *testing.T, email string) *http.Request
+	}{
+		{
+			Name: "Login",
+			Build: func(t *testing.T, email string) *http.Request {
+				return jsonRequest(t, http.MethodPost,
+					apiURL+"/api/v1/auth/login",
+					map[string]any{
+						"email":    email,
+						"password": "wrongpassword99",
+					}, "",
+				)
+			},
+		},
+		{
+			Name: "ForgotPassword",
+			Build: func(t *testing.T, email string) *http.Request {
+				return jsonRequest(t, http.MethodPost,
+					apiURL+"/api/v1/auth/forgot-password",
+					map[string]any{"email": email}, "",
+				)
+			},
+		},
+		{
+			// Each sample registers from a fresh anonymous user, made
+			// before the clock starts, so no email is tried twice by
+			// the same session.
+			Name: "Register",
+			Build: func(t *testing.T, email string) *http.Request {
+				_, anonToken, _ := createAnonymousUser(t)
+
+				return jsonRequest(t, http.MethodPost,
+					apiURL+"/api/v1/auth/register",
+					map[string]any{
+						"email":    email,
+						"password": testPassword,
+					}, anonToken,
+				)
+			},
+		},
+	}
+
+	for _, ep := range endpoints {
+		t.Run(ep.Name, func(t *testing.T) {
+			existing := rotate(accounts.Existing)
+			pending := rotate(accounts.Pending)
+
+			probes := []timingProbe{
+				{
+					Name: "existing",
+					Next: func(t *testing.T) *http.Request {
+						return ep.Build(t, existing())
+					},
+				},
+				{
+					Name: "pending",
+					Next: func(t *testing.T) *http.Request {
+						return ep.Build(t, pending())
+					},
+				},
+				{
+					Name: "nonexistent",
+					Next: func(t *testing.T) *http.Request {
+						return ep.Build(t, nobody())
+					},
+				},
+			}
+
+			got := collectTimings(t, samples, timingWarmup, probes)
+
+			for _, p := range probes {
+				s := got[p.Name]
+				t.Logf("%s: median %.2fms over %d samples, statuses %v",
+					p.Name, s.median(), len(s.Millis), s.Statuses,
+				)
+			}
+
+			unknown := got["nonexistent"].statusCodes()
+			for _, class := range []string{"existing", "pending"} {
+				known := got[class].statusCodes()
+				if !slices.Equal(known, unknown) {
+					t.Errorf("%s: account existence is detectable by "+
+						"status: %s gets %v, nonexistent gets %v",
+						ep.Name, class, known, unknown,
+					)
+				}
+			}
+
+			for _, v := range compareTimings(got, "nonexistent",
+				[]string{"existing", "pending"},
+				timingAlpha, timingMinDelta,
+			) {
+				if v.Detectable {
+					t.Errorf("%s: account existence is detectable by "+
+						"timing: %s", ep.Name, v,
+					)
+
+					continue
+				}
+
+				t.Logf("%s", v)
+			}
+		})
+	}
+}